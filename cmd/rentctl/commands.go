@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/forms"
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+	"github.com/sanijo/rent-app/internal/rentstatus"
+	"github.com/sanijo/rent-app/internal/repository"
+)
+
+// usage lists the commands
+const usage = `usage: rentctl [flags] <command> [command flags]
+
+commands:
+  user create -email EMAIL -first-name NAME -last-name NAME [-access-level N]
+        create a user, the password is read from the first line of stdin
+  rents upcoming [-start DATE] [-end DATE]
+        list rentals overlapping the dates, by default the next 30 days
+  rents export [-format csv|json]
+        write all rentals to stdout
+  rent cancel -id ID
+        cancel a rental, free its vehicle and refund it if it was paid
+  block add -model ID -start DATE -end DATE
+        block a free vehicle of a model, the end date is exclusive
+  block remove -id ID
+        remove an owner block
+
+Dates have the form 2006-01-02.
+`
+
+// dateLayout is the date format of command flags
+const dateLayout = "2006-01-02"
+
+// minPasswordLength is the minimum length of new passwords
+const minPasswordLength = 8
+
+// cli runs commands against a repository
+type cli struct {
+    repo repository.DatabaseRepo
+    // payments refunds paid rents that are cancelled
+    payments payments.Provider
+    in io.Reader
+    out io.Writer
+}
+
+// run runs the command given by args, e.g. "block add -model 1 ..."
+func (c *cli) run(args []string) error {
+    if len(args) < 2 {
+        return fmt.Errorf("missing command, run rentctl help")
+    }
+
+    commands := map[string]func([]string) error{
+        "user create": c.createUser,
+        "rents upcoming": c.upcomingRents,
+        "rents export": c.exportRents,
+        "rent cancel": c.cancelRent,
+        "block add": c.addBlock,
+        "block remove": c.removeBlock,
+    }
+
+    name := args[0] + " " + args[1]
+    command, ok := commands[name]
+    if !ok {
+        return fmt.Errorf("unknown command %q, run rentctl help", name)
+    }
+
+    return command(args[2:])
+}
+
+// newFlagSet returns a flag set for a command that reports errors instead of
+// exiting
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+    fs := flag.NewFlagSet(name, flag.ContinueOnError)
+    fs.SetOutput(c.out)
+    return fs
+}
+
+// parseDate parses a date flag
+func parseDate(name, value string) (time.Time, error) {
+    d, err := time.Parse(dateLayout, value)
+    if err != nil {
+        return d, fmt.Errorf("invalid -%s %q, expected a date like 2050-01-31", name, value)
+    }
+    return d, nil
+}
+
+// createUser creates a user with a bcrypt password read from stdin
+func (c *cli) createUser(args []string) error {
+    fs := c.newFlagSet("user create")
+    email := fs.String("email", "", "email used to log in")
+    firstName := fs.String("first-name", "", "first name")
+    lastName := fs.String("last-name", "", "last name")
+    accessLevel := fs.Int("access-level", 1, fmt.Sprintf("access level, %d for admins", models.AccessLevelAdmin))
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    password, err := bufio.NewReader(c.in).ReadString('\n')
+    if err != nil && !errors.Is(err, io.EOF) {
+        return err
+    }
+    password = strings.TrimRight(password, "\r\n")
+
+    // validate with the same rules as the forms of the web app
+    form := forms.New(url.Values{
+        "email": {*email},
+        "first_name": {*firstName},
+        "password": {password},
+    })
+    form.Required("email", "first_name", "password")
+    form.IsEmail("email")
+    form.MinLength("password", minPasswordLength)
+    if !form.Valid() {
+        for _, field := range []string{"email", "first_name", "password"} {
+            if msg := form.Errors.Get(field); msg != "" {
+                return fmt.Errorf("%s: %s", field, msg)
+            }
+        }
+    }
+
+    id, err := c.repo.InsertUser(models.User{
+        FirstName: *firstName,
+        LastName: *lastName,
+        Email: *email,
+        AccessLevel: *accessLevel,
+    }, password)
+    if errors.Is(err, repository.ErrAlreadyExists) {
+        return fmt.Errorf("a user with email %s already exists", *email)
+    }
+    if err != nil {
+        return err
+    }
+
+    fmt.Fprintf(c.out, "Created user %d (%s)\n", id, *email)
+    return nil
+}
+
+// upcomingRents lists the rents overlapping a date range that are not
+// cancelled
+func (c *cli) upcomingRents(args []string) error {
+    today := time.Now().UTC().Truncate(24 * time.Hour)
+
+    fs := c.newFlagSet("rents upcoming")
+    startFlag := fs.String("start", today.Format(dateLayout), "first day")
+    endFlag := fs.String("end", today.AddDate(0, 0, 30).Format(dateLayout), "day after the last day")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    start, err := parseDate("start", *startFlag)
+    if err != nil {
+        return err
+    }
+    end, err := parseDate("end", *endFlag)
+    if err != nil {
+        return err
+    }
+    if !end.After(start) {
+        return errors.New("-end must be after -start")
+    }
+
+    rents, err := c.repo.RentsBetween(start, end)
+    if err != nil {
+        return err
+    }
+
+    tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(tw, "ID\tSTATUS\tSTART\tEND\tMODEL\tNAME\tEMAIL\tTOTAL")
+    for _, rent := range rents {
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s %s\t%s\t%s\n",
+            rent.ID,
+            rent.Status,
+            rent.StartDate.Format(dateLayout),
+            rent.EndDate.Format(dateLayout),
+            rent.Model.ModelName,
+            rent.FirstName,
+            rent.LastName,
+            rent.Email,
+            rent.TotalPrice)
+    }
+    return tw.Flush()
+}
+
+// exportedRent is a rent as written by rents export
+type exportedRent struct {
+    ID int `json:"id"`
+    Reference string `json:"reference"`
+    Status string `json:"status"`
+    FirstName string `json:"first_name"`
+    LastName string `json:"last_name"`
+    Email string `json:"email"`
+    Phone string `json:"phone"`
+    ModelID int `json:"model_id"`
+    ModelName string `json:"model_name"`
+    StartDate string `json:"start_date"`
+    EndDate string `json:"end_date"`
+    TotalPriceCents models.Money `json:"total_price_cents"`
+    Processed int `json:"processed"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// csvHeader is the first line of the csv export
+var csvHeader = []string{"id", "reference", "status", "first_name", "last_name", "email", "phone", "model_id", "model_name", "start_date", "end_date", "total_price_cents", "processed", "created_at"}
+
+// exportRents writes all rents as csv or json
+func (c *cli) exportRents(args []string) error {
+    fs := c.newFlagSet("rents export")
+    format := fs.String("format", "csv", "csv or json")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *format != "csv" && *format != "json" {
+        return fmt.Errorf("invalid -format %q, expected csv or json", *format)
+    }
+
+    rents, err := c.repo.AllRents()
+    if err != nil {
+        return err
+    }
+
+    exported := make([]exportedRent, 0, len(rents))
+    for _, rent := range rents {
+        exported = append(exported, exportedRent{
+            ID: rent.ID,
+            Reference: rent.Reference,
+            Status: rent.Status,
+            FirstName: rent.FirstName,
+            LastName: rent.LastName,
+            Email: rent.Email,
+            Phone: rent.Phone,
+            ModelID: rent.ModelID,
+            ModelName: rent.Model.ModelName,
+            StartDate: rent.StartDate.Format(dateLayout),
+            EndDate: rent.EndDate.Format(dateLayout),
+            TotalPriceCents: rent.TotalPrice,
+            Processed: rent.Processed,
+            CreatedAt: rent.CreatedAt,
+        })
+    }
+
+    if *format == "json" {
+        enc := json.NewEncoder(c.out)
+        enc.SetIndent("", "    ")
+        return enc.Encode(exported)
+    }
+
+    w := csv.NewWriter(c.out)
+    w.Write(csvHeader)
+    for _, r := range exported {
+        w.Write([]string{
+            strconv.Itoa(r.ID),
+            r.Reference,
+            r.Status,
+            r.FirstName,
+            r.LastName,
+            r.Email,
+            r.Phone,
+            strconv.Itoa(r.ModelID),
+            r.ModelName,
+            r.StartDate,
+            r.EndDate,
+            strconv.FormatInt(int64(r.TotalPriceCents), 10),
+            strconv.Itoa(r.Processed),
+            r.CreatedAt.Format(time.RFC3339),
+        })
+    }
+    w.Flush()
+    return w.Error()
+}
+
+// cancelRent cancels a rent, which frees its vehicle and refunds it if it was
+// paid
+func (c *cli) cancelRent(args []string) error {
+    fs := c.newFlagSet("rent cancel")
+    id := fs.Int("id", 0, "rent id")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    rent, err := c.repo.GetRentByID(*id)
+    if errors.Is(err, sql.ErrNoRows) {
+        return fmt.Errorf("there is no rent %d", *id)
+    }
+    if err != nil {
+        return err
+    }
+
+    err = rentstatus.Check(rent, models.RentCancelled, time.Now())
+    if err != nil {
+        return err
+    }
+
+    err = rentstatus.Cancel(c.repo, c.payments, rent, "rentctl")
+    if errors.Is(err, rentstatus.ErrRefundFailed) {
+        fmt.Fprintf(c.out, "Cancelled rent %d of %s\n", rent.ID, rent.Email)
+        return fmt.Errorf("%w, please refund %s by hand", err, rent.TotalPrice)
+    }
+    if err != nil {
+        return err
+    }
+
+    fmt.Fprintf(c.out, "Cancelled rent %d of %s\n", rent.ID, rent.Email)
+    return nil
+}
+
+// addBlock blocks a free vehicle of a model
+func (c *cli) addBlock(args []string) error {
+    fs := c.newFlagSet("block add")
+    modelID := fs.Int("model", 0, "model id")
+    startFlag := fs.String("start", "", "first blocked day")
+    endFlag := fs.String("end", "", "day after the last blocked day")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    start, err := parseDate("start", *startFlag)
+    if err != nil {
+        return err
+    }
+    end, err := parseDate("end", *endFlag)
+    if err != nil {
+        return err
+    }
+    if !end.After(start) {
+        return errors.New("-end must be after -start")
+    }
+
+    block, err := c.repo.InsertOwnerBlock(*modelID, start, end)
+    if errors.Is(err, repository.ErrNotAvailable) {
+        return fmt.Errorf("model %d has no free vehicle from %s to %s", *modelID, *startFlag, *endFlag)
+    }
+    if err != nil {
+        return err
+    }
+
+    fmt.Fprintf(c.out, "Added owner block %d on vehicle %d\n", block.ID, block.VehicleID)
+    return nil
+}
+
+// removeBlock removes an owner block
+func (c *cli) removeBlock(args []string) error {
+    fs := c.newFlagSet("block remove")
+    id := fs.Int("id", 0, "owner block id")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    err := c.repo.DeleteOwnerBlock(*id)
+    if errors.Is(err, sql.ErrNoRows) {
+        return fmt.Errorf("there is no owner block %d", *id)
+    }
+    if err != nil {
+        return err
+    }
+
+    fmt.Fprintf(c.out, "Removed owner block %d\n", *id)
+    return nil
+}
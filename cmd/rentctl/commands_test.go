@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+	"github.com/sanijo/rent-app/internal/repository/dbrepo"
+)
+
+func TestCLI_Run(t *testing.T) {
+    var tests = []struct {
+        name string
+        args []string
+        stdin string
+        expectedOutput string
+        expectedError string
+    }{
+        {"missing command", []string{"user"}, "", "", "missing command"},
+        {"unknown command", []string{"user", "delete"}, "", "", "unknown command"},
+        {"create user", []string{"user", "create", "-email", "me@here.ca", "-first-name", "Me"}, "password123\n", "Created user 1 (me@here.ca)", ""},
+        {"create user short password", []string{"user", "create", "-email", "me@here.ca", "-first-name", "Me"}, "short\n", "", "password"},
+        {"create user invalid email", []string{"user", "create", "-email", "me", "-first-name", "Me"}, "password123\n", "", "email"},
+        {"create user email taken", []string{"user", "create", "-email", "taken@here.ca", "-first-name", "Me"}, "password123", "", "already exists"},
+        {"upcoming rents", []string{"rents", "upcoming", "-start", "2050-01-01", "-end", "2050-02-01"}, "", "john@doe.com", ""},
+        {"upcoming rents invalid date", []string{"rents", "upcoming", "-start", "tomorrow"}, "", "", "invalid -start"},
+        {"upcoming rents end before start", []string{"rents", "upcoming", "-start", "2050-01-02", "-end", "2050-01-01"}, "", "", "-end must be after -start"},
+        {"upcoming rents database error", []string{"rents", "upcoming", "-start", "2021-01-02", "-end", "2021-01-03"}, "", "", "some error"},
+        {"export csv", []string{"rents", "export"}, "", "1,K7QMX2RA9T,confirmed,John,Doe,john@doe.com,,1,Model 3,2050-01-01,2050-01-03,16000", ""},
+        {"export cancelled rent", []string{"rents", "export"}, "", "5,P4WNZ8HC3L,cancelled,Jane,Doe,jane@doe.com", ""},
+        {"export unknown format", []string{"rents", "export", "-format", "xml"}, "", "", "invalid -format"},
+        {"cancel rent", []string{"rent", "cancel", "-id", "1"}, "", "Cancelled rent 1 of john@doe.com", ""},
+        {"cancel missing rent", []string{"rent", "cancel", "-id", "3"}, "", "", "there is no rent 3"},
+        {"cancel rent database error", []string{"rent", "cancel", "-id", "4"}, "", "", "some error"},
+        {"cancel paid rent, refund fails", []string{"rent", "cancel", "-id", "6"}, "", "", "please refund"},
+        {"cancel pending rent", []string{"rent", "cancel", "-id", "2"}, "", "Cancelled rent 2 of john@doe.com", ""},
+        {"add block", []string{"block", "add", "-model", "1", "-start", "2050-01-01", "-end", "2050-01-05"}, "", "Added owner block 1 on vehicle 1", ""},
+        {"add block no free vehicle", []string{"block", "add", "-model", "2", "-start", "2050-01-01", "-end", "2050-01-05"}, "", "", "no free vehicle"},
+        {"add block missing dates", []string{"block", "add", "-model", "1"}, "", "", "invalid -start"},
+        {"remove block", []string{"block", "remove", "-id", "1"}, "", "Removed owner block 1", ""},
+        {"remove missing block", []string{"block", "remove", "-id", "2"}, "", "", "there is no owner block 2"},
+    }
+
+    var a config.AppConfig
+    repo := dbrepo.NewTestingRepo(&a)
+    // the fake provider doesn't know the intents of the test repository, so
+    // refunds fail
+    provider := payments.NewFake("0123456789abcdef")
+
+    for _, e := range tests {
+        var out bytes.Buffer
+        c := &cli{repo: repo, payments: provider, in: strings.NewReader(e.stdin), out: &out}
+
+        err := c.run(e.args)
+        if e.expectedError != "" {
+            if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+                t.Errorf("for %s, expected error containing %q, got %v", e.name, e.expectedError, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("for %s, unexpected error: %s", e.name, err)
+            continue
+        }
+        if !strings.Contains(out.String(), e.expectedOutput) {
+            t.Errorf("for %s, expected output containing %q, got %q", e.name, e.expectedOutput, out.String())
+        }
+    }
+}
+
+// refundingProvider is the fake provider, but refunds any intent and records
+// the refunds
+type refundingProvider struct {
+    *payments.Fake
+    refunds []string
+}
+
+func (p *refundingProvider) Refund(intentID string, amount models.Money) error {
+    p.refunds = append(p.refunds, intentID)
+    return nil
+}
+
+func TestCLI_CancelPaidRent(t *testing.T) {
+    var a config.AppConfig
+    var out bytes.Buffer
+    provider := &refundingProvider{Fake: payments.NewFake("0123456789abcdef")}
+    c := &cli{repo: dbrepo.NewTestingRepo(&a), payments: provider, in: strings.NewReader(""), out: &out}
+
+    err := c.run([]string{"rent", "cancel", "-id", "6"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(provider.refunds) != 1 || provider.refunds[0] != "pi_paid" {
+        t.Errorf("expected the payment to be refunded, got refunds %v", provider.refunds)
+    }
+    if !strings.Contains(out.String(), "Cancelled rent 6") {
+        t.Errorf("expected the rent to be cancelled, got %q", out.String())
+    }
+}
+
+func TestCLI_UpcomingWithoutCancelled(t *testing.T) {
+    var a config.AppConfig
+    var out bytes.Buffer
+    c := &cli{repo: dbrepo.NewTestingRepo(&a), in: strings.NewReader(""), out: &out}
+
+    err := c.run([]string{"rents", "upcoming", "-start", "2050-01-01", "-end", "2050-02-01"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if strings.Contains(out.String(), "jane@doe.com") {
+        t.Errorf("expected no cancelled rents, got %q", out.String())
+    }
+}
+
+func TestCLI_ExportJSON(t *testing.T) {
+    var a config.AppConfig
+    var out bytes.Buffer
+    c := &cli{repo: dbrepo.NewTestingRepo(&a), in: strings.NewReader(""), out: &out}
+
+    err := c.run([]string{"rents", "export", "-format", "json"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var rents []exportedRent
+    if err := json.Unmarshal(out.Bytes(), &rents); err != nil {
+        t.Fatalf("output is not valid json: %s", err)
+    }
+    if len(rents) != 2 || rents[0].ModelName != "Model 3" || rents[0].TotalPriceCents != 16000 {
+        t.Errorf("unexpected export %+v", rents)
+    }
+    if len(rents) == 2 && (rents[1].Status != models.RentCancelled || rents[1].Reference != "P4WNZ8HC3L") {
+        t.Errorf("expected the status and reference of the cancelled rent, got %+v", rents[1])
+    }
+}
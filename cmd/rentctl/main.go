@@ -0,0 +1,64 @@
+// rentctl manages users, rentals and owner blocks from the command line.
+//
+// Usage:
+//
+//	rentctl [flags] <command> [command flags]
+//
+// The flags are the database flags of the web app, e.g. -dburl or -dbconfig.
+// Run rentctl help for the commands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/driver"
+	"github.com/sanijo/rent-app/internal/payments"
+	"github.com/sanijo/rent-app/internal/repository/dbrepo"
+)
+
+var app config.AppConfig
+
+func main() {
+    err := run(os.Args[1:])
+    if errors.Is(err, flag.ErrHelp) {
+        os.Exit(0)
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "rentctl:", err)
+        os.Exit(1)
+    }
+}
+
+// run loads the configuration, connects to the database and runs the command
+// left after the flags
+func run(args []string) error {
+    err := config.Load(&app, args, os.Getenv)
+    if err != nil {
+        return err
+    }
+
+    if len(app.Args) == 0 || app.Args[0] == "help" {
+        fmt.Fprint(os.Stderr, usage)
+        return nil
+    }
+
+    db, err := driver.ConnectSQL(app.DB.DSN())
+    if err != nil {
+        return fmt.Errorf("cannot connect to database: %w", err)
+    }
+    defer db.SQL.Close()
+
+    c := &cli{
+        repo: dbrepo.NewPostgresRepo(db.SQL, &app),
+        // the fake provider is the only one so far, see config.Validate
+        payments: payments.NewFake(app.SecretKey),
+        in: os.Stdin,
+        out: os.Stdout,
+    }
+
+    return c.run(app.Args)
+}
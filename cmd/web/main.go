@@ -1,72 +1,177 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/sanijo/rent-app/internal/config"
 	"github.com/sanijo/rent-app/internal/driver"
 	"github.com/sanijo/rent-app/internal/handlers"
 	"github.com/sanijo/rent-app/internal/helpers"
+	"github.com/sanijo/rent-app/internal/holds"
+	"github.com/sanijo/rent-app/internal/logging"
+	"github.com/sanijo/rent-app/internal/mail"
+	"github.com/sanijo/rent-app/internal/metrics"
 	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/pricing"
 	"github.com/sanijo/rent-app/internal/render"
+	"github.com/sanijo/rent-app/static"
+	"github.com/sanijo/rent-app/templates"
 
 	"github.com/alexedwards/scs/v2"
 )
 
-const portNumber = ":8080"
+// holdSweepInterval is how often expired holds are released
+const holdSweepInterval = time.Minute
+
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
+var sweeper *holds.Sweeper
 
 // main is the main app function
 func main() {
 
-    db, err := run()
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        err := runMigrate(os.Args[2:], os.Stdout)
+        if err != nil && !errors.Is(err, flag.ErrHelp) {
+            log.Fatal(err)
+        }
+        return
+    }
+
+    db, err := run(os.Args[1:])
+    if errors.Is(err, flag.ErrHelp) {
+        // usage was printed by the flag package
+        os.Exit(0)
+    }
     if err != nil {
         log.Fatal(err)
     }
-    // Close database connection when main function ends
-    defer db.SQL.Close()
 
-    fmt.Println("Starting application on port", portNumber)
+    app.Logger.Info("starting application", "addr", app.Addr)
 
     server := &http.Server {
-        Addr: portNumber,
+        Addr: app.Addr,
         Handler: routes(&app),
     }
 
-    err = server.ListenAndServe()
+    // Stop on Ctrl+C and on SIGTERM sent by deploys
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    ln, err := net.Listen("tcp", server.Addr)
+    if err == nil {
+        err = serve(ctx, server, ln, app.ShutdownTimeout)
+    }
     if err != nil {
-        log.Fatal("Server error:", err)
+        app.Logger.Error("server error", "error", err)
+    }
+
+    shutdown(db)
+
+    // A server that crashed or didn't drain in time is not a clean stop
+    if err != nil {
+        os.Exit(1)
     }
-        
 } 
 
-func run() (*driver.DB, error) {
+// serve runs server on ln until ctx is done, then stops accepting connections
+// and gives in-flight requests timeout to finish
+func serve(ctx context.Context, server *http.Server, ln net.Listener, timeout time.Duration) error {
+    serverErr := make(chan error, 1)
+    go func() {
+        serverErr <- server.Serve(ln)
+    }()
+
+    select {
+    case err := <-serverErr:
+        return err
+    case <-ctx.Done():
+    }
+
+    app.Logger.Info("shutting down, draining requests", "timeout", timeout)
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+
+    return server.Shutdown(shutdownCtx)
+}
+
+// shutdown stops the background workers once no more requests are served and
+// closes the database connection last, since workers may still use it
+func shutdown(db *driver.DB) {
+    ctx, cancel := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+    defer cancel()
+
+    err := sweeper.Stop(ctx)
+    if err != nil {
+        app.Logger.Error("cannot stop hold sweeper", "error", err)
+    }
+
+    err = mail.StopListening(ctx)
+    if err != nil {
+        app.Logger.Error("cannot stop mail listener", "error", err)
+    }
+
+    err = db.SQL.Close()
+    if err != nil {
+        app.Logger.Error("cannot close database connection", "error", err)
+    }
+    app.Logger.Info("stopped")
+}
+
+// connectDB connects to the database, retrying until the configured connect
+// timeout if the database isn't up yet
+func connectDB() (*driver.DB, error) {
+    if app.DB.ConnectTimeout == 0 {
+        return driver.ConnectSQL(app.DB.DSN())
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), app.DB.ConnectTimeout)
+    defer cancel()
+
+    return driver.ConnectSQLWithRetry(ctx, app.DB.DSN(), func(err error, wait time.Duration) {
+        app.Logger.Warn("cannot connect to database, retrying", "wait", wait, "error", err)
+    })
+}
+
+// run sets up the application from command-line args, environment variables
+// and optionally database.yml
+func run(args []string) (*driver.DB, error) {
     // What to put in session
     gob.Register(models.Rent{})
+    gob.Register(pricing.Quote{})
     gob.Register(models.User{})
     gob.Register(models.Model{})
     gob.Register(models.RestrictionType{})
+    gob.Register(models.RentRestriction{})
+
+    // Load configuration, see config.Load for precedence
+    err := config.Load(&app, args, os.Getenv)
+    if err != nil {
+        return nil, fmt.Errorf("invalid configuration: %w", err)
+    }
 
-    // Change to true if in production
-    app.InProduction = false
+    // Set up mail channel
+    mailChan := make(chan models.MailData, 100)
+    app.MailChan = mailChan
 
-    // Set up info and error loggers
-    infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-    app.InfoLog = infoLog
-    errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-    app.ErrorLog = errorLog
+    // Set up structured logger
+    app.Logger = logging.New(os.Stdout, app.LogFormat, app.LogLevel)
 
     // Set up session
     session = scs.New()
-    session.Lifetime = 24 * time.Hour
+    session.Lifetime = app.SessionLifetime
     session.Cookie.Persist = true
     session.Cookie.SameSite = http.SameSiteLaxMode
     session.Cookie.Secure = app.InProduction // in production: true
@@ -75,32 +180,74 @@ func run() (*driver.DB, error) {
     app.Session = session
 
     // Connect to database
-    log.Println("Connecting to database...")
-    db, err := driver.ConnectSQL("host=localhost port=5432 dbname=rent-app user=postgres sslmode=disable")
+    app.Logger.Info("connecting to database")
+    db, err := connectDB()
     if err != nil {
-        log.Fatal("Cannot connect to database!")
+        return nil, fmt.Errorf("cannot connect to database: %w", err)
+    }
+    app.Logger.Info("connected to database")
+    metrics.RegisterDBStats(metrics.Default, db.SQL)
+
+    if app.Migrate {
+        n, err := newMigrator(db).Up()
+        if err != nil {
+            db.SQL.Close()
+            return nil, fmt.Errorf("cannot migrate database: %w", err)
+        }
+        app.Logger.Info("database migrated", "applied", n)
+    }
+
+    // Templates and static files are embedded into the binary, unless they
+    // are read from an assets directory on disk while developing
+    app.TemplateFS = templates.FS
+    app.StaticFS = static.FS
+    if app.AssetsDir != "" {
+        app.Logger.Info("serving templates and static files from disk", "dir", app.AssetsDir)
+        app.TemplateFS = os.DirFS(filepath.Join(app.AssetsDir, "templates"))
+        app.StaticFS = os.DirFS(filepath.Join(app.AssetsDir, "static"))
     }
-    log.Println("Connected to database!")
+
+    // Give access to app config variable inside render package
+    render.NewRenderer(&app)
 
     // Create template cache
     tc, err := render.CreateTemplateCache()
 	if err != nil {
-        log.Fatal("cannot create template cache")
-        return nil, err
+        db.SQL.Close()
+        return nil, fmt.Errorf("cannot create template cache: %w", err)
 	}
    
     // Setting TemplateCache in config so that is cached all the time while app
     // is running
     app.TemplateCache = tc
-    app.UseCache = false
 
     // Create repo and handlers
     repo := handlers.NewRepo(&app, db)
     handlers.NewHandlers(repo)
     // Give access to app config variable inside helpers package
     helpers.NewHelpers(&app)
-    // Give access to app config variable inside render package
-    render.NewRenderer(&app)
+
+    // The file transport writes emails into files, so that no mail server is
+    // needed while developing
+    var transport mail.Transport = &mail.FileTransport{Dir: app.Mail.Dir}
+    if app.Mail.Transport == "smtp" {
+        transport = &mail.SMTPTransport{
+            Host: app.Mail.SMTPHost,
+            Port: app.Mail.SMTPPort,
+            Username: app.Mail.SMTPUsername,
+            Password: app.Mail.SMTPPassword,
+        }
+    }
+    mail.NewMail(&app, transport)
+    app.Logger.Info("starting mail listener")
+    mail.ListenForMail()
+
+    // Vehicles held for customers who left the rent form are released once
+    // their hold expires, and those of rents that weren't paid in time
+    app.Logger.Info("starting hold sweeper", "interval", holdSweepInterval)
+    sweeper = holds.NewSweeper(repo.DB, holdSweepInterval, app.Logger)
+    sweeper.PaymentTimeout = app.PaymentTimeout
+    sweeper.Start()
 
     return db, nil
 }
@@ -1,6 +1,17 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/logging"
+)
 
 var tests = []struct {
 	name    string
@@ -15,9 +26,99 @@ var tests = []struct {
 func TestRun(t *testing.T) {
 	for _, e := range tests {
 		t.Run(e.name, func(t *testing.T) {
-			if _, err := run(); (err != nil) != e.wantErr {
+			if _, err := run(nil); (err != nil) != e.wantErr {
 				t.Errorf("run() error = %v, wantErr %v", err, e.wantErr)
 			}
 		})
 	}
 }
+
+func TestServe(t *testing.T) {
+    app.Logger = logging.New(io.Discard, "text", slog.LevelInfo)
+
+    var tests = []struct {
+        name string
+        timeout time.Duration
+        expectedStatusCode int
+        expectedErr error
+    }{
+        {"in-flight request finishes", time.Second, http.StatusOK, nil},
+        {"drain timeout exceeded", 10 * time.Millisecond, 0, context.DeadlineExceeded},
+    }
+
+    for _, e := range tests {
+        t.Run(e.name, func(t *testing.T) {
+            started := make(chan struct{})
+            server := &http.Server{
+                Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                    close(started)
+                    time.Sleep(200 * time.Millisecond)
+                    w.WriteHeader(http.StatusOK)
+                }),
+            }
+
+            ln, err := net.Listen("tcp", "127.0.0.1:0")
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            ctx, cancel := context.WithCancel(context.Background())
+            serveErr := make(chan error, 1)
+            go func() {
+                serveErr <- serve(ctx, server, ln, e.timeout)
+            }()
+
+            statusCode := make(chan int, 1)
+            go func() {
+                resp, err := http.Get("http://" + ln.Addr().String())
+                if err != nil {
+                    statusCode <- 0
+                    return
+                }
+                resp.Body.Close()
+                statusCode <- resp.StatusCode
+            }()
+
+            // shut down while the request is in flight
+            <-started
+            cancel()
+
+            err = <-serveErr
+            if !errors.Is(err, e.expectedErr) {
+                t.Errorf("expected error %v, got %v", e.expectedErr, err)
+            }
+            if e.expectedStatusCode != 0 {
+                if got := <-statusCode; got != e.expectedStatusCode {
+                    t.Errorf("expected status %d, got %d", e.expectedStatusCode, got)
+                }
+            }
+        })
+    }
+}
+
+func TestParseMigrateArgs(t *testing.T) {
+    var tests = []struct {
+        args []string
+        command string
+        version string
+        wantErr bool
+    }{
+        {[]string{"up"}, "up", "", false},
+        {[]string{"status"}, "status", "", false},
+        {[]string{"down"}, "down", "", false},
+        {[]string{"down", "20230615130512"}, "down", "20230615130512", false},
+        {nil, "", "", true},
+        {[]string{"sideways"}, "", "", true},
+        {[]string{"up", "20230615130512"}, "", "", true},
+    }
+
+    for _, e := range tests {
+        command, version, err := parseMigrateArgs(e.args)
+        if (err != nil) != e.wantErr {
+            t.Errorf("for %v, expected error %v, got %v", e.args, e.wantErr, err)
+        }
+        if command != e.command || version != e.version {
+            t.Errorf("for %v, expected %q %q, got %q %q", e.args, e.command, e.version, command, version)
+        }
+    }
+}
@@ -2,10 +2,83 @@ package main
 
 import (
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
+	"github.com/sanijo/rent-app/internal/helpers"
+	"github.com/sanijo/rent-app/internal/logging"
+	"github.com/sanijo/rent-app/internal/metrics"
 )
 
+// requestIDHeader carries the request id from a proxy and back to the client
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches request ids accepted from proxies
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID attaches a request id to the context and the response. An id set
+// by a proxy is kept, so that its logs can be matched with ours.
+func RequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(requestIDHeader)
+        if !validRequestID.MatchString(id) {
+            id = logging.NewRequestID()
+        }
+
+        w.Header().Set(requestIDHeader, id)
+        next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+    })
+}
+
+// Metrics counts requests and measures their latency by chi route pattern,
+// so that e.g. all /admin/rents/{src}/{id} requests are counted together
+func Metrics(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+        next.ServeHTTP(ww, r)
+
+        route := "unmatched"
+        if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+            route = rctx.RoutePattern()
+        }
+        status := ww.Status()
+        if status == 0 {
+            status = http.StatusOK
+        }
+
+        metrics.HTTPRequests.Inc(r.Method, route, strconv.Itoa(status))
+        metrics.HTTPDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+    })
+}
+
+// AccessLog logs every request once it has been served
+func AccessLog(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+        next.ServeHTTP(ww, r)
+
+        status := ww.Status()
+        if status == 0 {
+            status = http.StatusOK
+        }
+        app.Logger.InfoContext(r.Context(), "request",
+            "method", r.Method,
+            "path", r.URL.Path,
+            "status", status,
+            "bytes", ww.BytesWritten(),
+            "duration", time.Since(start))
+    })
+}
+
 // NoSurf adds CSRF protection to all POST requests
 func NoSurf(next http.Handler) http.Handler {
     csrfHandler := nosurf.New(next)
@@ -17,6 +90,12 @@ func NoSurf(next http.Handler) http.Handler {
         SameSite: http.SameSiteLaxMode,
     })
 
+    // The JSON API doesn't use cookies for authentication, so it needs no
+    // CSRF token. Payment webhooks are signed by the provider instead.
+    csrfHandler.ExemptFunc(func(r *http.Request) bool {
+        return strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/payment/webhook"
+    })
+
     return csrfHandler
 }
 
@@ -24,3 +103,27 @@ func NoSurf(next http.Handler) http.Handler {
 func SessionLoad(next http.Handler) http.Handler {
     return session.LoadAndSave(next)
 }
+
+// Auth redirects to the login page if the user is not logged in
+func Auth(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !helpers.IsAuthenticated(r) {
+            session.Put(r.Context(), "error", "Log in first!")
+            http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// Admin redirects to the home page if the logged in user is not an admin
+func Admin(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !helpers.IsAdmin(r) {
+            session.Put(r.Context(), "error", "Access denied!")
+            http.Redirect(w, r, "/", http.StatusSeeOther)
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/sanijo/rent-app/internal/logging"
+	"github.com/sanijo/rent-app/internal/metrics"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -34,3 +41,112 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
 	}
 }
+
+func TestAuth(t *testing.T) {
+    // Create a dummy next handler for testing
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	h := Auth(nextHandler)
+
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
+	}
+}
+
+func TestAdmin(t *testing.T) {
+    // Create a dummy next handler for testing
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	h := Admin(nextHandler)
+
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
+	}
+}
+
+func TestRequestID(t *testing.T) {
+    var tests = []struct {
+        name string
+        header string
+        keep bool
+    }{
+        {"new id", "", false},
+        {"id from proxy", "proxy-id.123", true},
+        {"invalid id from proxy", "bad id\n", false},
+    }
+
+    for _, e := range tests {
+        var got string
+        h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            got = logging.RequestID(r.Context())
+        }))
+
+        r := httptest.NewRequest("GET", "/", nil)
+        if e.header != "" {
+            r.Header.Set("X-Request-ID", e.header)
+        }
+        rr := httptest.NewRecorder()
+        h.ServeHTTP(rr, r)
+
+        if got == "" || rr.Header().Get("X-Request-ID") != got {
+            t.Errorf("for %s, expected request id %q in response header, got %q", e.name, got, rr.Header().Get("X-Request-ID"))
+        }
+        if e.keep && got != e.header {
+            t.Errorf("for %s, expected request id %q, got %q", e.name, e.header, got)
+        }
+        if !e.keep && got == e.header {
+            t.Errorf("for %s, expected a new request id, got %q", e.name, got)
+        }
+    }
+}
+
+func TestAccessLog(t *testing.T) {
+    var buf bytes.Buffer
+    app.Logger = logging.New(&buf, "text", slog.LevelInfo)
+
+    h := RequestID(AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusTeapot)
+        w.Write([]byte("hello"))
+    })))
+
+    r := httptest.NewRequest("POST", "/rent", nil)
+    r.Header.Set("X-Request-ID", "abc")
+    h.ServeHTTP(httptest.NewRecorder(), r)
+
+    for _, want := range []string{"msg=request", "method=POST", "path=/rent", "status=418", "bytes=5", "duration=", "request_id=abc"} {
+        if !strings.Contains(buf.String(), want) {
+            t.Errorf("expected %q in access log, got %s", want, buf.String())
+        }
+    }
+}
+
+func TestMetrics(t *testing.T) {
+    mux := chi.NewRouter()
+    mux.Use(Metrics)
+    mux.Get("/rents/{id}", func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNotFound)
+    })
+
+    before := metrics.HTTPRequests.Value("GET", "/rents/{id}", "404")
+    beforeUnmatched := metrics.HTTPRequests.Value("GET", "unmatched", "404")
+
+    mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/rents/1", nil))
+    mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/rents/2", nil))
+    mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+    if got := metrics.HTTPRequests.Value("GET", "/rents/{id}", "404") - before; got != 2 {
+        t.Errorf("expected 2 requests counted for the route pattern, got %v", got)
+    }
+    if got := metrics.HTTPRequests.Value("GET", "unmatched", "404") - beforeUnmatched; got != 1 {
+        t.Errorf("expected 1 unmatched request, got %v", got)
+    }
+    if metrics.HTTPDuration.Count("GET", "/rents/{id}") < 2 {
+        t.Error("expected latency of the route pattern to be observed")
+    }
+}
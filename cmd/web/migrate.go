@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/driver"
+	"github.com/sanijo/rent-app/internal/logging"
+	"github.com/sanijo/rent-app/internal/migrate"
+	"github.com/sanijo/rent-app/migrations"
+)
+
+// migrateUsage describes the migrate subcommand
+const migrateUsage = "usage: rent-app migrate [flags] up | down [version] | status"
+
+// newMigrator returns a migrator for the embedded migrations that logs every
+// migration it runs
+func newMigrator(db *driver.DB) *migrate.Migrator {
+    m := migrate.New(db.SQL, migrations.FS)
+    m.Log = func(direction string, mig migrate.Migration) {
+        app.Logger.Info("migrated "+direction, "version", mig.Version, "name", mig.Name)
+    }
+    return m
+}
+
+// parseMigrateArgs returns the migrate command and, for down, the version to
+// roll back to
+func parseMigrateArgs(args []string) (string, string, error) {
+    if len(args) == 0 {
+        return "", "", errors.New(migrateUsage)
+    }
+
+    switch {
+    case (args[0] == "up" || args[0] == "status") && len(args) == 1:
+        return args[0], "", nil
+    case args[0] == "down" && len(args) == 1:
+        return "down", "", nil
+    case args[0] == "down" && len(args) == 2:
+        return "down", args[1], nil
+    }
+
+    return "", "", errors.New(migrateUsage)
+}
+
+// runMigrate runs the migrate subcommand. up applies the pending migrations,
+// down rolls back the latest migration or all migrations newer than version,
+// and status lists the migrations.
+func runMigrate(args []string, out io.Writer) error {
+    err := config.Load(&app, args, os.Getenv)
+    if err != nil {
+        return err
+    }
+
+    command, version, err := parseMigrateArgs(app.Args)
+    if err != nil {
+        return err
+    }
+
+    app.Logger = logging.New(os.Stderr, app.LogFormat, app.LogLevel)
+
+    db, err := connectDB()
+    if err != nil {
+        return fmt.Errorf("cannot connect to database: %w", err)
+    }
+    defer db.SQL.Close()
+
+    m := newMigrator(db)
+
+    switch command {
+    case "up":
+        n, err := m.Up()
+        fmt.Fprintf(out, "Applied %d migrations\n", n)
+        return err
+    case "down":
+        if version == "" {
+            return m.Down()
+        }
+        n, err := m.DownTo(version)
+        fmt.Fprintf(out, "Rolled back %d migrations\n", n)
+        return err
+    }
+
+    status, err := m.Status()
+    if err != nil {
+        return err
+    }
+    for _, s := range status {
+        state := "pending"
+        if s.Applied {
+            state = "applied"
+        }
+        fmt.Fprintf(out, "%-8s %s %s\n", state, s.Version, s.Name)
+    }
+    return nil
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"github.com/sanijo/rent-app/internal/config"
 	"github.com/sanijo/rent-app/internal/handlers"
+	"github.com/sanijo/rent-app/internal/metrics"
+	"github.com/sanijo/rent-app/static"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -12,11 +14,19 @@ import (
 func routes(app *config.AppConfig) http.Handler {
     mux := chi.NewRouter()
 
+    mux.Use(RequestID)
+    mux.Use(AccessLog)
+    mux.Use(Metrics)
     mux.Use(middleware.Recoverer)
     // cross-site request forgery protection
     mux.Use(NoSurf) 
     mux.Use(SessionLoad)
 
+    // Health checks for the orchestrator
+    mux.Get("/healthz", handlers.Repo.Healthz)
+    mux.Get("/readyz", handlers.Repo.Readyz)
+    mux.Handle("/metrics", metrics.Default.Handler())
+
     mux.Get("/", handlers.Repo.Home)
     mux.Get("/model-3", handlers.Repo.Model3)
     mux.Get("/model-y", handlers.Repo.ModelY)
@@ -24,19 +34,72 @@ func routes(app *config.AppConfig) http.Handler {
     mux.Get("/check-availability", handlers.Repo.CheckAvailability)
     mux.Post("/check-availability", handlers.Repo.PostAvailability)
     mux.Post("/check-availability-json", handlers.Repo.PostAvailabilityJSON)
-    mux.Get("/choose-model/{id}", handlers.Repo.ChooseModel)
-    mux.Get("/rent-vehicle", handlers.Repo.RentVehicle)
+    // these hold a vehicle, so they are posted with a csrf token
+    mux.Post("/choose-model/{id}", handlers.Repo.ChooseModel)
+    mux.Post("/rent-vehicle", handlers.Repo.RentVehicle)
 
     mux.Get("/rent", handlers.Repo.Rent)
     mux.Post("/rent", handlers.Repo.PostRent)
     mux.Get("/rent-summary", handlers.Repo.RentSummary)
 
+    mux.Get("/payment", handlers.Repo.Payment)
+    // the fake checkout lets anyone mark a payment paid, never in production
+    if !app.InProduction {
+        mux.Post("/payment/fake/{intent}", handlers.Repo.FakeCheckout)
+    }
+    mux.Post("/payment/webhook", handlers.Repo.PaymentWebhook)
+
+    // Signed links where customers manage their bookings
+    mux.Get("/manage/{reference}", handlers.Repo.ManageBooking)
+    mux.Post("/manage/{reference}/dates", handlers.Repo.ManageChangeDates)
+    mux.Post("/manage/{reference}/cancel", handlers.Repo.ManageCancel)
+
     mux.Get("/about", handlers.Repo.About)
     mux.Get("/contact", handlers.Repo.Contact)
 
+    mux.Get("/user/login", handlers.Repo.ShowLogin)
+    mux.Post("/user/login", handlers.Repo.PostShowLogin)
+    mux.Post("/user/logout", handlers.Repo.Logout)
+
+    // Private calendar feeds, the url contains a token instead of a login
+    mux.Get("/calendar/{id}/{file}", handlers.Repo.ICalFeed)
+
+    // Versioned JSON API
+    mux.Route("/api/v1", func(mux chi.Router) {
+        mux.Get("/models", handlers.Repo.APIListModels)
+        mux.Get("/models/{id}", handlers.Repo.APIGetModel)
+        mux.Get("/availability", handlers.Repo.APIAvailability)
+        mux.Post("/bookings", handlers.Repo.APICreateBooking)
+        mux.Get("/bookings/{id}", handlers.Repo.APIGetBooking)
+    })
+
+    // Admin area, only for logged in users with admin access level
+    mux.Route("/admin", func(mux chi.Router) {
+        mux.Use(Auth)
+        mux.Use(Admin)
+
+        mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+        mux.Get("/rents-new", handlers.Repo.AdminNewRents)
+        mux.Get("/rents-all", handlers.Repo.AdminAllRents)
+        mux.Get("/rents/{src}/{id}", handlers.Repo.AdminShowRent)
+        mux.Post("/rents/{src}/{id}", handlers.Repo.AdminPostShowRent)
+        mux.Post("/process-rent/{src}/{id}", handlers.Repo.AdminProcessRent)
+        mux.Post("/rent-status/{src}/{id}", handlers.Repo.AdminRentStatus)
+        mux.Post("/delete-rent/{src}/{id}", handlers.Repo.AdminDeleteRent)
+
+        mux.Get("/calendar", handlers.Repo.AdminCalendar)
+        mux.Post("/calendar", handlers.Repo.AdminPostCalendar)
+        mux.Get("/ical", handlers.Repo.AdminICal)
+        mux.Post("/ical", handlers.Repo.AdminPostICal)
+    })
+
     // In static folder are all things that are not html template such as JS,
     // figures
-    filesServer := http.FileServer(http.Dir("./static/"))
+    staticFS := app.StaticFS
+    if staticFS == nil {
+        staticFS = static.FS
+    }
+    filesServer := http.FileServer(http.FS(staticFS))
     mux.Handle("/static/*", http.StripPrefix("/static", filesServer))
 
     return mux
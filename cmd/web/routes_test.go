@@ -20,3 +20,43 @@ func TestRoutes(t *testing.T) {
 		t.Errorf("routes() = %T, want %T", got, want)
 	}
 }
+
+// TestHoldRoutes tests that the routes holding a vehicle, and logout, can't
+// be requested with GET, e.g. by crawlers, link prefetching or other sites
+func TestHoldRoutes(t *testing.T) {
+	app := config.AppConfig{}
+
+	router := routes(&app).(*chi.Mux)
+
+	for _, path := range []string{"/choose-model/1", "/rent-vehicle", "/user/logout"} {
+		if router.Match(chi.NewRouteContext(), "GET", path) {
+			t.Errorf("expected no GET route for %s", path)
+		}
+		if !router.Match(chi.NewRouteContext(), "POST", path) {
+			t.Errorf("expected a POST route for %s", path)
+		}
+	}
+}
+
+// TestFakeCheckoutRoute tests that the fake checkout is only served outside
+// production
+func TestFakeCheckoutRoute(t *testing.T) {
+	tests := []struct {
+		name         string
+		inProduction bool
+		expected     bool
+	}{
+		{"development", false, true},
+		{"production", true, false},
+	}
+
+	for _, e := range tests {
+		app := config.AppConfig{InProduction: e.inProduction}
+
+		router := routes(&app).(*chi.Mux)
+
+		if got := router.Match(chi.NewRouteContext(), "POST", "/payment/fake/pi_1"); got != e.expected {
+			t.Errorf("for %s, expected route %v, got %v", e.name, e.expected, got)
+		}
+	}
+}
@@ -1,18 +1,123 @@
 package config
 
 import (
+	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/rules"
 )
 
 // AppConfig holds the application config
 type AppConfig struct {
     UseCache bool
     TemplateCache map[string]*template.Template
-    InfoLog *log.Logger
-    ErrorLog *log.Logger
+    // Logger is the structured application logger
+    Logger *slog.Logger
+    // LogFormat is text or json
+    LogFormat string
+    LogLevel slog.Level
     InProduction bool
     Session *scs.SessionManager
+    MailChan chan models.MailData
+    Addr string
+    // BaseURL is the public url of the app, used for links in emails
+    BaseURL string
+    SessionLifetime time.Duration
+    // Migrate applies pending migrations on startup
+    Migrate bool
+    // Args are the command-line arguments left after the flags
+    Args []string
+    // ShutdownTimeout is how long in-flight requests and background workers
+    // get to finish on shutdown
+    ShutdownTimeout time.Duration
+    // HoldDuration is how long a vehicle is held for a customer filling in
+    // the rent form
+    HoldDuration time.Duration
+    // PaymentTimeout is how long a pending rent blocks its vehicle while it
+    // waits for the payment, it is cancelled afterwards
+    PaymentTimeout time.Duration
+    // Booking are the global booking rules, models may set their own rental
+    // length limits
+    Booking rules.Rules
+    DB DBConfig
+    Mail MailConfig
+    // SecretKey signs private urls, e.g. calendar feeds, and the webhooks of
+    // the fake payment provider
+    SecretKey string
+    // PaymentProvider is the payment service provider, only "fake" so far
+    PaymentProvider string
+    // ICalHosts are the hosts calendars may be imported from by url, without
+    // any only uploaded calendars are imported
+    ICalHosts []string
+    // AssetsDir is a directory with templates and static subdirectories that
+    // are used instead of the files embedded into the binary
+    AssetsDir string
+    // TemplateFS and StaticFS are where templates and static files are read
+    // from
+    TemplateFS fs.FS
+    StaticFS fs.FS
+}
+
+// DBConfig holds the database connection settings
+type DBConfig struct {
+    Host string
+    Port int
+    Name string
+    User string
+    Password string
+    SSLMode string
+    // URL is a postgres:// connection url, used instead of the fields above
+    // when set
+    URL string
+    // ConnectTimeout is how long to keep retrying to connect on startup, zero
+    // means a single attempt
+    ConnectTimeout time.Duration
+}
+
+// DSN returns the connection string for the database
+func (d DBConfig) DSN() string {
+    if d.URL != "" {
+        return d.URL
+    }
+
+    dsn := fmt.Sprintf("host=%s port=%d dbname=%s user=%s sslmode=%s",
+        dsnValue(d.Host), d.Port, dsnValue(d.Name), dsnValue(d.User), dsnValue(d.SSLMode))
+    if d.Password != "" {
+        dsn += fmt.Sprintf(" password=%s", dsnValue(d.Password))
+    }
+
+    return dsn
+}
+
+// dsnValue quotes v for a key=value connection string when it is empty or
+// contains spaces, quotes or backslashes, escaping quotes and backslashes the
+// way libpq expects
+func dsnValue(v string) string {
+    if v != "" && !strings.ContainsAny(v, " \t\n\r\v\f'\\") {
+        return v
+    }
+
+    r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+    return "'" + r.Replace(v) + "'"
+}
+
+// MailConfig holds the mail settings
+type MailConfig struct {
+    // Transport is either "smtp" or "file"
+    Transport string
+    SMTPHost string
+    SMTPPort int
+    SMTPUsername string
+    SMTPPassword string
+    // Dir is where the file transport writes messages
+    Dir string
+    From string
+    OwnerEmail string
 }
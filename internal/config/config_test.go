@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestDBConfig_DSN(t *testing.T) {
+    var tests = []struct {
+        name string
+        password string
+        want string
+    }{
+        {"plain", "secret", "host=db port=5432 dbname=rent user=rent sslmode=disable password=secret"},
+        {"space", "my secret", "host=db port=5432 dbname=rent user=rent sslmode=disable password='my secret'"},
+        {"quote", "it's", `host=db port=5432 dbname=rent user=rent sslmode=disable password='it\'s'`},
+        {"backslash", `a\b`, `host=db port=5432 dbname=rent user=rent sslmode=disable password='a\\b'`},
+        {"injection", "x sslmode=disable", "host=db port=5432 dbname=rent user=rent sslmode=disable password='x sslmode=disable'"},
+        {"none", "", "host=db port=5432 dbname=rent user=rent sslmode=disable"},
+    }
+
+    for _, e := range tests {
+        d := DBConfig{Host: "db", Port: 5432, Name: "rent", User: "rent", Password: e.password, SSLMode: "disable"}
+        if got := d.DSN(); got != e.want {
+            t.Errorf("%s: expected dsn %q, got %q", e.name, e.want, got)
+        }
+    }
+}
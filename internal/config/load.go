@@ -0,0 +1,518 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/rules"
+)
+
+// setting is a single configuration value that can be set from database.yml,
+// an environment variable or a command-line flag
+type setting struct {
+    flag string
+    env string
+    usage string
+    isBool bool
+    apply func(a *AppConfig, value string) error
+}
+
+// settings lists every configuration value. Flags take precedence over
+// environment variables, which take precedence over database.yml.
+var settings = []setting{
+    {"addr", "RENT_ADDR", "listen address", false, func(a *AppConfig, v string) error {
+        a.Addr = v
+        return nil
+    }},
+    {"base-url", "RENT_BASE_URL", "public url of the app used in links sent by email", false, func(a *AppConfig, v string) error {
+        a.BaseURL = strings.TrimSuffix(v, "/")
+        return nil
+    }},
+    {"production", "RENT_PRODUCTION", "run in production mode", true, func(a *AppConfig, v string) (err error) {
+        a.InProduction, err = strconv.ParseBool(v)
+        return err
+    }},
+    {"cache", "RENT_USE_CACHE", "cache parsed templates", true, func(a *AppConfig, v string) (err error) {
+        a.UseCache, err = strconv.ParseBool(v)
+        return err
+    }},
+    {"log-format", "RENT_LOG_FORMAT", "log format, text or json", false, func(a *AppConfig, v string) error {
+        a.LogFormat = v
+        return nil
+    }},
+    {"log-level", "RENT_LOG_LEVEL", "minimum log level, debug, info, warn or error", false, func(a *AppConfig, v string) error {
+        return a.LogLevel.UnmarshalText([]byte(v))
+    }},
+    {"migrate", "RENT_MIGRATE", "apply pending database migrations on startup", true, func(a *AppConfig, v string) (err error) {
+        a.Migrate, err = strconv.ParseBool(v)
+        return err
+    }},
+    {"session-lifetime", "RENT_SESSION_LIFETIME", "session lifetime, e.g. 24h", false, func(a *AppConfig, v string) (err error) {
+        a.SessionLifetime, err = time.ParseDuration(v)
+        return err
+    }},
+    {"shutdown-timeout", "RENT_SHUTDOWN_TIMEOUT", "time to drain requests and background work on shutdown, e.g. 15s", false, func(a *AppConfig, v string) (err error) {
+        a.ShutdownTimeout, err = time.ParseDuration(v)
+        return err
+    }},
+    {"hold-duration", "RENT_HOLD_DURATION", "how long a vehicle is held while the rent form is filled in, e.g. 15m", false, func(a *AppConfig, v string) (err error) {
+        a.HoldDuration, err = time.ParseDuration(v)
+        return err
+    }},
+    {"payment-timeout", "RENT_PAYMENT_TIMEOUT", "how long an unpaid rent blocks its vehicle before it is cancelled, e.g. 1h", false, func(a *AppConfig, v string) (err error) {
+        a.PaymentTimeout, err = time.ParseDuration(v)
+        return err
+    }},
+    {"min-days", "RENT_MIN_DAYS", "minimum rental length in days, models may override it", false, func(a *AppConfig, v string) (err error) {
+        a.Booking.MinDays, err = strconv.Atoi(v)
+        return err
+    }},
+    {"max-days", "RENT_MAX_DAYS", "maximum rental length in days, 0 for no limit, models may override it", false, func(a *AppConfig, v string) (err error) {
+        a.Booking.MaxDays, err = strconv.Atoi(v)
+        return err
+    }},
+    {"lead-time", "RENT_LEAD_TIME", "how long before the pick-up day rentals have to be booked, e.g. 24h", false, func(a *AppConfig, v string) (err error) {
+        a.Booking.LeadTime, err = time.ParseDuration(v)
+        return err
+    }},
+    {"booking-horizon", "RENT_BOOKING_HORIZON", "how far in advance rentals can be booked, 0 for no limit, e.g. 8760h", false, func(a *AppConfig, v string) (err error) {
+        a.Booking.Horizon, err = time.ParseDuration(v)
+        return err
+    }},
+    {"pickup-days", "RENT_PICKUP_DAYS", "weekdays on which vehicles are picked up, e.g. mon,tue,fri, empty for every day", false, func(a *AppConfig, v string) (err error) {
+        a.Booking.PickupDays, err = rules.ParseWeekdays(v)
+        return err
+    }},
+    {"blackouts", "RENT_BLACKOUTS", "days without rentals, e.g. 2050-12-24..2050-12-26,2051-01-01", false, func(a *AppConfig, v string) (err error) {
+        a.Booking.Blackouts, err = rules.ParseBlackouts(v)
+        return err
+    }},
+    {"dbhost", "RENT_DB_HOST", "database host", false, func(a *AppConfig, v string) error {
+        a.DB.Host = v
+        return nil
+    }},
+    {"dbport", "RENT_DB_PORT", "database port", false, func(a *AppConfig, v string) (err error) {
+        a.DB.Port, err = strconv.Atoi(v)
+        return err
+    }},
+    {"dbname", "RENT_DB_NAME", "database name", false, func(a *AppConfig, v string) error {
+        a.DB.Name = v
+        return nil
+    }},
+    {"dbuser", "RENT_DB_USER", "database user", false, func(a *AppConfig, v string) error {
+        a.DB.User = v
+        return nil
+    }},
+    {"dbpass", "RENT_DB_PASSWORD", "database password", false, func(a *AppConfig, v string) error {
+        a.DB.Password = v
+        return nil
+    }},
+    {"dbssl", "RENT_DB_SSLMODE", "database ssl mode", false, func(a *AppConfig, v string) error {
+        a.DB.SSLMode = v
+        return nil
+    }},
+    {"dburl", "DATABASE_URL", "database url, overrides the other database settings", false, func(a *AppConfig, v string) error {
+        a.DB.URL = v
+        return nil
+    }},
+    {"db-connect-timeout", "RENT_DB_CONNECT_TIMEOUT", "keep retrying to connect to the database on startup for this long, e.g. 1m", false, func(a *AppConfig, v string) (err error) {
+        a.DB.ConnectTimeout, err = time.ParseDuration(v)
+        return err
+    }},
+    {"mail-transport", "RENT_MAIL_TRANSPORT", "mail transport, smtp or file", false, func(a *AppConfig, v string) error {
+        a.Mail.Transport = v
+        return nil
+    }},
+    {"smtp-host", "RENT_SMTP_HOST", "smtp host", false, func(a *AppConfig, v string) error {
+        a.Mail.SMTPHost = v
+        return nil
+    }},
+    {"smtp-port", "RENT_SMTP_PORT", "smtp port", false, func(a *AppConfig, v string) (err error) {
+        a.Mail.SMTPPort, err = strconv.Atoi(v)
+        return err
+    }},
+    {"smtp-user", "RENT_SMTP_USER", "smtp username", false, func(a *AppConfig, v string) error {
+        a.Mail.SMTPUsername = v
+        return nil
+    }},
+    {"smtp-pass", "RENT_SMTP_PASSWORD", "smtp password", false, func(a *AppConfig, v string) error {
+        a.Mail.SMTPPassword = v
+        return nil
+    }},
+    {"mail-dir", "RENT_MAIL_DIR", "directory the file mail transport writes to", false, func(a *AppConfig, v string) error {
+        a.Mail.Dir = v
+        return nil
+    }},
+    {"mail-from", "RENT_MAIL_FROM", "sender address of emails", false, func(a *AppConfig, v string) error {
+        a.Mail.From = v
+        return nil
+    }},
+    {"owner-email", "RENT_OWNER_EMAIL", "address notified about new rents", false, func(a *AppConfig, v string) error {
+        a.Mail.OwnerEmail = v
+        return nil
+    }},
+    {"secret", "RENT_SECRET", "secret key used to sign private urls", false, func(a *AppConfig, v string) error {
+        a.SecretKey = v
+        return nil
+    }},
+    {"payment-provider", "RENT_PAYMENT_PROVIDER", "payment provider, fake", false, func(a *AppConfig, v string) error {
+        a.PaymentProvider = v
+        return nil
+    }},
+    {"ical-hosts", "RENT_ICAL_HOSTS", "hosts calendars may be imported from by url, e.g. www.airbnb.com,www.booking.com", false, func(a *AppConfig, v string) error {
+        a.ICalHosts = nil
+        for _, host := range strings.Split(v, ",") {
+            if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+                a.ICalHosts = append(a.ICalHosts, host)
+            }
+        }
+        return nil
+    }},
+    {"assets-dir", "RENT_ASSETS_DIR", "load templates and static files from this directory instead of the binary, e.g. . for live reload", false, func(a *AppConfig, v string) error {
+        a.AssetsDir = v
+        return nil
+    }},
+}
+
+// defaultSecretKey is only good enough for local development
+const defaultSecretKey = "insecure-development-secret"
+
+// rawValue records the raw value of a command-line flag, so that flags can be
+// applied after database.yml and environment variables
+type rawValue struct {
+    value string
+    set bool
+    isBool bool
+}
+
+func (v *rawValue) String() string { return v.value }
+
+func (v *rawValue) Set(s string) error {
+    v.value = s
+    v.set = true
+    return nil
+}
+
+func (v *rawValue) IsBoolFlag() bool { return v.isBool }
+
+// SetDefaults sets the default configuration used for local development
+func SetDefaults(a *AppConfig) {
+    a.Addr = ":8080"
+    a.BaseURL = "http://localhost:8080"
+    a.InProduction = false
+    a.UseCache = false
+    a.SessionLifetime = 24 * time.Hour
+    a.LogFormat = "text"
+    a.LogLevel = slog.LevelInfo
+    a.ShutdownTimeout = 15 * time.Second
+    a.HoldDuration = 15 * time.Minute
+    a.PaymentTimeout = time.Hour
+    a.Booking = rules.Rules{
+        MinDays: 1,
+        MaxDays: 30,
+        Horizon: 365 * 24 * time.Hour,
+    }
+    a.DB = DBConfig{
+        Host: "localhost",
+        Port: 5432,
+        Name: "rent-app",
+        User: "postgres",
+        SSLMode: "disable",
+    }
+    a.Mail = MailConfig{
+        Transport: "file",
+        SMTPHost: "localhost",
+        SMTPPort: 1025,
+        Dir: "./tmp/mail",
+        From: "rent@erent.com",
+        OwnerEmail: "owner@erent.com",
+    }
+    a.SecretKey = defaultSecretKey
+    a.PaymentProvider = "fake"
+}
+
+// Load fills a with defaults, then database.yml (if given with -dbconfig or
+// RENT_DB_CONFIG), environment variables read with getenv and finally
+// command-line args, and validates the result.
+func Load(a *AppConfig, args []string, getenv func(string) string) error {
+    SetDefaults(a)
+
+    fs := flag.NewFlagSet("rent-app", flag.ContinueOnError)
+
+    dbConfig := fs.String("dbconfig", getenv("RENT_DB_CONFIG"), "path to database.yml")
+    env := fs.String("env", "", "database.yml section to use (default development)")
+
+    flags := make([]*rawValue, len(settings))
+    for i, s := range settings {
+        flags[i] = &rawValue{isBool: s.isBool}
+        fs.Var(flags[i], s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+    }
+
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    a.Args = fs.Args()
+
+    if *env == "" {
+        *env = getenv("RENT_ENV")
+    }
+    if *env == "" {
+        *env = "development"
+    }
+
+    if *dbConfig != "" {
+        if err := loadDatabaseYML(a, *dbConfig, *env, getenv); err != nil {
+            return err
+        }
+    }
+
+    for _, s := range settings {
+        v := getenv(s.env)
+        if v == "" {
+            continue
+        }
+        if err := s.apply(a, v); err != nil {
+            return fmt.Errorf("invalid %s %q: %w", s.env, v, err)
+        }
+    }
+
+    for i, s := range settings {
+        if !flags[i].set {
+            continue
+        }
+        if err := s.apply(a, flags[i].value); err != nil {
+            return fmt.Errorf("invalid -%s %q: %w", s.flag, flags[i].value, err)
+        }
+    }
+
+    return Validate(a)
+}
+
+// loadDatabaseYML applies the env section of a soda database.yml file. The
+// file is executed as a template first, so envOr works as in soda.
+func loadDatabaseYML(a *AppConfig, path, env string, getenv func(string) string) error {
+    content, err := os.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("cannot read database config: %w", err)
+    }
+
+    t, err := template.New("database.yml").Funcs(template.FuncMap{
+        "envOr": func(key, def string) string {
+            if v := getenv(key); v != "" {
+                return v
+            }
+            return def
+        },
+        "env": getenv,
+    }).Parse(string(content))
+    if err != nil {
+        return fmt.Errorf("cannot parse %s: %w", path, err)
+    }
+
+    buffer := new(bytes.Buffer)
+    if err = t.Execute(buffer, nil); err != nil {
+        return fmt.Errorf("cannot parse %s: %w", path, err)
+    }
+
+    section, err := parseYMLSection(buffer.String(), env)
+    if err != nil {
+        return fmt.Errorf("cannot parse %s: %w", path, err)
+    }
+
+    for key, value := range section {
+        // empty values such as "user: " keep the current setting
+        if value == "" {
+            continue
+        }
+
+        switch key {
+        case "host":
+            a.DB.Host = value
+        case "port":
+            if a.DB.Port, err = strconv.Atoi(value); err != nil {
+                return fmt.Errorf("invalid port %q in %s: %w", value, path, err)
+            }
+        case "database":
+            a.DB.Name = value
+        case "user":
+            a.DB.User = value
+        case "password":
+            a.DB.Password = value
+        case "sslmode":
+            a.DB.SSLMode = value
+        case "url":
+            a.DB.URL = value
+        }
+    }
+
+    return nil
+}
+
+// parseYMLSection returns the key value pairs nested under env in the two
+// level yaml used by database.yml
+func parseYMLSection(content, env string) (map[string]string, error) {
+    section := make(map[string]string)
+    found := false
+    inSection := false
+
+    scanner := bufio.NewScanner(strings.NewReader(content))
+    for scanner.Scan() {
+        line := scanner.Text()
+        trimmed := strings.TrimSpace(line)
+        if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+            continue
+        }
+
+        // top level keys start a new section
+        if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+            inSection = strings.TrimSuffix(trimmed, ":") == env
+            found = found || inSection
+            continue
+        }
+
+        if !inSection {
+            continue
+        }
+
+        key, value, ok := strings.Cut(trimmed, ":")
+        if !ok {
+            return nil, fmt.Errorf("invalid line %q", trimmed)
+        }
+        section[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+    }
+
+    if !found {
+        return nil, fmt.Errorf("no %q section", env)
+    }
+
+    return section, scanner.Err()
+}
+
+// Validate checks the configuration and returns all problems found
+func Validate(a *AppConfig) error {
+    var errs []error
+
+    if _, _, err := net.SplitHostPort(a.Addr); err != nil {
+        errs = append(errs, fmt.Errorf("invalid listen address %q: %w", a.Addr, err))
+    }
+
+    if u, err := url.Parse(a.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        errs = append(errs, fmt.Errorf("invalid base url %q, expected e.g. https://rent.example.com", a.BaseURL))
+    }
+
+    if a.LogFormat != "text" && a.LogFormat != "json" {
+        errs = append(errs, fmt.Errorf("log format must be text or json, got %q", a.LogFormat))
+    }
+
+    if a.SessionLifetime <= 0 {
+        errs = append(errs, fmt.Errorf("session lifetime must be positive, got %s", a.SessionLifetime))
+    }
+
+    if a.ShutdownTimeout <= 0 {
+        errs = append(errs, fmt.Errorf("shutdown timeout must be positive, got %s", a.ShutdownTimeout))
+    }
+
+    if a.HoldDuration <= 0 {
+        errs = append(errs, fmt.Errorf("hold duration must be positive, got %s", a.HoldDuration))
+    }
+
+    if a.PaymentTimeout <= 0 {
+        errs = append(errs, fmt.Errorf("payment timeout must be positive, got %s", a.PaymentTimeout))
+    }
+
+    if a.Booking.MinDays < 1 {
+        errs = append(errs, fmt.Errorf("minimum rental days must be at least 1, got %d", a.Booking.MinDays))
+    }
+
+    if a.Booking.MaxDays < 0 || (a.Booking.MaxDays > 0 && a.Booking.MaxDays < a.Booking.MinDays) {
+        errs = append(errs, fmt.Errorf("maximum rental days must be 0 or at least %d, got %d", a.Booking.MinDays, a.Booking.MaxDays))
+    }
+
+    if a.Booking.LeadTime < 0 {
+        errs = append(errs, fmt.Errorf("lead time can't be negative, got %s", a.Booking.LeadTime))
+    }
+
+    if a.Booking.Horizon < 0 || (a.Booking.Horizon > 0 && a.Booking.Horizon <= a.Booking.LeadTime) {
+        errs = append(errs, fmt.Errorf("booking horizon must be 0 or longer than the lead time, got %s", a.Booking.Horizon))
+    }
+
+    if a.DB.ConnectTimeout < 0 {
+        errs = append(errs, fmt.Errorf("database connect timeout can't be negative, got %s", a.DB.ConnectTimeout))
+    }
+
+    if a.DB.URL == "" {
+        if a.DB.Host == "" {
+            errs = append(errs, errors.New("database host is required"))
+        }
+        if a.DB.Name == "" {
+            errs = append(errs, errors.New("database name is required"))
+        }
+        if a.DB.User == "" {
+            errs = append(errs, errors.New("database user is required"))
+        }
+        if a.DB.Port < 1 || a.DB.Port > 65535 {
+            errs = append(errs, fmt.Errorf("invalid database port %d", a.DB.Port))
+        }
+    } else if !strings.HasPrefix(a.DB.URL, "postgres://") && !strings.HasPrefix(a.DB.URL, "postgresql://") {
+        errs = append(errs, errors.New("database url must start with postgres://"))
+    }
+
+    switch a.Mail.Transport {
+    case "smtp":
+        if a.Mail.SMTPHost == "" {
+            errs = append(errs, errors.New("smtp host is required for the smtp mail transport"))
+        }
+        if a.Mail.SMTPPort < 1 || a.Mail.SMTPPort > 65535 {
+            errs = append(errs, fmt.Errorf("invalid smtp port %d", a.Mail.SMTPPort))
+        }
+    case "file":
+        if a.Mail.Dir == "" {
+            errs = append(errs, errors.New("mail directory is required for the file mail transport"))
+        }
+    default:
+        errs = append(errs, fmt.Errorf("unknown mail transport %q, use smtp or file", a.Mail.Transport))
+    }
+
+    if _, err := mail.ParseAddress(a.Mail.From); err != nil {
+        errs = append(errs, fmt.Errorf("invalid mail from address %q: %w", a.Mail.From, err))
+    }
+    if _, err := mail.ParseAddress(a.Mail.OwnerEmail); err != nil {
+        errs = append(errs, fmt.Errorf("invalid owner email %q: %w", a.Mail.OwnerEmail, err))
+    }
+
+    if a.PaymentProvider != "fake" {
+        errs = append(errs, fmt.Errorf("unknown payment provider %q, use fake", a.PaymentProvider))
+    } else if a.InProduction {
+        // anyone can mark their own booking paid with the fake checkout
+        errs = append(errs, errors.New("the fake payment provider can't be used in production"))
+    }
+
+    if a.AssetsDir != "" {
+        for _, sub := range []string{"templates", "static"} {
+            if info, err := os.Stat(filepath.Join(a.AssetsDir, sub)); err != nil || !info.IsDir() {
+                errs = append(errs, fmt.Errorf("assets directory %q has no %s directory", a.AssetsDir, sub))
+            }
+        }
+    }
+
+    if len(a.SecretKey) < 16 {
+        errs = append(errs, errors.New("secret key must be at least 16 characters"))
+    } else if a.InProduction && a.SecretKey == defaultSecretKey {
+        errs = append(errs, errors.New("secret key must be set in production"))
+    }
+
+    return errors.Join(errs...)
+}
@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -54,7 +55,7 @@ func NewDatabase(dsn string) (*sql.DB, error) {
 func ConnectSQL(dsn string) (*DB, error) {
     db, err := NewDatabase(dsn)
     if err != nil {
-        panic(err)
+        return nil, err
     }
 
     db.SetMaxOpenConns(maxOpenDbConn)
@@ -70,3 +71,41 @@ func ConnectSQL(dsn string) (*DB, error) {
     return dbConn, nil
 }
 
+
+// minRetryWait and maxRetryWait bound the wait between connection attempts,
+// which doubles after every failed attempt.
+const (
+    minRetryWait = 500 * time.Millisecond
+    maxRetryWait = 10 * time.Second
+)
+
+// ConnectSQLWithRetry calls ConnectSQL until it succeeds or ctx is done,
+// waiting longer after every failed attempt. onRetry, if not nil, is called
+// with the error and the wait before the next attempt.
+func ConnectSQLWithRetry(ctx context.Context, dsn string, onRetry func(err error, wait time.Duration)) (*DB, error) {
+    wait := minRetryWait
+    for {
+        db, err := ConnectSQL(dsn)
+        if err == nil {
+            return db, nil
+        }
+
+        if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+            return nil, err
+        }
+        if onRetry != nil {
+            onRetry(err, wait)
+        }
+
+        select {
+        case <-ctx.Done():
+            return nil, err
+        case <-time.After(wait):
+        }
+
+        wait *= 2
+        if wait > maxRetryWait {
+            wait = maxRetryWait
+        }
+    }
+}
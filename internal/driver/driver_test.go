@@ -0,0 +1,35 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// unreachableDSN points to a port nothing listens on
+const unreachableDSN = "host=127.0.0.1 port=1 dbname=rent-app user=postgres sslmode=disable connect_timeout=1"
+
+func TestConnectSQL(t *testing.T) {
+    _, err := ConnectSQL(unreachableDSN)
+    if err == nil {
+        t.Error("expected an error for an unreachable database, but got nil")
+    }
+}
+
+func TestConnectSQLWithRetry(t *testing.T) {
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+
+    var waits []time.Duration
+    _, err := ConnectSQLWithRetry(ctx, unreachableDSN, func(err error, wait time.Duration) {
+        waits = append(waits, wait)
+    })
+    if err == nil {
+        t.Fatal("expected an error for an unreachable database, but got nil")
+    }
+
+    // 500ms and 1s fit into 2s, the next wait doesn't
+    if len(waits) != 2 || waits[0] != minRetryWait || waits[1] != 2*minRetryWait {
+        t.Errorf("expected waits of 500ms and 1s, got %v", waits)
+    }
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/forms"
+	"github.com/sanijo/rent-app/internal/metrics"
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/repository"
+)
+
+// dateLayout is the date format used by the API, e.g. 2050-01-02
+const dateLayout = "2006-01-02"
+
+// maxBodyBytes limits the size of JSON request bodies
+const maxBodyBytes = 1 << 20
+
+// apiEnvelope wraps every API response. Exactly one of Data and Error is set.
+type apiEnvelope struct {
+    Data interface{} `json:"data,omitempty"`
+    Error *apiError `json:"error,omitempty"`
+}
+
+// apiError describes why a request failed
+type apiError struct {
+    Status int `json:"status"`
+    Message string `json:"message"`
+    Fields map[string]string `json:"fields,omitempty"`
+}
+
+// apiModel is the API representation of a model
+type apiModel struct {
+    ID int `json:"id"`
+    Name string `json:"name"`
+    FreeUnits int `json:"free_units,omitempty"`
+}
+
+// apiAvailability is the API representation of an availability check for a
+// single model
+type apiAvailability struct {
+    ModelID int `json:"model_id"`
+    StartDate string `json:"start_date"`
+    EndDate string `json:"end_date"`
+    Available bool `json:"available"`
+    FreeUnits int `json:"free_units"`
+}
+
+// apiBooking is the API representation of a rent
+type apiBooking struct {
+    ID int `json:"id"`
+    ModelID int `json:"model_id"`
+    ModelName string `json:"model_name,omitempty"`
+    StartDate string `json:"start_date"`
+    EndDate string `json:"end_date"`
+    FirstName string `json:"first_name"`
+    LastName string `json:"last_name"`
+    Email string `json:"email"`
+    Phone string `json:"phone"`
+    TotalPriceCents models.Money `json:"total_price_cents"`
+    // Status is pending until the booking is paid at PaymentURL
+    Status string `json:"status"`
+    PaymentURL string `json:"payment_url,omitempty"`
+    // Reference is the booking code, ManageURL the signed link where the
+    // customer can change or cancel the booking
+    Reference string `json:"reference,omitempty"`
+    ManageURL string `json:"manage_url,omitempty"`
+}
+
+// newAPIModel converts a model to its API representation
+func newAPIModel(model models.Model) apiModel {
+    return apiModel{
+        ID: model.ID,
+        Name: model.ModelName,
+        FreeUnits: model.FreeUnits,
+    }
+}
+
+// newAPIBooking converts a rent to its API representation
+func newAPIBooking(rent models.Rent) apiBooking {
+    return apiBooking{
+        ID: rent.ID,
+        ModelID: rent.ModelID,
+        ModelName: rent.Model.ModelName,
+        StartDate: rent.StartDate.Format(dateLayout),
+        EndDate: rent.EndDate.Format(dateLayout),
+        FirstName: rent.FirstName,
+        LastName: rent.LastName,
+        Email: rent.Email,
+        Phone: rent.Phone,
+        TotalPriceCents: rent.TotalPrice,
+        Status: rent.Status,
+        Reference: rent.Reference,
+    }
+}
+
+// writeJSON writes data wrapped in the API envelope with the given status
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+    out, err := json.MarshalIndent(apiEnvelope{Data: data}, "", "    ")
+    if err != nil {
+        writeJSONError(w, http.StatusInternalServerError, "Can't encode response")
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    w.Write(out)
+}
+
+// writeJSONError writes an error wrapped in the API envelope
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+    writeJSONFieldErrors(w, status, message, nil)
+}
+
+// writeJSONFieldErrors writes an error with per field messages wrapped in the
+// API envelope
+func writeJSONFieldErrors(w http.ResponseWriter, status int, message string, fields map[string]string) {
+    out, _ := json.MarshalIndent(apiEnvelope{Error: &apiError{
+        Status: status,
+        Message: message,
+        Fields: fields,
+    }}, "", "    ")
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    w.Write(out)
+}
+
+// parseDateRange parses start and end dates in dateLayout and checks that end
+// is after start
+func parseDateRange(start, end string) (time.Time, time.Time, error) {
+    if start == "" || end == "" {
+        return time.Time{}, time.Time{}, errors.New("start and end dates are required")
+    }
+
+    startDate, err := time.Parse(dateLayout, start)
+    if err != nil {
+        return time.Time{}, time.Time{}, fmt.Errorf("invalid start date %q, use YYYY-MM-DD", start)
+    }
+
+    endDate, err := time.Parse(dateLayout, end)
+    if err != nil {
+        return time.Time{}, time.Time{}, fmt.Errorf("invalid end date %q, use YYYY-MM-DD", end)
+    }
+
+    if !endDate.After(startDate) {
+        return time.Time{}, time.Time{}, errors.New("end date must be after start date")
+    }
+
+    return startDate, endDate, nil
+}
+
+// apiPathID returns the id at the end of urls of the form
+// /api/v1/<resource>/{id}
+func apiPathID(r *http.Request) (int, error) {
+    exploded := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+    if len(exploded) != 5 {
+        return 0, errors.New("missing id")
+    }
+
+    return strconv.Atoi(exploded[4])
+}
+
+// APIListModels returns all models
+func (m *Repository) APIListModels(w http.ResponseWriter, r *http.Request) {
+    carModels, err := m.DB.AllModels()
+    if err != nil {
+        writeJSONError(w, http.StatusInternalServerError, "Error querying database")
+        return
+    }
+
+    out := make([]apiModel, 0, len(carModels))
+    for _, model := range carModels {
+        out = append(out, newAPIModel(model))
+    }
+
+    writeJSON(w, http.StatusOK, out)
+}
+
+// APIGetModel returns a single model
+func (m *Repository) APIGetModel(w http.ResponseWriter, r *http.Request) {
+    id, err := apiPathID(r)
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, "Invalid model id")
+        return
+    }
+
+    model, err := m.DB.GetModelByID(id)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeJSONError(w, http.StatusNotFound, "Model not found")
+        return
+    }
+    if err != nil {
+        writeJSONError(w, http.StatusInternalServerError, "Error querying database")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, newAPIModel(model))
+}
+
+// APIAvailability returns the models available between start and end, or
+// whether a single model is available if model_id is given
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+
+    startDate, endDate, err := parseDateRange(query.Get("start"), query.Get("end"))
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    // the rental length limits of a model are only checked if one is given
+    var model models.Model
+    if query.Get("model_id") != "" {
+        modelID, err := strconv.Atoi(query.Get("model_id"))
+        if err != nil {
+            writeJSONError(w, http.StatusBadRequest, "Invalid model id")
+            return
+        }
+
+        model, err = m.DB.GetModelByID(modelID)
+        if errors.Is(err, sql.ErrNoRows) {
+            writeJSONError(w, http.StatusNotFound, "Model not found")
+            return
+        }
+        if err != nil {
+            writeJSONError(w, http.StatusInternalServerError, "Error querying database")
+            return
+        }
+    }
+
+    violations := m.checkRules(model, startDate, endDate)
+    if len(violations) > 0 {
+        writeJSONFieldErrors(w, http.StatusUnprocessableEntity, "Dates break the booking rules", violationFields(violations, ""))
+        return
+    }
+
+    if model.ID != 0 {
+        freeUnits, err := m.DB.SearchAvailabilityByDatesAndModelID(startDate, endDate, model.ID)
+        if err != nil {
+            writeJSONError(w, http.StatusInternalServerError, "Error querying database")
+            return
+        }
+        metrics.AvailabilitySearches.Inc("api")
+        if freeUnits == 0 {
+            metrics.EmptySearches.Inc("api")
+        }
+
+        writeJSON(w, http.StatusOK, apiAvailability{
+            ModelID: model.ID,
+            StartDate: startDate.Format(dateLayout),
+            EndDate: endDate.Format(dateLayout),
+            Available: freeUnits > 0,
+            FreeUnits: freeUnits,
+        })
+        return
+    }
+
+    carModels, err := m.DB.SearchAvailabilityForAllModels(startDate, endDate)
+    if err != nil {
+        writeJSONError(w, http.StatusInternalServerError, "Error querying database")
+        return
+    }
+    metrics.AvailabilitySearches.Inc("api")
+
+    // models with their own rental length limits may not be bookable
+    carModels = m.bookableModels(carModels, startDate, endDate)
+    if len(carModels) == 0 {
+        metrics.EmptySearches.Inc("api")
+    }
+
+    out := make([]apiModel, 0, len(carModels))
+    for _, model := range carModels {
+        out = append(out, newAPIModel(model))
+    }
+
+    writeJSON(w, http.StatusOK, out)
+}
+
+// apiBookingRequest is the body of POST /api/v1/bookings
+type apiBookingRequest struct {
+    ModelID int `json:"model_id"`
+    StartDate string `json:"start_date"`
+    EndDate string `json:"end_date"`
+    FirstName string `json:"first_name"`
+    LastName string `json:"last_name"`
+    Email string `json:"email"`
+    Phone string `json:"phone"`
+}
+
+// APICreateBooking books a model for the given dates
+func (m *Repository) APICreateBooking(w http.ResponseWriter, r *http.Request) {
+    var req apiBookingRequest
+
+    dec := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&req); err != nil {
+        metrics.BookingFailures.Inc("api", metrics.ReasonInvalid)
+        writeJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+        return
+    }
+
+    startDate, endDate, err := parseDateRange(req.StartDate, req.EndDate)
+    if err != nil {
+        metrics.BookingFailures.Inc("api", metrics.ReasonInvalid)
+        writeJSONError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    // validate customer data with the same rules as the rent form
+    form := forms.New(map[string][]string{
+        "first_name": {req.FirstName},
+        "last_name": {req.LastName},
+        "email": {req.Email},
+    })
+    form.Required("first_name", "last_name", "email")
+    form.MinLength("first_name", 2)
+    form.IsEmail("email")
+
+    if !form.Valid() {
+        metrics.BookingFailures.Inc("api", metrics.ReasonInvalid)
+        fields := make(map[string]string)
+        for _, field := range []string{"first_name", "last_name", "email"} {
+            if msg := form.Errors.Get(field); msg != "" {
+                fields[field] = msg
+            }
+        }
+        writeJSONFieldErrors(w, http.StatusUnprocessableEntity, "Invalid booking data", fields)
+        return
+    }
+
+    model, err := m.DB.GetModelByID(req.ModelID)
+    if errors.Is(err, sql.ErrNoRows) {
+        metrics.BookingFailures.Inc("api", metrics.ReasonInvalid)
+        writeJSONError(w, http.StatusNotFound, "Model not found")
+        return
+    }
+    if err != nil {
+        metrics.BookingFailures.Inc("api", metrics.ReasonDatabase)
+        writeJSONError(w, http.StatusInternalServerError, "Error querying database")
+        return
+    }
+
+    violations := m.checkRules(model, startDate, endDate)
+    if len(violations) > 0 {
+        metrics.BookingFailures.Inc("api", metrics.ReasonInvalid)
+        writeJSONFieldErrors(w, http.StatusUnprocessableEntity, "Dates break the booking rules", violationFields(violations, "_date"))
+        return
+    }
+
+    rent := models.Rent{
+        FirstName: req.FirstName,
+        LastName: req.LastName,
+        Email: req.Email,
+        Phone: req.Phone,
+        StartDate: startDate,
+        EndDate: endDate,
+        ModelID: model.ID,
+        Model: model,
+        Status: models.RentPending,
+    }
+
+    rent.Reference, err = newReference()
+    if err != nil {
+        metrics.BookingFailures.Inc("api", metrics.ReasonDatabase)
+        writeJSONError(w, http.StatusInternalServerError, "Can't create booking reference")
+        return
+    }
+
+    quote, err := m.quote(model.ID, startDate, endDate)
+    if err != nil {
+        metrics.BookingFailures.Inc("api", metrics.ReasonPrice)
+        writeJSONError(w, http.StatusInternalServerError, "Can't get price from database")
+        return
+    }
+    rent.TotalPrice = quote.Total
+
+    rent.ID, err = m.DB.CreateBooking(r.Context(), rent)
+    if errors.Is(err, repository.ErrNotAvailable) {
+        metrics.BookingFailures.Inc("api", metrics.ReasonNotAvailable)
+        writeJSONError(w, http.StatusConflict, "Model is not available for the requested dates")
+        return
+    }
+    if err != nil {
+        metrics.BookingFailures.Inc("api", metrics.ReasonDatabase)
+        writeJSONError(w, http.StatusInternalServerError, "Can't insert booking into database")
+        return
+    }
+    metrics.BookingsCreated.Inc("api")
+
+    // the booking mails are sent once the payment is captured
+    payment, err := m.startPayment(rent)
+    if err != nil {
+        m.App.Logger.ErrorContext(r.Context(), "cannot start payment", "rent", rent.ID, "error", err)
+        writeJSONError(w, http.StatusInternalServerError, "Can't start payment")
+        return
+    }
+
+    booking := newAPIBooking(rent)
+    booking.PaymentURL = payment.CheckoutURL
+    booking.ManageURL = m.manageURL(rent)
+
+    w.Header().Set("Location", fmt.Sprintf("/api/v1/bookings/%d", rent.ID))
+    writeJSON(w, http.StatusCreated, booking)
+}
+
+// APIGetBooking returns a single booking. The email used for booking has to
+// be given as query parameter, so that bookings can't be listed by id.
+func (m *Repository) APIGetBooking(w http.ResponseWriter, r *http.Request) {
+    id, err := apiPathID(r)
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, "Invalid booking id")
+        return
+    }
+
+    rent, err := m.DB.GetRentByID(id)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeJSONError(w, http.StatusNotFound, "Booking not found")
+        return
+    }
+    if err != nil {
+        writeJSONError(w, http.StatusInternalServerError, "Error querying database")
+        return
+    }
+
+    if !strings.EqualFold(rent.Email, r.URL.Query().Get("email")) {
+        writeJSONError(w, http.StatusNotFound, "Booking not found")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, newAPIBooking(rent))
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sanijo/rent-app/internal/metrics"
+)
+
+// apiTests is data for the JSON API handlers
+var apiTests = []struct {
+    name string
+    method string
+    url string
+    body string
+    expectedStatusCode int
+    expectedError bool
+}{
+    {"list models", "GET", "/api/v1/models", "", http.StatusOK, false},
+    {"get model", "GET", "/api/v1/models/1", "", http.StatusOK, false},
+    {"get non existent model", "GET", "/api/v1/models/3", "", http.StatusNotFound, true},
+    {"get model with invalid id", "GET", "/api/v1/models/abc", "", http.StatusBadRequest, true},
+    {"availability for all models", "GET", "/api/v1/availability?start=2049-02-02&end=2049-02-03", "", http.StatusOK, false},
+    {"availability for a model", "GET", "/api/v1/availability?start=2049-02-02&end=2049-02-03&model_id=1", "", http.StatusOK, false},
+    {"availability database error", "GET", "/api/v1/availability?start=2049-01-01&end=2049-01-03", "", http.StatusInternalServerError, true},
+    {"availability with missing dates", "GET", "/api/v1/availability", "", http.StatusBadRequest, true},
+    {"availability with invalid date", "GET", "/api/v1/availability?start=2049-13-01&end=2049-02-03", "", http.StatusBadRequest, true},
+    {"availability with end before start", "GET", "/api/v1/availability?start=2049-02-03&end=2049-02-02", "", http.StatusBadRequest, true},
+    {"availability with invalid model id", "GET", "/api/v1/availability?start=2049-02-02&end=2049-02-03&model_id=x", "", http.StatusBadRequest, true},
+    {"availability for non existent model", "GET", "/api/v1/availability?start=2049-02-02&end=2049-02-03&model_id=3", "", http.StatusNotFound, true},
+    {"availability in the past", "GET", "/api/v1/availability?start=2020-01-02&end=2020-01-03", "", http.StatusUnprocessableEntity, true},
+    {"availability longer than the model allows", "GET", "/api/v1/availability?start=2049-02-02&end=2049-02-12&model_id=2", "", http.StatusUnprocessableEntity, true},
+    {
+        "create booking", "POST", "/api/v1/bookings",
+        `{"model_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "John", "last_name": "Doe", "email": "john@doe.com"}`,
+        http.StatusCreated, false,
+    },
+    {
+        "create booking for booked dates (start=2049-01-01)", "POST", "/api/v1/bookings",
+        `{"model_id": 1, "start_date": "2049-01-01", "end_date": "2049-01-03", "first_name": "John", "last_name": "Doe", "email": "john@doe.com"}`,
+        http.StatusConflict, true,
+    },
+    {
+        "create booking with invalid json", "POST", "/api/v1/bookings",
+        `{"model_id": "one"}`,
+        http.StatusBadRequest, true,
+    },
+    {
+        "create booking with invalid data", "POST", "/api/v1/bookings",
+        `{"model_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "J", "email": "john"}`,
+        http.StatusUnprocessableEntity, true,
+    },
+    {
+        "create booking longer than the model allows", "POST", "/api/v1/bookings",
+        `{"model_id": 2, "start_date": "2050-01-01", "end_date": "2050-01-11", "first_name": "John", "last_name": "Doe", "email": "john@doe.com"}`,
+        http.StatusUnprocessableEntity, true,
+    },
+    {
+        "create booking for non existent model", "POST", "/api/v1/bookings",
+        `{"model_id": 3, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "John", "last_name": "Doe", "email": "john@doe.com"}`,
+        http.StatusNotFound, true,
+    },
+    {"get booking", "GET", "/api/v1/bookings/1?email=john@doe.com", "", http.StatusOK, false},
+    {"get booking with wrong email", "GET", "/api/v1/bookings/1?email=jane@doe.com", "", http.StatusNotFound, true},
+    {"get non existent booking", "GET", "/api/v1/bookings/3?email=john@doe.com", "", http.StatusNotFound, true},
+}
+
+// TestAPI tests the JSON API handlers
+func TestAPI(t *testing.T) {
+    routes := getRoutes()
+    // create test server
+    ts := httptest.NewTLSServer(routes)
+    defer ts.Close()
+
+    for _, e := range apiTests {
+        r, _ := http.NewRequest(e.method, ts.URL+e.url, strings.NewReader(e.body))
+        r.Header.Set("Content-Type", "application/json")
+
+        response, err := ts.Client().Do(r)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if response.StatusCode != e.expectedStatusCode {
+            t.Errorf("for %s, expected %d but got %d", e.name, e.expectedStatusCode, response.StatusCode)
+        }
+
+        var envelope apiEnvelope
+        err = json.NewDecoder(response.Body).Decode(&envelope)
+        response.Body.Close()
+        if err != nil {
+            t.Errorf("for %s, error parsing json: %v", e.name, err)
+            continue
+        }
+
+        if (envelope.Error != nil) != e.expectedError {
+            t.Errorf("for %s, expected error %v but got %+v", e.name, e.expectedError, envelope.Error)
+        }
+        if envelope.Error != nil && envelope.Error.Status != response.StatusCode {
+            t.Errorf("for %s, error status %d doesn't match response status %d", e.name, envelope.Error.Status, response.StatusCode)
+        }
+    }
+}
+
+// TestAPICreateBookingCancelled tests that a booking is not stored once the
+// request is cancelled
+func TestAPICreateBookingCancelled(t *testing.T) {
+    body := `{"model_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "John", "last_name": "Doe", "email": "john@doe.com"}`
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+
+    r, _ := http.NewRequestWithContext(ctx, "POST", "/api/v1/bookings", strings.NewReader(body))
+    r.Header.Set("Content-Type", "application/json")
+    rr := httptest.NewRecorder()
+
+    http.HandlerFunc(Repo.APICreateBooking).ServeHTTP(rr, r)
+
+    if rr.Code != http.StatusInternalServerError {
+        t.Errorf("expected %d but got %d", http.StatusInternalServerError, rr.Code)
+    }
+}
+
+// TestAPIBookingRules tests that broken booking rules are returned as field
+// errors and that models are only listed if their own rules are kept
+func TestAPIBookingRules(t *testing.T) {
+    routes := getRoutes()
+    ts := httptest.NewTLSServer(routes)
+    defer ts.Close()
+
+    var tests = []struct {
+        name string
+        method string
+        url string
+        body string
+        expectedFields map[string]string
+        expectedModels int
+    }{
+        {"search in the past", "GET", "/api/v1/availability?start=2020-01-02&end=2020-01-03", "",
+            map[string]string{"start": "Pick-up date is in the past"}, 0},
+        {"search longer than a month", "GET", "/api/v1/availability?start=2049-02-02&end=2049-03-12", "",
+            map[string]string{"end": "The maximum rental is 30 days"}, 0},
+        {"search longer than a week", "GET", "/api/v1/availability?start=2049-02-02&end=2049-02-12", "", nil, 1},
+        {"booking longer than the model allows", "POST", "/api/v1/bookings",
+            `{"model_id": 2, "start_date": "2050-01-01", "end_date": "2050-01-11", "first_name": "John", "last_name": "Doe", "email": "john@doe.com"}`,
+            map[string]string{"end_date": "The maximum rental is 7 days"}, 0},
+    }
+
+    for _, e := range tests {
+        r, _ := http.NewRequest(e.method, ts.URL+e.url, strings.NewReader(e.body))
+        r.Header.Set("Content-Type", "application/json")
+
+        response, err := ts.Client().Do(r)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        var envelope struct {
+            Data []apiModel `json:"data"`
+            Error *apiError `json:"error"`
+        }
+        err = json.NewDecoder(response.Body).Decode(&envelope)
+        response.Body.Close()
+        if err != nil && e.expectedFields == nil {
+            t.Errorf("for %s, error parsing json: %v", e.name, err)
+            continue
+        }
+
+        if e.expectedFields == nil {
+            if len(envelope.Data) != e.expectedModels {
+                t.Errorf("for %s, expected %d models but got %+v", e.name, e.expectedModels, envelope.Data)
+            }
+            continue
+        }
+
+        if envelope.Error == nil {
+            t.Errorf("for %s, expected an error", e.name)
+            continue
+        }
+        for field, message := range e.expectedFields {
+            if envelope.Error.Fields[field] != message {
+                t.Errorf("for %s, expected %q for %s but got %q", e.name, message, field, envelope.Error.Fields[field])
+            }
+        }
+    }
+}
+
+// TestAPIMetrics tests that the API counts searches and bookings
+func TestAPIMetrics(t *testing.T) {
+    routes := getRoutes()
+    ts := httptest.NewTLSServer(routes)
+    defer ts.Close()
+
+    var tests = []struct {
+        name string
+        method string
+        url string
+        body string
+        counter *metrics.CounterVec
+        labels []string
+    }{
+        {"search", "GET", "/api/v1/availability?start=2049-02-02&end=2049-02-03", "", metrics.AvailabilitySearches, []string{"api"}},
+        {"empty search", "GET", "/api/v1/availability?start=2049-01-01&end=2049-01-03&model_id=1", "", metrics.EmptySearches, []string{"api"}},
+        {"booking", "POST", "/api/v1/bookings", `{"model_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "John", "last_name": "Doe", "email": "john@doe.com"}`, metrics.BookingsCreated, []string{"api"}},
+        {"booking conflict", "POST", "/api/v1/bookings", `{"model_id": 1, "start_date": "2049-01-01", "end_date": "2049-01-03", "first_name": "John", "last_name": "Doe", "email": "john@doe.com"}`, metrics.BookingFailures, []string{"api", metrics.ReasonNotAvailable}},
+        {"invalid booking", "POST", "/api/v1/bookings", `{"model_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "J", "email": "john"}`, metrics.BookingFailures, []string{"api", metrics.ReasonInvalid}},
+    }
+
+    for _, e := range tests {
+        before := e.counter.Value(e.labels...)
+
+        r, _ := http.NewRequest(e.method, ts.URL+e.url, strings.NewReader(e.body))
+        response, err := ts.Client().Do(r)
+        if err != nil {
+            t.Fatal(err)
+        }
+        response.Body.Close()
+
+        if got := e.counter.Value(e.labels...) - before; got != 1 {
+            t.Errorf("for %s, expected counter to increase by 1, got %v", e.name, got)
+        }
+    }
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,16 +13,22 @@ import (
 	"github.com/sanijo/rent-app/internal/config"
 	"github.com/sanijo/rent-app/internal/driver"
 	"github.com/sanijo/rent-app/internal/forms"
+	"github.com/sanijo/rent-app/internal/metrics"
 	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+	"github.com/sanijo/rent-app/internal/pricing"
 	"github.com/sanijo/rent-app/internal/render"
+	"github.com/sanijo/rent-app/internal/rentstatus"
 	"github.com/sanijo/rent-app/internal/repository"
 	"github.com/sanijo/rent-app/internal/repository/dbrepo"
+	"github.com/sanijo/rent-app/internal/rules"
 )
 
 // Repository is the repository type
 type Repository struct {
     App *config.AppConfig
     DB repository.DatabaseRepo
+    Payments payments.Provider
 }
 
 // Repo repository used by the handlers
@@ -30,6 +39,7 @@ func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
     return &Repository {
         App: a,
         DB: dbrepo.NewPostgresRepo(db.SQL, a),
+        Payments: newProvider(a),
     }
 }
 
@@ -38,6 +48,7 @@ func NewTestRepo(a *config.AppConfig) *Repository {
     return &Repository {
         App: a,
         DB: dbrepo.NewTestingRepo(a),
+        Payments: newProvider(a),
     }
 }
 
@@ -63,7 +74,9 @@ func (m *Repository) ModelY(w http.ResponseWriter, r *http.Request) {
 
 // CheckAvailability is check-availability page handler
 func (m *Repository) CheckAvailability(w http.ResponseWriter, r *http.Request) {
-    render.Template(w, r, "check-availability.page.html", &models.TemplateData{})
+    render.Template(w, r, "check-availability.page.html", &models.TemplateData{
+        Form: forms.New(nil),
+    })
 }
 
 // PostAvailability is check-availability page handler. After user submits
@@ -99,6 +112,18 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // redisplay the form if the dates break the booking rules
+    violations := m.checkRules(models.Model{}, startDate, endDate)
+    if len(violations) > 0 {
+        form := forms.New(r.PostForm)
+        addViolations(form, violations, "")
+
+        render.Template(w, r, "check-availability.page.html", &models.TemplateData{
+            Form: form,
+        })
+        return
+    }
+
     // get availability
     availableCarModels, err := m.DB.SearchAvailabilityForAllModels(startDate, endDate)
     if err != nil {
@@ -106,17 +131,34 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
         http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
         return
     }
+    metrics.AvailabilitySearches.Inc("web")
+
+    // models with their own rental length limits may not be bookable
+    availableCarModels = m.bookableModels(availableCarModels, startDate, endDate)
 
     // if slice is empty means no availability
     if len(availableCarModels) == 0 {
+        metrics.EmptySearches.Inc("web")
         m.App.Session.Put(r.Context(), "error", "No available vehicles for specified dates")
         http.Redirect(w, r, "/check-availability", http.StatusSeeOther)
         return
     }
 
+    // price every available model for the chosen dates
+    quotes := make(map[int]pricing.Quote)
+    for _, model := range availableCarModels {
+        quotes[model.ID], err = m.quote(model.ID, startDate, endDate)
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't get prices from database")
+            http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+            return
+        }
+    }
+
     // create a map to store data to be sent to the template
     data := make(map[string]interface{}) 
     data["models"] = availableCarModels
+    data["quotes"] = quotes
 
     // create a rent struct to store data in session to be available in next page
     // gob.Register(models.Rent{}) allready in main.go therefore no need to register here
@@ -142,6 +184,9 @@ type jsonResponse struct {
     ModelID string `json:"model_id"`
     StartDate string `json:"start_date"`
     EndDate string `json:"end_date"`
+    FreeUnits int `json:"free_units"`
+    // Fields are the booking rules broken by the dates, by date field
+    Fields map[string]string `json:"fields,omitempty"`
 }
 
 // PostAvailabilityJSON handles request for availability and sends JSON
@@ -165,15 +210,64 @@ func (m *Repository) PostAvailabilityJSON(w http.ResponseWriter, r *http.Request
     sd := r.Form.Get("start")
     ed := r.Form.Get("end")
 
-    layout := "2006-01-02"
-
     // convert the date to time.Time type
-    startDate, _ := time.Parse(layout, sd)
-    endDate, _ := time.Parse(layout, ed)
-    
-    modelID, _ := strconv.Atoi(r.Form.Get("model_id"))
+    startDate, endDate, err := parseDateRange(sd, ed)
+    if err != nil {
+        resp := jsonResponse {
+            OK: false,
+            Message: err.Error(),
+        }
 
-    available, err := m.DB.SearchAvailabilityByDatesAndModelID(startDate, endDate, modelID)
+        out, _ := json.MarshalIndent(resp, "", "    ")
+        w.Header().Set("Content-Type", "application/json")
+        w.Write(out)
+        return
+    }
+
+    modelID, err := strconv.Atoi(r.Form.Get("model_id"))
+    if err != nil {
+        resp := jsonResponse {
+            OK: false,
+            Message: "Invalid model id",
+        }
+
+        out, _ := json.MarshalIndent(resp, "", "    ")
+        w.Header().Set("Content-Type", "application/json")
+        w.Write(out)
+        return
+    }
+
+    model, err := m.DB.GetModelByID(modelID)
+    if err != nil {
+        resp := jsonResponse {
+            OK: false,
+            Message: "Invalid model id",
+        }
+
+        out, _ := json.MarshalIndent(resp, "", "    ")
+        w.Header().Set("Content-Type", "application/json")
+        w.Write(out)
+        return
+    }
+
+    violations := m.checkRules(model, startDate, endDate)
+    if len(violations) > 0 {
+        resp := jsonResponse {
+            OK: false,
+            Message: violationMessage(violations),
+            ModelID: strconv.Itoa(modelID),
+            StartDate: sd,
+            EndDate: ed,
+            Fields: violationFields(violations, ""),
+        }
+
+        out, _ := json.MarshalIndent(resp, "", "    ")
+        w.Header().Set("Content-Type", "application/json")
+        w.Write(out)
+        return
+    }
+
+    freeUnits, err := m.DB.SearchAvailabilityByDatesAndModelID(startDate, endDate, modelID)
     if err != nil {
         // if there is database error, send JSON response
         resp := jsonResponse {
@@ -186,13 +280,18 @@ func (m *Repository) PostAvailabilityJSON(w http.ResponseWriter, r *http.Request
         w.Write(out)
         return
     }
+    metrics.AvailabilitySearches.Inc("web")
+    if freeUnits == 0 {
+        metrics.EmptySearches.Inc("web")
+    }
 
     resp := jsonResponse {
-        OK: available,
+        OK: freeUnits > 0,
         Message: "",
         ModelID: strconv.Itoa(modelID),
         StartDate: sd,
         EndDate: ed,
+        FreeUnits: freeUnits,
     }
 
     // removed error handling sine all aspects are allready handled and resp is
@@ -222,27 +321,29 @@ func (m *Repository) Rent(w http.ResponseWriter, r *http.Request) {
         return
     }
     
-    // store model name into rent struct Model field
-    rent.Model.ModelName = model.ModelName
+    // store model into rent struct Model field, its booking rules are
+    // checked again when the form is posted
+    rent.Model = model
+
+    quote, err := m.quote(rent.ModelID, rent.StartDate, rent.EndDate)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get price from database")
+        http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+        return
+    }
+    rent.TotalPrice = quote.Total
 
     // store rent struct with model name into session
     m.App.Session.Put(r.Context(), "rent", rent)
 
-    // convert the date to string type to be able to use it in rent template
-    sd := rent.StartDate.Format("2006-01-02")
-    ed := rent.EndDate.Format("2006-01-02")
-
     data := make(map[string]interface{})
     data["rent"] = rent
-
-    // create string map (see TemplateData struct in models/models.go)
-    // to store data to be sent to the template
-    stringMap := make(map[string]string)    
-    stringMap["start_date"] = sd
-    stringMap["end_date"] = ed
+    data["quote"] = quote
+    if hold, ok := m.App.Session.Get(r.Context(), "hold").(models.RentRestriction); ok {
+        data["hold"] = hold
+    }
 
     render.Template(w, r, "rent.page.html", &models.TemplateData{
-        StringMap: stringMap,
         Form: forms.New(nil),
         Data: data,
     })
@@ -266,11 +367,40 @@ func (m *Repository) PostRent(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // check the booking rules again, e.g. the lead time may have passed while
+    // the form was filled in
+    violations := m.checkRules(rent.Model, rent.StartDate, rent.EndDate)
+    if len(violations) > 0 {
+        metrics.BookingFailures.Inc("web", metrics.ReasonInvalid)
+        m.releaseHold(r.Context())
+        m.App.Session.Put(r.Context(), "error", violationMessage(violations))
+        http.Redirect(w, r, "/check-availability", http.StatusSeeOther)
+        return
+    }
+
+    // price the rent again, the price in the session may be outdated
+    quote, err := m.quote(rent.ModelID, rent.StartDate, rent.EndDate)
+    if err != nil {
+        metrics.BookingFailures.Inc("web", metrics.ReasonPrice)
+        m.App.Session.Put(r.Context(), "error", "Can't get price from database")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
+    rent.TotalPrice = quote.Total
+
     // update rent struct with data from the form
     rent.FirstName = r.Form.Get("first_name")
     rent.LastName = r.Form.Get("last_name")
     rent.Email = r.Form.Get("email")
     rent.Phone = r.Form.Get("phone")
+    // the rent holds the vehicle but is only confirmed once paid
+    rent.Status = models.RentPending
+    rent.Reference, err = newReference()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't create booking reference")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
 
     // create a form struct to validate the data
     form := forms.New(r.PostForm)
@@ -280,57 +410,140 @@ func (m *Repository) PostRent(w http.ResponseWriter, r *http.Request) {
 
     // if there are any errors, redisplay the form
     if !form.Valid() {
-        // convert the date to string type to be able to use it in rent-summary template
-        sd := rent.StartDate.Format("2006-01-02")
-        ed := rent.EndDate.Format("2006-01-02")
-
-        // create string map (see TemplateData struct in models/models.go)
-        // to store data to be sent to the template
-        stringMap := make(map[string]string)
-        stringMap["start_date"] = sd
-        stringMap["end_date"] = ed
+        metrics.BookingFailures.Inc("web", metrics.ReasonInvalid)
 
         data := make(map[string]interface{})
         data["rent"] = rent
+        data["quote"] = quote
 
         http.Error(w, "Invalid form submission", http.StatusSeeOther)
 
         render.Template(w, r, "rent.page.html", &models.TemplateData{
-            StringMap: stringMap,
             Form: form,
             Data: data,
         })
         return
     }
 
-    // insert rent into database
-    rentID, err := m.DB.InsertRent(rent)
+    // insert rent and its restriction into database in one transaction, the
+    // hold in the session, if any, becomes the reservation
+    hold, _ := m.App.Session.Get(r.Context(), "hold").(models.RentRestriction)
+    rentID, err := m.DB.CreateBookingFromHold(r.Context(), rent, hold.ID)
+    if errors.Is(err, repository.ErrNotAvailable) {
+        metrics.BookingFailures.Inc("web", metrics.ReasonNotAvailable)
+        m.App.Session.Put(r.Context(), "error", "Sorry, someone just booked this vehicle for the selected dates")
+        http.Redirect(w, r, "/check-availability", http.StatusSeeOther)
+        return
+    }
     if err != nil {
+        metrics.BookingFailures.Inc("web", metrics.ReasonDatabase)
         m.App.Session.Put(r.Context(), "error", "Can't insert rent into database")
         http.Redirect(w, r, "/", http.StatusSeeOther)
         return
     }
 
-    // create rent restriction struct
-    rentRestriction := models.RentRestriction{
-        StartDate: rent.StartDate,
-        EndDate: rent.EndDate,
-        ModelID: rent.ModelID,
-        RentID: rentID,
-        RestrictionID: 1,
-    }
+    rent.ID = rentID
+    metrics.BookingsCreated.Inc("web")
+    m.App.Session.Remove(r.Context(), "hold")
 
-    // insert restriction into database
-    err = m.DB.InsertRentRestriction(rentRestriction)
+    // put rent and quote values back into session (types enabled in main)
+    m.App.Session.Put(r.Context(), "rent", rent)
+    m.App.Session.Put(r.Context(), "quote", quote)
+
+    // the booking mails are sent once the payment is captured
+    _, err = m.startPayment(rent)
     if err != nil {
-        m.App.Session.Put(r.Context(), "error", "Can't insert rent restriction into database")
+        m.App.Logger.ErrorContext(r.Context(), "cannot start payment", "rent", rent.ID, "error", err)
+        m.App.Session.Put(r.Context(), "error", "Can't start payment")
         http.Redirect(w, r, "/", http.StatusSeeOther)
         return
     }
 
-    // put rent value back into session (type enabled in main)
-    m.App.Session.Put(r.Context(), "rent", rent)
-    http.Redirect(w, r, "/rent-summary", http.StatusSeeOther)
+    http.Redirect(w, r, "/payment", http.StatusSeeOther)
+}
+
+// quote returns the price of renting a model between start and end
+func (m *Repository) quote(modelID int, start, end time.Time) (pricing.Quote, error) {
+    pl, err := m.DB.GetPriceList(modelID)
+    if err != nil {
+        return pricing.Quote{}, err
+    }
+
+    return pricing.Calculate(pl, start, end), nil
+}
+
+// checkRules returns the booking rules broken by renting model from start to
+// end. Searches over all models pass the zero model to check the global rules
+// only.
+func (m *Repository) checkRules(model models.Model, start, end time.Time) []rules.Violation {
+    return m.App.Booking.ForModel(model).Check(start, end, time.Now())
+}
+
+// bookableModels returns the models whose own booking rules allow renting
+// them from start to end
+func (m *Repository) bookableModels(carModels []models.Model, start, end time.Time) []models.Model {
+    var bookable []models.Model
+    for _, model := range carModels {
+        if len(m.checkRules(model, start, end)) == 0 {
+            bookable = append(bookable, model)
+        }
+    }
+    return bookable
+}
+
+// addViolations adds the broken booking rules as errors of the date fields of
+// form, named start and end followed by suffix
+func addViolations(form *forms.Form, violations []rules.Violation, suffix string) {
+    for _, v := range violations {
+        form.Errors.Add(v.Field+suffix, v.Message)
+    }
+}
+
+// violationFields returns the first broken booking rule of each date field,
+// named start and end followed by suffix
+func violationFields(violations []rules.Violation, suffix string) map[string]string {
+    fields := make(map[string]string)
+    for _, v := range violations {
+        if _, ok := fields[v.Field+suffix]; !ok {
+            fields[v.Field+suffix] = v.Message
+        }
+    }
+    return fields
+}
+
+// violationMessage joins the messages of the broken booking rules
+func violationMessage(violations []rules.Violation) string {
+    messages := make([]string, len(violations))
+    for i, v := range violations {
+        messages[i] = v.Message
+    }
+    return strings.Join(messages, ". ")
+}
+
+// sendBookingMail sends a confirmation to the renter and a notification to
+// the owner
+func (m *Repository) sendBookingMail(rent models.Rent) {
+    mailData := make(map[string]interface{})
+    mailData["rent"] = rent
+    if rent.Reference != "" {
+        mailData["manageURL"] = m.manageURL(rent)
+    }
+
+    m.App.MailChan <- models.MailData{
+        To: rent.Email,
+        From: m.App.Mail.From,
+        Subject: "Rent confirmation",
+        Template: "rent-confirmation.html",
+        Data: mailData,
+    }
+
+    m.App.MailChan <- models.MailData{
+        To: m.App.Mail.OwnerEmail,
+        From: m.App.Mail.From,
+        Subject: "New rent",
+        Template: "rent-notification.html",
+        Data: mailData,
+    }
 }
 
 // About is about page handler
@@ -352,28 +565,41 @@ func (m *Repository) RentSummary(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    m.App.Session.Remove(r.Context(), "rent")
+    // the payment webhook may have confirmed the rent in the meantime
+    if rent.ID != 0 {
+        current, err := m.DB.GetRentByID(rent.ID)
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't get rent from database")
+            http.Redirect(w, r, "/", http.StatusSeeOther)
+            return
+        }
+        rent.Status = current.Status
+    }
 
     data := make(map[string]interface{})
     data["rent"] = rent
+    if rent.Reference != "" {
+        data["manageURL"] = m.managePath(rent, "")
+    }
 
-    // convert the date to string type to be able to use it in rent-summary template
-    sd := rent.StartDate.Format("2006-01-02")
-    ed := rent.EndDate.Format("2006-01-02")
-
-    // create string map (see TemplateData struct in models/models.go)
-    // to store data to be sent to the template
-    stringMap := make(map[string]string)
-    stringMap["start_date"] = sd
-    stringMap["end_date"] = ed
+    // a pending rent stays in the session, so that it can still be paid
+    if rent.Status == models.RentPending {
+        data["quote"] = m.App.Session.Get(r.Context(), "quote")
+    } else {
+        m.App.Session.Remove(r.Context(), "rent")
+        // price breakdown is only shown if the quote is still in the session
+        if quote, ok := m.App.Session.Pop(r.Context(), "quote").(pricing.Quote); ok {
+            data["quote"] = quote
+        }
+    }
 
     render.Template(w, r, "rent-summary.page.html", &models.TemplateData{
-        StringMap: stringMap,
         Data: data,
     })
 }
 
-// ChooseModel is choose-model page handler
+// ChooseModel is choose-model page handler. It holds a vehicle, so it only
+// answers posted forms, never links that crawlers or prefetching follow.
 func (m *Repository) ChooseModel(w http.ResponseWriter, r *http.Request) {
     // split url by /, and get 3rd element that is model id
     exploded := strings.Split(r.URL.Path, "/")
@@ -395,24 +621,60 @@ func (m *Repository) ChooseModel(w http.ResponseWriter, r *http.Request) {
 
     // update modelID value and save back into session
     rent.ModelID = modelID
+
+    model, err := m.DB.GetModelByID(modelID)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get model from database")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
+
+    // no vehicle is held for dates that can't be booked
+    violations := m.checkRules(model, rent.StartDate, rent.EndDate)
+    if len(violations) > 0 {
+        m.App.Session.Put(r.Context(), "error", violationMessage(violations))
+        http.Redirect(w, r, "/check-availability", http.StatusSeeOther)
+        return
+    }
+
+    err = m.holdVehicle(r.Context(), rent)
+    if errors.Is(err, repository.ErrNotAvailable) {
+        m.App.Session.Put(r.Context(), "error", "Sorry, someone just booked this vehicle for the selected dates")
+        http.Redirect(w, r, "/check-availability", http.StatusSeeOther)
+        return
+    }
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't hold vehicle")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
+
     m.App.Session.Put(r.Context(), "rent", rent)
 
     // redirect to rent page
     http.Redirect(w, r, "/rent", http.StatusSeeOther)
 }
 
-// RentVehicle is rent-vehicle page handler
+// RentVehicle is rent-vehicle page handler. Like ChooseModel it holds a
+// vehicle, so it only answers posted forms.
 func (m *Repository) RentVehicle(w http.ResponseWriter, r *http.Request) {
-    // grab id, s, and e values from url
-    modelID, err := strconv.Atoi(r.URL.Query().Get("id"))
+    err := r.ParseForm()
     if err != nil {
-        m.App.Session.Put(r.Context(), "error", "Missing url parameter")
-        http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+        m.App.Session.Put(r.Context(), "error", "Can't parse form")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
         return
     }
 
-    sd := r.URL.Query().Get("s")
-    ed := r.URL.Query().Get("e")
+    // grab id, s, and e values from the posted form
+    modelID, err := strconv.Atoi(r.PostForm.Get("id"))
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Missing form value")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
+
+    sd := r.PostForm.Get("s")
+    ed := r.PostForm.Get("e")
 
     // convert the date to time.Time type to be able to use it in rent-vehicle template
     layout := "2006-01-02"
@@ -445,9 +707,762 @@ func (m *Repository) RentVehicle(w http.ResponseWriter, r *http.Request) {
     rent.StartDate = startDate
     rent.EndDate = endDate
 
+    // no vehicle is held for dates that can't be booked
+    violations := m.checkRules(model, startDate, endDate)
+    if len(violations) > 0 {
+        m.App.Session.Put(r.Context(), "error", violationMessage(violations))
+        http.Redirect(w, r, "/check-availability", http.StatusSeeOther)
+        return
+    }
+
+    err = m.holdVehicle(r.Context(), rent)
+    if errors.Is(err, repository.ErrNotAvailable) {
+        m.App.Session.Put(r.Context(), "error", "Sorry, someone just booked this vehicle for the selected dates")
+        http.Redirect(w, r, "/check-availability", http.StatusSeeOther)
+        return
+    }
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't hold vehicle")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
+
     // put rent value into session (type enabled in main)
     m.App.Session.Put(r.Context(), "rent", rent)
 
     // redirect to rent page
     http.Redirect(w, r, "/rent", http.StatusSeeOther)
 }
+
+// holdVehicle releases the hold in the session, if any, and holds a vehicle
+// for the model and dates of rent instead, so that nobody else can book it
+// while the customer fills in the rent form
+func (m *Repository) holdVehicle(ctx context.Context, rent models.Rent) error {
+    m.releaseHold(ctx)
+
+    hold, err := m.DB.InsertHold(rent.ModelID, rent.StartDate, rent.EndDate, time.Now().Add(m.App.HoldDuration))
+    if err != nil {
+        return err
+    }
+
+    m.App.Session.Put(ctx, "hold", hold)
+    return nil
+}
+
+// releaseHold releases the hold in the session, if any. A hold that can't be
+// deleted is released by the sweeper once it expires.
+func (m *Repository) releaseHold(ctx context.Context) {
+    hold, ok := m.App.Session.Pop(ctx, "hold").(models.RentRestriction)
+    if !ok {
+        return
+    }
+
+    err := m.DB.DeleteHold(hold.ID)
+    if err != nil {
+        m.App.Logger.WarnContext(ctx, "cannot release hold", "hold", hold.ID, "error", err)
+    }
+}
+
+// ShowLogin is login page handler
+func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
+    render.Template(w, r, "login.page.html", &models.TemplateData{
+        Form: forms.New(nil),
+    })
+}
+
+// PostShowLogin handles logging the user in
+func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
+    // renew session token on every login attempt to prevent session fixation
+    err := m.App.Session.RenewToken(r.Context())
+    if err != nil {
+        m.App.Logger.ErrorContext(r.Context(), "cannot renew session token", "error", err)
+        http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+        return
+    }
+
+    err = r.ParseForm()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't parse form")
+        http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+        return
+    }
+
+    email := r.Form.Get("email")
+    password := r.Form.Get("password")
+
+    form := forms.New(r.PostForm)
+    form.Required("email", "password")
+    form.IsEmail("email")
+
+    // if there are any errors, redisplay the form
+    if !form.Valid() {
+        render.Template(w, r, "login.page.html", &models.TemplateData{
+            Form: form,
+        })
+        return
+    }
+
+    id, accessLevel, err := m.DB.Authenticate(email, password)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
+        http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+        return
+    }
+
+    m.App.Session.Put(r.Context(), "user_id", id)
+    m.App.Session.Put(r.Context(), "access_level", accessLevel)
+    m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+    http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Logout logs the user out. It is posted with a csrf token, so that other
+// sites can't log users out.
+func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+    err := m.App.Session.Destroy(r.Context())
+    if err == nil {
+        err = m.App.Session.RenewToken(r.Context())
+    }
+    if err != nil {
+        m.App.Logger.ErrorContext(r.Context(), "cannot end session", "error", err)
+        http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+        return
+    }
+
+    http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// AdminDashboard is admin dashboard page handler
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+    newRents, err := m.DB.AllNewRents()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get new rents from database")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
+
+    allRents, err := m.DB.AllRents()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get rents from database")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
+
+    intMap := make(map[string]int)
+    intMap["new_rents"] = len(newRents)
+    intMap["all_rents"] = len(allRents)
+
+    render.Template(w, r, "admin-dashboard.page.html", &models.TemplateData{
+        IntMap: intMap,
+    })
+}
+
+// AdminNewRents shows all rents that are not yet processed
+func (m *Repository) AdminNewRents(w http.ResponseWriter, r *http.Request) {
+    rents, err := m.DB.AllNewRents()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get new rents from database")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    data := make(map[string]interface{})
+    data["rents"] = rents
+
+    render.Template(w, r, "admin-new-rents.page.html", &models.TemplateData{
+        Data: data,
+    })
+}
+
+// AdminAllRents shows all rents
+func (m *Repository) AdminAllRents(w http.ResponseWriter, r *http.Request) {
+    rents, err := m.DB.AllRents()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get rents from database")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    data := make(map[string]interface{})
+    data["rents"] = rents
+
+    render.Template(w, r, "admin-all-rents.page.html", &models.TemplateData{
+        Data: data,
+    })
+}
+
+// adminRentParams returns the source list ("new", "all" or "cal") and the
+// rent id from urls of the form /admin/<action>/{src}/{id}
+func adminRentParams(r *http.Request) (string, int, error) {
+    exploded := strings.Split(r.URL.Path, "/")
+    if len(exploded) < 5 {
+        return "", 0, errors.New("missing url parameter")
+    }
+
+    src := exploded[3]
+    if src != "new" && src != "all" && src != "cal" {
+        return "", 0, errors.New("unknown rent list")
+    }
+
+    id, err := strconv.Atoi(exploded[4])
+    if err != nil {
+        return "", 0, err
+    }
+
+    return src, id, nil
+}
+
+// adminBackURL returns the url of the admin page a rent was opened from
+func adminBackURL(src string) string {
+    if src == "cal" {
+        return "/admin/calendar"
+    }
+
+    return fmt.Sprintf("/admin/rents-%s", src)
+}
+
+// AdminShowRent shows a single rent in the admin area
+func (m *Repository) AdminShowRent(w http.ResponseWriter, r *http.Request) {
+    src, id, err := adminRentParams(r)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Missing url parameter")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    rent, err := m.DB.GetRentByID(id)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get rent from database")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    m.renderAdminRent(w, r, src, rent, forms.New(nil))
+}
+
+// renderAdminRent shows rent with its status history and the statuses it can
+// change to, src is the list the admin came from
+func (m *Repository) renderAdminRent(w http.ResponseWriter, r *http.Request, src string, rent models.Rent, form *forms.Form) {
+    history, err := m.DB.GetRentStatusHistory(rent.ID)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get rent status history from database")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    stringMap := make(map[string]string)
+    stringMap["src"] = src
+    stringMap["back"] = adminBackURL(src)
+
+    data := make(map[string]interface{})
+    data["rent"] = rent
+    data["history"] = history
+    data["transitions"] = rentstatus.Next(rent.Status)
+
+    render.Template(w, r, "admin-rent-show.page.html", &models.TemplateData{
+        StringMap: stringMap,
+        Data: data,
+        Form: form,
+    })
+}
+
+// AdminPostShowRent updates the customer details of a rent
+func (m *Repository) AdminPostShowRent(w http.ResponseWriter, r *http.Request) {
+    src, id, err := adminRentParams(r)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Missing url parameter")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    err = r.ParseForm()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't parse form")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    rent, err := m.DB.GetRentByID(id)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get rent from database")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    rent.FirstName = r.Form.Get("first_name")
+    rent.LastName = r.Form.Get("last_name")
+    rent.Email = r.Form.Get("email")
+    rent.Phone = r.Form.Get("phone")
+
+    form := forms.New(r.PostForm)
+    form.Required("first_name", "last_name", "email")
+    form.MinLength("first_name", 2)
+    form.IsEmail("email")
+
+    if !form.Valid() {
+        m.renderAdminRent(w, r, src, rent, form)
+        return
+    }
+
+    err = m.DB.UpdateRent(rent)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't update rent")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    m.App.Session.Put(r.Context(), "flash", "Changes saved")
+    http.Redirect(w, r, adminBackURL(src), http.StatusSeeOther)
+}
+
+// AdminProcessRent marks a rent as processed
+func (m *Repository) AdminProcessRent(w http.ResponseWriter, r *http.Request) {
+    src, id, err := adminRentParams(r)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Missing url parameter")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    err = m.DB.UpdateProcessedForRent(id, 1)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't mark rent as processed")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    m.App.Session.Put(r.Context(), "flash", "Rent marked as processed")
+    http.Redirect(w, r, adminBackURL(src), http.StatusSeeOther)
+}
+
+// AdminRentStatus changes the status of a rent, e.g. checks it out when the
+// customer picks up the vehicle. The form field status is the new status.
+func (m *Repository) AdminRentStatus(w http.ResponseWriter, r *http.Request) {
+    src, id, err := adminRentParams(r)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Missing url parameter")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    err = r.ParseForm()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't parse form")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    rent, err := m.DB.GetRentByID(id)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get rent from database")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    rentURL := fmt.Sprintf("/admin/rents/%s/%d", src, id)
+    to := r.Form.Get("status")
+
+    err = rentstatus.Check(rent, to, time.Now())
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Can't change status: %s", err))
+        http.Redirect(w, r, rentURL, http.StatusSeeOther)
+        return
+    }
+
+    changedBy := fmt.Sprintf("user %d", m.App.Session.GetInt(r.Context(), "user_id"))
+    if to == models.RentCancelled {
+        // cancelling refunds the customer, like cancelling on the manage page
+        err = rentstatus.Cancel(m.DB, m.Payments, rent, changedBy)
+    } else {
+        err = m.DB.UpdateRentStatus(rent.ID, rent.Status, to, changedBy)
+    }
+    if errors.Is(err, rentstatus.ErrRefundFailed) {
+        m.App.Logger.ErrorContext(r.Context(), "cannot refund payment", "rent", rent.ID, "amount", rent.TotalPrice.String(), "error", err)
+        m.App.Session.Put(r.Context(), "error", "Rent is cancelled, but the payment couldn't be refunded, please refund it by hand")
+        http.Redirect(w, r, rentURL, http.StatusSeeOther)
+        return
+    }
+    if errors.Is(err, repository.ErrStatusChanged) {
+        m.App.Session.Put(r.Context(), "error", "The status was changed in the meantime, try again")
+        http.Redirect(w, r, rentURL, http.StatusSeeOther)
+        return
+    }
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't change rent status")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Rent is now %s", strings.ToLower(rentstatus.Label(to))))
+    http.Redirect(w, r, adminBackURL(src), http.StatusSeeOther)
+}
+
+// AdminDeleteRent deletes a rent together with its restriction, e.g. a test
+// booking. Real bookings are cancelled through AdminRentStatus instead.
+func (m *Repository) AdminDeleteRent(w http.ResponseWriter, r *http.Request) {
+    src, id, err := adminRentParams(r)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Missing url parameter")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    err = m.DB.DeleteRent(id)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't delete rent")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    m.App.Session.Put(r.Context(), "flash", "Rent deleted")
+    http.Redirect(w, r, adminBackURL(src), http.StatusSeeOther)
+}
+
+// calendarDay holds the state of a single day of a model in the admin
+// calendar
+type calendarDay struct {
+    Date string
+    Day int
+    RentID int
+    Blocked bool
+    // Held is set while a customer fills in the rent form for the day
+    Held bool
+    // Imported is set for owner blocks imported from another calendar, they
+    // are changed in that calendar and can't be unchecked
+    Imported bool
+    // Turnaround is set if the vehicle is cleaned and charged on the day
+    // after a rent, block or hold
+    Turnaround bool
+}
+
+// calendarVehicle holds all days of a month for a single vehicle
+type calendarVehicle struct {
+    Vehicle models.Vehicle
+    Days []calendarDay
+}
+
+// calendarModel holds the calendars of all vehicles of a model
+type calendarModel struct {
+    Model models.Model
+    Vehicles []calendarVehicle
+}
+
+// vehicleRestrictions returns the restrictions that belong to vehicleID
+func vehicleRestrictions(restrictions []models.RentRestriction, vehicleID int) []models.RentRestriction {
+    var out []models.RentRestriction
+    for _, rr := range restrictions {
+        if rr.VehicleID == vehicleID {
+            out = append(out, rr)
+        }
+    }
+    return out
+}
+
+// restrictionDays returns every day covered by a restriction. Restrictions
+// with equal start and end date cover that single day.
+func restrictionDays(rr models.RentRestriction) []time.Time {
+    var days []time.Time
+
+    end := rr.EndDate
+    if !end.After(rr.StartDate) {
+        end = rr.StartDate.AddDate(0, 0, 1)
+    }
+
+    for d := rr.StartDate; d.Before(end); d = d.AddDate(0, 0, 1) {
+        days = append(days, d)
+    }
+
+    return days
+}
+
+// turnaroundDays returns the days before and after a restriction that are kept
+// free for a turnaround of days whole days. Booking keeps the turnaround free
+// on both sides, so a rent can neither end nor start on these days.
+func turnaroundDays(rr models.RentRestriction, days int) []time.Time {
+    covered := restrictionDays(rr)
+    before := covered[0].AddDate(0, 0, -days)
+    after := covered[len(covered)-1].AddDate(0, 0, 1)
+
+    var out []time.Time
+    for i := 0; i < days; i++ {
+        out = append(out, before.AddDate(0, 0, i))
+    }
+    for i := 0; i < days; i++ {
+        out = append(out, after.AddDate(0, 0, i))
+    }
+
+    return out
+}
+
+// calendarMonth returns the first day of the month given by the y and m
+// query parameters, or of the current month if they are missing
+func calendarMonth(r *http.Request) (time.Time, error) {
+    now := time.Now()
+    if r.URL.Query().Get("y") == "" {
+        return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+    }
+
+    year, err := strconv.Atoi(r.URL.Query().Get("y"))
+    if err != nil {
+        return time.Time{}, err
+    }
+
+    month, err := strconv.Atoi(r.URL.Query().Get("m"))
+    if err != nil || month < 1 || month > 12 {
+        return time.Time{}, errors.New("invalid month")
+    }
+
+    return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// AdminCalendar shows reservations, owner blocks, holds and turnarounds of
+// every vehicle for one month
+func (m *Repository) AdminCalendar(w http.ResponseWriter, r *http.Request) {
+    monthStart, err := calendarMonth(r)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Invalid month")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+    monthEnd := monthStart.AddDate(0, 1, 0)
+
+    carModels, err := m.DB.AllModels()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get models from database")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    var calendar []calendarModel
+
+    for _, model := range carModels {
+        vehicles, err := m.DB.GetVehiclesByModelID(model.ID)
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't get vehicles from database")
+            http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+            return
+        }
+
+        // restrictions ending before or starting after the month may still
+        // have their turnaround in it
+        restrictions, err := m.DB.GetRestrictionsForModelByDate(model.ID, monthStart.AddDate(0, 0, -model.TurnaroundDays()), monthEnd.AddDate(0, 0, model.TurnaroundDays()))
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't get restrictions from database")
+            http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+            return
+        }
+
+        cm := calendarModel{Model: model}
+        for _, vehicle := range vehicles {
+            // index restrictions of the vehicle by day
+            rentIDs := make(map[string]int)
+            blocked := make(map[string]bool)
+            held := make(map[string]bool)
+            imported := make(map[string]bool)
+            turnaround := make(map[string]bool)
+            for _, rr := range vehicleRestrictions(restrictions, vehicle.ID) {
+                for _, d := range turnaroundDays(rr, model.TurnaroundDays()) {
+                    turnaround[d.Format("2006-01-02")] = true
+                }
+                for _, d := range restrictionDays(rr) {
+                    switch {
+                    case rr.RestrictionID == models.RestrictionOwnerBlock && rr.ExternalUID != "":
+                        imported[d.Format("2006-01-02")] = true
+                    case rr.RestrictionID == models.RestrictionOwnerBlock:
+                        blocked[d.Format("2006-01-02")] = true
+                    case rr.RestrictionID == models.RestrictionHold:
+                        held[d.Format("2006-01-02")] = true
+                    default:
+                        rentIDs[d.Format("2006-01-02")] = rr.RentID
+                    }
+                }
+            }
+
+            cv := calendarVehicle{Vehicle: vehicle}
+            for d := monthStart; d.Before(monthEnd); d = d.AddDate(0, 0, 1) {
+                date := d.Format("2006-01-02")
+                cv.Days = append(cv.Days, calendarDay{
+                    Date: date,
+                    Day: d.Day(),
+                    RentID: rentIDs[date],
+                    Blocked: blocked[date],
+                    Held: held[date],
+                    Imported: imported[date],
+                    // a reservation or hold on the day replaces its turnaround
+                    Turnaround: turnaround[date] && rentIDs[date] == 0 && !held[date],
+                })
+            }
+
+            cm.Vehicles = append(cm.Vehicles, cv)
+        }
+
+        calendar = append(calendar, cm)
+    }
+
+    last := monthStart.AddDate(0, -1, 0)
+    next := monthStart.AddDate(0, 1, 0)
+
+    stringMap := make(map[string]string)
+    stringMap["this_month"] = monthStart.Format("January 2006")
+    stringMap["this_month_m"] = monthStart.Format("01")
+    stringMap["this_month_y"] = monthStart.Format("2006")
+    stringMap["last_month_m"] = last.Format("01")
+    stringMap["last_month_y"] = last.Format("2006")
+    stringMap["next_month_m"] = next.Format("01")
+    stringMap["next_month_y"] = next.Format("2006")
+
+    data := make(map[string]interface{})
+    data["calendar"] = calendar
+
+    render.Template(w, r, "admin-calendar.page.html", &models.TemplateData{
+        StringMap: stringMap,
+        Data: data,
+    })
+}
+
+// ownerBlockChanges compares the owner blocks in restrictions with the days
+// checked in the calendar form for the month [monthStart, monthEnd). It
+// returns the days that need a new one day block and the ids of blocks to
+// delete. A block spanning several days is deleted as a whole when any of
+// its days is unchecked, and its remaining days are blocked again. Blocks
+// imported from other calendars are left alone like reservations, since the
+// next import would bring them back.
+func ownerBlockChanges(restrictions []models.RentRestriction, monthStart, monthEnd time.Time, checked map[string]bool) ([]time.Time, []int) {
+    var addDays []time.Time
+    var removeIDs []int
+
+    inMonth := func(d time.Time) bool {
+        return !d.Before(monthStart) && d.Before(monthEnd)
+    }
+
+    covered := make(map[string]bool)
+    reserved := make(map[string]bool)
+
+    for _, rr := range restrictions {
+        days := restrictionDays(rr)
+
+        if rr.RestrictionID != models.RestrictionOwnerBlock || rr.ExternalUID != "" {
+            for _, d := range days {
+                reserved[d.Format("2006-01-02")] = true
+            }
+            continue
+        }
+
+        changed := false
+        for _, d := range days {
+            covered[d.Format("2006-01-02")] = true
+            if inMonth(d) && !checked[d.Format("2006-01-02")] {
+                changed = true
+            }
+        }
+
+        if !changed {
+            continue
+        }
+
+        // keep days outside of the shown month and days still checked
+        removeIDs = append(removeIDs, rr.ID)
+        for _, d := range days {
+            if !inMonth(d) || checked[d.Format("2006-01-02")] {
+                addDays = append(addDays, d)
+            }
+        }
+    }
+
+    for d := monthStart; d.Before(monthEnd); d = d.AddDate(0, 0, 1) {
+        date := d.Format("2006-01-02")
+        if checked[date] && !covered[date] && !reserved[date] {
+            addDays = append(addDays, d)
+        }
+    }
+
+    return addDays, removeIDs
+}
+
+// AdminPostCalendar saves owner blocks changed in the admin calendar, the
+// changes of all vehicles in one transaction
+func (m *Repository) AdminPostCalendar(w http.ResponseWriter, r *http.Request) {
+    err := r.ParseForm()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't parse form")
+        http.Redirect(w, r, "/admin/calendar", http.StatusSeeOther)
+        return
+    }
+
+    year, _ := strconv.Atoi(r.Form.Get("y"))
+    month, _ := strconv.Atoi(r.Form.Get("m"))
+    if month < 1 || month > 12 {
+        m.App.Session.Put(r.Context(), "error", "Invalid month")
+        http.Redirect(w, r, "/admin/calendar", http.StatusSeeOther)
+        return
+    }
+
+    monthStart := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+    monthEnd := monthStart.AddDate(0, 1, 0)
+    back := fmt.Sprintf("/admin/calendar?y=%d&m=%d", year, month)
+
+    carModels, err := m.DB.AllModels()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get models from database")
+        http.Redirect(w, r, back, http.StatusSeeOther)
+        return
+    }
+
+    // the changes of all vehicles are saved together, so that a failure
+    // saves nothing
+    var changes []models.OwnerBlockChange
+
+    for _, model := range carModels {
+        vehicles, err := m.DB.GetVehiclesByModelID(model.ID)
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't get vehicles from database")
+            http.Redirect(w, r, back, http.StatusSeeOther)
+            return
+        }
+
+        restrictions, err := m.DB.GetRestrictionsForModelByDate(model.ID, monthStart, monthEnd)
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't get restrictions from database")
+            http.Redirect(w, r, back, http.StatusSeeOther)
+            return
+        }
+
+        for _, vehicle := range vehicles {
+            // collect days checked in the form for this vehicle
+            checked := make(map[string]bool)
+            for d := monthStart; d.Before(monthEnd); d = d.AddDate(0, 0, 1) {
+                date := d.Format("2006-01-02")
+                if r.Form.Has(fmt.Sprintf("block_%d_%s", vehicle.ID, date)) {
+                    checked[date] = true
+                }
+            }
+
+            addDays, removeIDs := ownerBlockChanges(vehicleRestrictions(restrictions, vehicle.ID), monthStart, monthEnd, checked)
+            if len(addDays) == 0 && len(removeIDs) == 0 {
+                continue
+            }
+
+            changes = append(changes, models.OwnerBlockChange{
+                VehicleID: vehicle.ID,
+                AddDays: addDays,
+                RemoveIDs: removeIDs,
+            })
+        }
+    }
+
+    if len(changes) > 0 {
+        err = m.DB.UpdateOwnerBlocks(changes)
+        if errors.Is(err, repository.ErrNotAvailable) {
+            m.App.Session.Put(r.Context(), "error", "Can't block days that are already booked, nothing was saved")
+            http.Redirect(w, r, back, http.StatusSeeOther)
+            return
+        }
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't save owner blocks")
+            http.Redirect(w, r, back, http.StatusSeeOther)
+            return
+        }
+    }
+
+    m.App.Session.Put(r.Context(), "flash", "Changes saved")
+    http.Redirect(w, r, back, http.StatusSeeOther)
+}
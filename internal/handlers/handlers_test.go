@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sanijo/rent-app/internal/driver"
 	"github.com/sanijo/rent-app/internal/models"
@@ -33,6 +34,15 @@ var theTests = []struct {
     {"model-y", "/model-y", "GET", http.StatusOK},
     {"check-availability", "/check-availability", "GET", http.StatusOK},
     {"rent-summary", "/rent-summary", "GET", http.StatusOK},
+    {"payment", "/payment", "GET", http.StatusOK},
+    {"login", "/user/login", "GET", http.StatusOK},
+    {"admin dashboard", "/admin/dashboard", "GET", http.StatusOK},
+    {"admin new rents", "/admin/rents-new", "GET", http.StatusOK},
+    {"admin all rents", "/admin/rents-all", "GET", http.StatusOK},
+    {"admin show rent", "/admin/rents/new/1", "GET", http.StatusOK},
+    {"admin calendar", "/admin/calendar", "GET", http.StatusOK},
+    {"admin calendar month", "/admin/calendar?y=2050&m=1", "GET", http.StatusOK},
+    {"admin calendar sync", "/admin/ical", "GET", http.StatusOK},
 }
 
 func TestHandlers(t *testing.T) {
@@ -56,12 +66,33 @@ func TestHandlers(t *testing.T) {
     }
 }
 
+func TestLogout(t *testing.T) {
+    r, _ := http.NewRequest("POST", "/user/logout", nil)
+    ctx := getCtx(r)
+    r = r.WithContext(ctx)
+    session.Put(ctx, "user_id", 1)
+    rr := httptest.NewRecorder()
+
+    http.HandlerFunc(Repo.Logout).ServeHTTP(rr, r)
+
+    if rr.Code != http.StatusSeeOther {
+        t.Errorf("expected %d but got %d", http.StatusSeeOther, rr.Code)
+    }
+    if rr.Header().Get("Location") != "/user/login" {
+        t.Errorf("expected location /user/login but got %s", rr.Header().Get("Location"))
+    }
+    if session.Exists(ctx, "user_id") {
+        t.Errorf("expected the user to be logged out")
+    }
+}
+
 // data for the PostAvaialability handler 
 var postAvailabilityTests = []struct {
     name string
     postedData url.Values
     expectedStatusCode int
     expectedLocation string
+    expectedHTML string
 }{
     {
         name: "cannot parse form",
@@ -73,7 +104,7 @@ var postAvailabilityTests = []struct {
         name: "invalid start date",
         postedData: url.Values{
             "start": {"invalid"},
-            "end": {"2021-05-20"},
+            "end": {"2049-05-20"},
         },
         expectedStatusCode: http.StatusTemporaryRedirect,
         expectedLocation: "/",
@@ -81,17 +112,17 @@ var postAvailabilityTests = []struct {
     {
         name: "invalid end date",
         postedData: url.Values{
-            "start": {"2021-05-20"},
+            "start": {"2049-05-20"},
             "end": {"invalid"},
         },
         expectedStatusCode: http.StatusTemporaryRedirect,
         expectedLocation: "/",
     },
     {
-        name: "SearchAvailabilityForAllModels fails (start=2021-01-01)",
+        name: "SearchAvailabilityForAllModels fails (start=2049-01-01)",
         postedData: url.Values{
-            "start": {"2021-01-01"},
-            "end": {"2021-01-02"},
+            "start": {"2049-01-01"},
+            "end": {"2049-01-02"},
         },
         expectedStatusCode: http.StatusTemporaryRedirect,
         expectedLocation: "/",
@@ -99,17 +130,44 @@ var postAvailabilityTests = []struct {
     {
         name: "length of models returned is 0",
         postedData: url.Values{
-            "start": {"2021-05-20"},
-            "end": {"2021-05-21"},
+            "start": {"2049-05-20"},
+            "end": {"2049-05-21"},
         },
         expectedStatusCode: http.StatusSeeOther,
         expectedLocation: "/check-availability",
     },
     {
-        name: "models are available (start=2022-01-02)",
+        name: "end before start",
         postedData: url.Values{
-            "start": {"2022-01-02"},
-            "end": {"2022-01-03"},
+            "start": {"2049-05-21"},
+            "end": {"2049-05-20"},
+        },
+        expectedStatusCode: http.StatusOK,
+        expectedHTML: "Return date must be after pick-up date",
+    },
+    {
+        name: "start in the past",
+        postedData: url.Values{
+            "start": {"2020-05-20"},
+            "end": {"2020-05-21"},
+        },
+        expectedStatusCode: http.StatusOK,
+        expectedHTML: "Pick-up date is in the past",
+    },
+    {
+        name: "rental too long",
+        postedData: url.Values{
+            "start": {"2049-05-20"},
+            "end": {"2050-05-20"},
+        },
+        expectedStatusCode: http.StatusOK,
+        expectedHTML: "The maximum rental is 30 days",
+    },
+    {
+        name: "models are available (start=2049-02-02)",
+        postedData: url.Values{
+            "start": {"2049-02-02"},
+            "end": {"2049-02-03"},
         },
         expectedStatusCode: http.StatusOK,
         expectedLocation: "",
@@ -138,6 +196,11 @@ func TestPostAvailability(t *testing.T) {
         if rr.Code != e.expectedStatusCode {
             t.Errorf("for %s, expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
         }
+
+        // test for expected HTML
+        if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+            t.Errorf("for %s, expected %q in the page", e.name, e.expectedHTML)
+        }
     }
 }
 
@@ -147,10 +210,10 @@ var postAvailabilityJSONTests = []struct {
     expectedOK bool
 }{
     {
-        name: "no available models (start=2021-01-01)",
+        name: "no available models (start=2049-01-01)",
         postedData: url.Values{
-            "start": {"2021-01-01"},
-            "end": {"2021-01-02"},
+            "start": {"2049-01-01"},
+            "end": {"2049-01-02"},
             "model_id": {"1"},
         },
         expectedOK: false,
@@ -158,8 +221,8 @@ var postAvailabilityJSONTests = []struct {
     {
         name: "models are available",
         postedData: url.Values{
-            "start": {"2022-01-02"},
-            "end": {"2022-01-03"},
+            "start": {"2049-02-02"},
+            "end": {"2049-02-03"},
             "model_id": {"1"},
         },
         expectedOK: true,
@@ -170,10 +233,28 @@ var postAvailabilityJSONTests = []struct {
         expectedOK: false,
     },
     {
-        name: "database query returns error (start=2021-01-02)",
+        name: "longer than the model allows",
         postedData: url.Values{
-            "start": {"2021-01-02"},
-            "end": {"2021-01-03"},
+            "start": {"2049-02-02"},
+            "end": {"2049-02-12"},
+            "model_id": {"2"},
+        },
+        expectedOK: false,
+    },
+    {
+        name: "non existent model",
+        postedData: url.Values{
+            "start": {"2049-02-02"},
+            "end": {"2049-02-03"},
+            "model_id": {"3"},
+        },
+        expectedOK: false,
+    },
+    {
+        name: "database query returns error (start=2049-01-02)",
+        postedData: url.Values{
+            "start": {"2049-01-02"},
+            "end": {"2049-01-03"},
             "model_id": {"1"},
         },
         expectedOK: false,
@@ -235,6 +316,20 @@ var rentTests = []struct {
         expectedStatusCode: http.StatusOK,
         expectedHTML: `action="/rent"`,
     },
+    {
+        name: "rent in session shows price",
+        rent: models.Rent{
+            StartDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC),
+            ModelID: 1,
+            Model: models.Model{
+                ID: 1,
+                ModelName: "Model 3",
+            },
+        },
+        expectedStatusCode: http.StatusOK,
+        expectedHTML: `€160.00`,
+    },
     {
         name: "no rent in session",
         rent: models.Rent{},
@@ -316,6 +411,8 @@ var  postRentTests = []struct {
             LastName: "Doe",
             Email: "john@doe.com",
             Phone: "+38599534256",
+            StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
             ModelID: 1,
             Model: models.Model{
                 ID: 1,
@@ -332,7 +429,7 @@ var  postRentTests = []struct {
             "model_id": {"1"},
         },
         expectedResponseCode: http.StatusSeeOther,
-        expectedLocation: "/rent-summary",
+        expectedLocation: "/payment",
         expectedHTML: "",
     },
     {
@@ -369,6 +466,8 @@ var  postRentTests = []struct {
             LastName: "Doe",
             Email: "john@doe.com",
             Phone: "+38599534256",
+            StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
             ModelID: 1,
             Model: models.Model{
                 ID: 1,
@@ -395,6 +494,8 @@ var  postRentTests = []struct {
             LastName: "Doe",
             Email: "john@doe.com",
             Phone: "+38599534256",
+            StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
             ModelID: 3,
             Model: models.Model{
                 ID: 3,
@@ -421,6 +522,8 @@ var  postRentTests = []struct {
             LastName: "Doe",
             Email: "john@doe.com",
             Phone: "+38599534256",
+            StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
             ModelID: 4,
             Model: models.Model{
                 ID: 4,
@@ -439,6 +542,83 @@ var  postRentTests = []struct {
         expectedResponseCode: http.StatusSeeOther,
         expectedLocation: "/",
     },
+    {
+        name: "dates booked by someone else (ModelID == 5)",
+        inSession: true,
+        rent: models.Rent{
+            FirstName: "John",
+            LastName: "Doe",
+            Email: "john@doe.com",
+            Phone: "+38599534256",
+            StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+            ModelID: 5,
+            Model: models.Model{
+                ID: 5,
+                ModelName: "Model 3",
+            },
+        },
+        postedData: url.Values{
+            "start_date": {"2050-01-01"},
+            "end_date": {"2050-01-02"},
+            "first_name": {"John"},
+            "last_name": {"Doe"},
+            "email": {"john@doe.com"},
+            "phone": {"+38599534256"},
+            "model_id": {"5"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/check-availability",
+    },
+    {
+        name: "price list can't be loaded (ModelID == 6)",
+        inSession: true,
+        rent: models.Rent{
+            FirstName: "John",
+            LastName: "Doe",
+            Email: "john@doe.com",
+            Phone: "+38599534256",
+            StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+            ModelID: 6,
+            Model: models.Model{
+                ID: 6,
+                ModelName: "Model 3",
+            },
+        },
+        postedData: url.Values{
+            "start_date": {"2050-01-01"},
+            "end_date": {"2050-01-02"},
+            "first_name": {"John"},
+            "last_name": {"Doe"},
+            "email": {"john@doe.com"},
+            "phone": {"+38599534256"},
+            "model_id": {"6"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/",
+    },
+    {
+        name: "dates break the booking rules",
+        inSession: true,
+        rent: models.Rent{
+            StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+            ModelID: 1,
+            Model: models.Model{
+                ID: 1,
+                ModelName: "Model 3",
+            },
+        },
+        postedData: url.Values{
+            "first_name": {"John"},
+            "last_name": {"Doe"},
+            "email": {"john@doe.com"},
+            "phone": {"+38599534256"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/check-availability",
+    },
 }
 
 func TestPostRent(t *testing.T) {
@@ -462,6 +642,7 @@ func TestPostRent(t *testing.T) {
         // check if rent is in a session, and if so put it in a session 
         if e.inSession {
             session.Put(ctx, "rent", e.rent)
+            session.Put(ctx, "hold", models.RentRestriction{ID: 1, ModelID: e.rent.ModelID})
         }
         handler.ServeHTTP(rr, r)
 
@@ -484,6 +665,11 @@ func TestPostRent(t *testing.T) {
                 t.Errorf("for %s, expected %s but got %s", e.name, e.expectedHTML, rr.Body.String())
             }
         }
+
+        // the hold became the reservation of a created rent
+        if e.expectedLocation == "/payment" && session.Exists(ctx, "hold") {
+            t.Errorf("for %s, expected the hold to be removed from the session", e.name)
+        }
     }
 
 }
@@ -495,6 +681,7 @@ var rentSummaryTests = []struct {
     rent models.Rent
     expectedResponseCode int
     expectedLocation string
+    expectedHTML string
 }{
     {
         name: "rent in session",
@@ -513,6 +700,41 @@ var rentSummaryTests = []struct {
         expectedResponseCode: http.StatusOK,
         expectedLocation: "",
     },
+    {
+        name: "rent waiting for payment",
+        inSession: true,
+        rent: models.Rent{
+            ID: 2,
+            FirstName: "John",
+            Email: "john@doe.com",
+            ModelID: 1,
+        },
+        expectedResponseCode: http.StatusOK,
+        expectedLocation: "",
+        expectedHTML: "Awaiting payment",
+    },
+    {
+        name: "paid rent",
+        inSession: true,
+        rent: models.Rent{
+            ID: 1,
+            FirstName: "John",
+            Email: "john@doe.com",
+            ModelID: 1,
+        },
+        expectedResponseCode: http.StatusOK,
+        expectedLocation: "",
+        expectedHTML: "Confirmed",
+    },
+    {
+        name: "rent not in database",
+        inSession: true,
+        rent: models.Rent{
+            ID: 3,
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/",
+    },
     {
         name: "rent not in session",
         inSession: false,
@@ -553,6 +775,11 @@ func TestRentSummary(t *testing.T) {
                 t.Errorf("for %s, expected %s but got %s", e.name, e.expectedLocation, headers.Get("Location"))
             }
         }
+
+        // test for expected HTML
+        if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+            t.Errorf("for %s, expected %s in the page", e.name, e.expectedHTML)
+        }
     }
 }
 
@@ -573,6 +800,8 @@ var testChooseModel = []struct {
             LastName: "Doe",
             Email: "john@doe.com",
             Phone: "+38599534256",
+            StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
             ModelID: 1,
             Model: models.Model{
                 ID: 1,
@@ -599,6 +828,8 @@ var testChooseModel = []struct {
             LastName: "Doe",
             Email: "john@doe.com",
             Phone: "+38599534256",
+            StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
             ModelID: 1,
             Model: models.Model{
                 ID: 1,
@@ -609,13 +840,61 @@ var testChooseModel = []struct {
         expectedResponseCode: http.StatusTemporaryRedirect,
         expectedLocation: "/",
     },
+    {
+        name: "no vehicle to hold",
+        inSession: true,
+        rent: models.Rent{
+            StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+            ModelID: 1,
+        },
+        url: "/choose-model/5",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/check-availability",
+    },
+    {
+        name: "hold fails",
+        inSession: true,
+        rent: models.Rent{
+            StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+            ModelID: 1,
+        },
+        url: "/choose-model/6",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/",
+    },
+    {
+        name: "dates break the booking rules",
+        inSession: true,
+        rent: models.Rent{
+            StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+            ModelID: 1,
+        },
+        url: "/choose-model/1",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/check-availability",
+    },
+    {
+        name: "model not in database",
+        inSession: true,
+        rent: models.Rent{
+            StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+            EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+            ModelID: 1,
+        },
+        url: "/choose-model/4",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/",
+    },
 }
 
 // TestChooseModel tests the ChooseModel handler
 func TestChooseModel(t *testing.T) {
     for _, e := range testChooseModel {
         var r *http.Request
-        r, _ = http.NewRequest("GET", e.url, nil)
+        r, _ = http.NewRequest("POST", e.url, nil)
         // create context
         ctx := getCtx(r)
         // add context to request
@@ -645,36 +924,98 @@ func TestChooseModel(t *testing.T) {
     }
 }
 
+// TestHoldVehicle tests that choosing a model replaces the hold in the
+// session
+func TestHoldVehicle(t *testing.T) {
+    r, _ := http.NewRequest("POST", "/choose-model/1", nil)
+    ctx := getCtx(r)
+    r = r.WithContext(ctx)
+
+    session.Put(ctx, "rent", models.Rent{
+        StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+        EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+        ModelID: 2,
+    })
+    // releasing the old hold fails, the sweeper releases it later
+    session.Put(ctx, "hold", models.RentRestriction{ID: 2, ModelID: 2})
+
+    rr := httptest.NewRecorder()
+    http.HandlerFunc(Repo.ChooseModel).ServeHTTP(rr, r)
+
+    if rr.Code != http.StatusSeeOther {
+        t.Errorf("expected %d but got %d", http.StatusSeeOther, rr.Code)
+    }
+
+    hold, ok := session.Get(ctx, "hold").(models.RentRestriction)
+    if !ok {
+        t.Fatal("expected a hold in the session")
+    }
+    if hold.ID != 1 || hold.ModelID != 1 || hold.RestrictionID != models.RestrictionHold {
+        t.Errorf("expected a new hold of model 1, got %+v", hold)
+    }
+    if !hold.ExpiresAt.After(time.Now()) {
+        t.Errorf("expected the hold to expire in the future, got %s", hold.ExpiresAt)
+    }
+
+    // the rent page tells how long the vehicle is held
+    r, _ = http.NewRequest("GET", "/rent", nil)
+    r = r.WithContext(ctx)
+    rr = httptest.NewRecorder()
+    http.HandlerFunc(Repo.Rent).ServeHTTP(rr, r)
+
+    if !strings.Contains(rr.Body.String(), "held for you until "+hold.ExpiresAt.Format("15:04")) {
+        t.Error("expected the hold expiry on the rent page")
+    }
+}
+
 // testRentVehicle is a struct that holds tests for the RentVehicle handler
 var testRentVehicle = []struct {
     name string
-    url string
+    postedData string
     expectedResponseCode int
+    expectedLocation string
 }{
     {
         name: "valid url parameters",
-        url: "/rent-vehicle?s=2023-01-01&e=2023-01-02&id=1",
+        postedData: "s=2050-01-10&e=2050-01-12&id=1",
         expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/rent",
     },
     {
-        name: "invalid url parameters",
-        url: "/rent-vehicle?s=invalid&e=invalid&id=invalid",
-        expectedResponseCode: http.StatusTemporaryRedirect,
+        name: "invalid form values",
+        postedData: "s=invalid&e=invalid&id=invalid",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/",
     },
     {
         name: "invalid start date",
-        url: "/rent-vehicle?s=invalid&e=2023-01-02&id=1",
+        postedData: "s=invalid&e=2050-01-12&id=1",
         expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/",
     },
     {
         name: "invalid end date",
-        url: "/rent-vehicle?s=2023-01-01&e=invalid&id=1",
+        postedData: "s=2050-01-10&e=invalid&id=1",
         expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/",
     },
     {
         name: "invalid model id",
-        url: "/rent-vehicle?s=2023-01-01&e=2023-01-02&id=4",
+        postedData: "s=2050-01-10&e=2050-01-12&id=4",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/",
+    },
+    {
+        name: "dates in the past",
+        postedData: "s=2023-01-01&e=2023-01-02&id=1",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/check-availability",
+    },
+    {
+        name: "rent longer than the model allows",
+        postedData: "s=2050-01-10&e=2050-01-20&id=2",
         expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/check-availability",
     },
 }
 
@@ -683,11 +1024,13 @@ var testRentVehicle = []struct {
 func TestRentVehicle(t *testing.T) {
     for _, e := range testRentVehicle {
         var r *http.Request
-        r, _ = http.NewRequest("GET", e.url, nil)
+        r, _ = http.NewRequest("POST", "/rent-vehicle", strings.NewReader(e.postedData))
         // create context
         ctx := getCtx(r)
         // add context to request
         r = r.WithContext(ctx)
+        // set content type
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
         // create recorder 
         rr := httptest.NewRecorder()
         // create handler 
@@ -698,9 +1041,540 @@ func TestRentVehicle(t *testing.T) {
         if rr.Code != e.expectedResponseCode {
             t.Errorf("for %s, expected %d but got %d", e.name, e.expectedResponseCode, rr.Code)
         }
+
+        // test for Location
+        if rr.Header().Get("Location") != e.expectedLocation {
+            t.Errorf("for %s, expected %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+        }
     }
 }
 
+// loginTests is data for the PostShowLogin handler
+var loginTests = []struct {
+    name string
+    email string
+    expectedStatusCode int
+    expectedHTML string
+    expectedLocation string
+}{
+    {
+        name: "valid credentials",
+        email: "me@here.ca",
+        expectedStatusCode: http.StatusSeeOther,
+        expectedHTML: "",
+        expectedLocation: "/",
+    },
+    {
+        name: "invalid credentials",
+        email: "jack@nimble.com",
+        expectedStatusCode: http.StatusSeeOther,
+        expectedHTML: "",
+        expectedLocation: "/user/login",
+    },
+    {
+        name: "invalid data",
+        email: "j",
+        expectedStatusCode: http.StatusOK,
+        expectedHTML: `action="/user/login"`,
+        expectedLocation: "",
+    },
+}
+
+// TestLogin tests the PostShowLogin handler
+func TestLogin(t *testing.T) {
+    for _, e := range loginTests {
+        postedData := url.Values{}
+        postedData.Add("email", e.email)
+        postedData.Add("password", "password")
+
+        r, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+        // create context
+        ctx := getCtx(r)
+        // add context to request
+        r = r.WithContext(ctx)
+        // set content type
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        // create recorder
+        rr := httptest.NewRecorder()
+        // create handler
+        handler := http.HandlerFunc(Repo.PostShowLogin)
+        handler.ServeHTTP(rr, r)
+
+        // test for status code
+        if rr.Code != e.expectedStatusCode {
+            t.Errorf("for %s, expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+        }
+
+        // test for Location
+        if e.expectedLocation != "" {
+            headers := rr.Result().Header
+            if headers.Get("Location") != e.expectedLocation {
+                t.Errorf("for %s, expected %s but got %s", e.name, e.expectedLocation, headers.Get("Location"))
+            }
+        }
+
+        // test for expected HTML
+        if e.expectedHTML != "" {
+            if !strings.Contains(rr.Body.String(), e.expectedHTML) {
+                t.Errorf("for %s, expected %s but got %s", e.name, e.expectedHTML, rr.Body.String())
+            }
+        }
+    }
+}
+
+// adminRentTests is data for the admin handlers working on a single rent
+var adminRentTests = []struct {
+    name string
+    handler func(*Repository, http.ResponseWriter, *http.Request)
+    method string
+    url string
+    postedData url.Values
+    expectedResponseCode int
+    expectedLocation string
+}{
+    {
+        name: "show rent",
+        handler: (*Repository).AdminShowRent,
+        method: "GET",
+        url: "/admin/rents/all/1",
+        expectedResponseCode: http.StatusOK,
+    },
+    {
+        name: "show non existent rent",
+        handler: (*Repository).AdminShowRent,
+        method: "GET",
+        url: "/admin/rents/all/3",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/dashboard",
+    },
+    {
+        name: "show rent with unknown list",
+        handler: (*Repository).AdminShowRent,
+        method: "GET",
+        url: "/admin/rents/other/1",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/dashboard",
+    },
+    {
+        name: "update rent",
+        handler: (*Repository).AdminPostShowRent,
+        method: "POST",
+        url: "/admin/rents/new/1",
+        postedData: url.Values{
+            "first_name": {"John"},
+            "last_name": {"Doe"},
+            "email": {"john@doe.com"},
+            "phone": {"+38599534256"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/rents-new",
+    },
+    {
+        name: "update rent with invalid form",
+        handler: (*Repository).AdminPostShowRent,
+        method: "POST",
+        url: "/admin/rents/new/1",
+        postedData: url.Values{
+            "first_name": {"John"},
+            "last_name": {"Doe"},
+        },
+        expectedResponseCode: http.StatusOK,
+    },
+    {
+        name: "update rent fails (id == 2)",
+        handler: (*Repository).AdminPostShowRent,
+        method: "POST",
+        url: "/admin/rents/new/2",
+        postedData: url.Values{
+            "first_name": {"John"},
+            "last_name": {"Doe"},
+            "email": {"john@doe.com"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/dashboard",
+    },
+    {
+        name: "process rent",
+        handler: (*Repository).AdminProcessRent,
+        method: "POST",
+        url: "/admin/process-rent/all/1",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/rents-all",
+    },
+    {
+        name: "process rent fails (id == 2)",
+        handler: (*Repository).AdminProcessRent,
+        method: "POST",
+        url: "/admin/process-rent/all/2",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/dashboard",
+    },
+    {
+        name: "cancel rent",
+        handler: (*Repository).AdminRentStatus,
+        method: "POST",
+        url: "/admin/rent-status/all/1",
+        postedData: url.Values{
+            "status": {"cancelled"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/rents-all",
+    },
+    {
+        name: "cancel paid rent, refund fails",
+        handler: (*Repository).AdminRentStatus,
+        method: "POST",
+        url: "/admin/rent-status/all/6",
+        postedData: url.Values{
+            "status": {"cancelled"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/rents/all/6",
+    },
+    {
+        name: "check out rent before its start date",
+        handler: (*Repository).AdminRentStatus,
+        method: "POST",
+        url: "/admin/rent-status/all/1",
+        postedData: url.Values{
+            "status": {"checked_out"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/rents/all/1",
+    },
+    {
+        name: "return rent that waits for payment",
+        handler: (*Repository).AdminRentStatus,
+        method: "POST",
+        url: "/admin/rent-status/cal/2",
+        postedData: url.Values{
+            "status": {"returned"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/rents/cal/2",
+    },
+    {
+        name: "change status of non existent rent",
+        handler: (*Repository).AdminRentStatus,
+        method: "POST",
+        url: "/admin/rent-status/all/3",
+        postedData: url.Values{
+            "status": {"cancelled"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/dashboard",
+    },
+    {
+        name: "delete rent",
+        handler: (*Repository).AdminDeleteRent,
+        method: "POST",
+        url: "/admin/delete-rent/new/1",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/rents-new",
+    },
+    {
+        name: "delete rent fails (id == 2)",
+        handler: (*Repository).AdminDeleteRent,
+        method: "POST",
+        url: "/admin/delete-rent/new/2",
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/dashboard",
+    },
+    {
+        name: "save calendar",
+        handler: (*Repository).AdminPostCalendar,
+        method: "POST",
+        url: "/admin/calendar",
+        postedData: url.Values{
+            "y": {"2050"},
+            "m": {"1"},
+            "block_1_2050-01-02": {"on"},
+            "block_1_2050-01-05": {"on"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/calendar?y=2050&m=1",
+    },
+    {
+        name: "save calendar fails (vehicle 2 blocked)",
+        handler: (*Repository).AdminPostCalendar,
+        method: "POST",
+        url: "/admin/calendar",
+        postedData: url.Values{
+            "y": {"2050"},
+            "m": {"1"},
+            "block_2_2050-01-02": {"on"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/calendar?y=2050&m=1",
+    },
+    {
+        name: "save calendar for second vehicle of a model",
+        handler: (*Repository).AdminPostCalendar,
+        method: "POST",
+        url: "/admin/calendar",
+        postedData: url.Values{
+            "y": {"2050"},
+            "m": {"1"},
+            "block_1_2050-01-02": {"on"},
+            "block_1_2050-01-03": {"on"},
+            "block_3_2050-01-10": {"on"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/calendar?y=2050&m=1",
+    },
+    {
+        name: "save calendar fails for a booked day",
+        handler: (*Repository).AdminPostCalendar,
+        method: "POST",
+        url: "/admin/calendar",
+        postedData: url.Values{
+            "y": {"2050"},
+            "m": {"1"},
+            "block_1_2050-01-02": {"on"},
+            "block_3_2050-01-20": {"on"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/calendar?y=2050&m=1",
+    },
+    {
+        name: "save calendar with invalid month",
+        handler: (*Repository).AdminPostCalendar,
+        method: "POST",
+        url: "/admin/calendar",
+        postedData: url.Values{
+            "y": {"2050"},
+            "m": {"13"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/calendar",
+    },
+    {
+        name: "update rent opened from calendar",
+        handler: (*Repository).AdminPostShowRent,
+        method: "POST",
+        url: "/admin/rents/cal/1",
+        postedData: url.Values{
+            "first_name": {"John"},
+            "last_name": {"Doe"},
+            "email": {"john@doe.com"},
+        },
+        expectedResponseCode: http.StatusSeeOther,
+        expectedLocation: "/admin/calendar",
+    },
+}
+
+// TestOwnerBlockChanges tests diffing of owner blocks against the calendar
+// form
+func TestOwnerBlockChanges(t *testing.T) {
+    layout := "2006-01-02"
+    day := func(s string) time.Time {
+        d, _ := time.Parse(layout, s)
+        return d
+    }
+
+    monthStart := day("2050-01-01")
+    monthEnd := day("2050-02-01")
+
+    restrictions := []models.RentRestriction{
+        // reservation on the 1st
+        {ID: 1, StartDate: day("2050-01-01"), EndDate: day("2050-01-02"), RentID: 1, RestrictionID: models.RestrictionReservation},
+        // owner block from the 10th to the 12th
+        {ID: 2, StartDate: day("2050-01-10"), EndDate: day("2050-01-13"), RestrictionID: models.RestrictionOwnerBlock},
+        // owner block on the 20th
+        {ID: 3, StartDate: day("2050-01-20"), EndDate: day("2050-01-21"), RestrictionID: models.RestrictionOwnerBlock},
+        // owner block from the 31st into February
+        {ID: 4, StartDate: day("2050-01-31"), EndDate: day("2050-02-02"), RestrictionID: models.RestrictionOwnerBlock},
+        // imported block from the 25th to the 27th, it has no checkboxes
+        {ID: 5, StartDate: day("2050-01-25"), EndDate: day("2050-01-28"), RestrictionID: models.RestrictionOwnerBlock, ExternalUID: "a@test"},
+    }
+
+    // nothing changed
+    checked := map[string]bool{
+        "2050-01-10": true, "2050-01-11": true, "2050-01-12": true,
+        "2050-01-20": true, "2050-01-31": true,
+    }
+    addDays, removeIDs := ownerBlockChanges(restrictions, monthStart, monthEnd, checked)
+    if len(addDays) != 0 || len(removeIDs) != 0 {
+        t.Errorf("expected no changes, got add %v remove %v", addDays, removeIDs)
+    }
+
+    // unblock the 11th and the 31st, block the 1st (reserved), the 5th and
+    // the 26th (imported)
+    checked = map[string]bool{
+        "2050-01-01": true, "2050-01-05": true, "2050-01-26": true,
+        "2050-01-10": true, "2050-01-12": true,
+        "2050-01-20": true,
+    }
+    addDays, removeIDs = ownerBlockChanges(restrictions, monthStart, monthEnd, checked)
+
+    if !reflect.DeepEqual(removeIDs, []int{2, 4}) {
+        t.Errorf("expected blocks 2 and 4 to be removed, got %v", removeIDs)
+    }
+
+    var got []string
+    for _, d := range addDays {
+        got = append(got, d.Format(layout))
+    }
+    want := []string{"2050-01-10", "2050-01-12", "2050-02-01", "2050-01-05"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("expected days %v to be blocked, got %v", want, got)
+    }
+}
+
+// TestVehicleRestrictions tests splitting restrictions of a model by vehicle
+func TestVehicleRestrictions(t *testing.T) {
+    restrictions := []models.RentRestriction{
+        {ID: 1, VehicleID: 1},
+        {ID: 2, VehicleID: 3},
+        {ID: 3, VehicleID: 1},
+    }
+
+    var got []int
+    for _, rr := range vehicleRestrictions(restrictions, 1) {
+        got = append(got, rr.ID)
+    }
+    if !reflect.DeepEqual(got, []int{1, 3}) {
+        t.Errorf("expected restrictions 1 and 3 for vehicle 1, got %v", got)
+    }
+
+    if len(vehicleRestrictions(restrictions, 2)) != 0 {
+        t.Error("expected no restrictions for vehicle 2")
+    }
+}
+
+// TestTurnaroundDays tests the days kept free before and after a restriction
+func TestTurnaroundDays(t *testing.T) {
+    layout := "2006-01-02"
+    day := func(s string) time.Time {
+        d, _ := time.Parse(layout, s)
+        return d
+    }
+
+    var tests = []struct {
+        name string
+        rr models.RentRestriction
+        days int
+        expected []string
+    }{
+        {"no turnaround", models.RentRestriction{StartDate: day("2050-01-01"), EndDate: day("2050-01-03")}, 0, nil},
+        {"one day", models.RentRestriction{StartDate: day("2050-01-01"), EndDate: day("2050-01-03")}, 1, []string{"2049-12-31", "2050-01-03"}},
+        {"two days", models.RentRestriction{StartDate: day("2050-01-30"), EndDate: day("2050-01-31")}, 2, []string{"2050-01-28", "2050-01-29", "2050-01-31", "2050-02-01"}},
+        {"around a single day block", models.RentRestriction{StartDate: day("2050-01-05"), EndDate: day("2050-01-05")}, 1, []string{"2050-01-04", "2050-01-06"}},
+    }
+
+    for _, e := range tests {
+        var got []string
+        for _, d := range turnaroundDays(e.rr, e.days) {
+            got = append(got, d.Format(layout))
+        }
+        if !reflect.DeepEqual(got, e.expected) {
+            t.Errorf("for %s, expected %v but got %v", e.name, e.expected, got)
+        }
+    }
+}
+
+// TestAdminCalendarTurnaround tests that turnarounds are shown in the admin
+// calendar. Model 1 needs a day between rents, so its restrictions are
+// loaded from the last day of the previous month: vehicle 1 has a reservation
+// on that day and an owner block on the 1st and 2nd, followed by turnarounds
+// on the 1st and the 3rd. Vehicle 3 has an imported block on the 9th and
+// 10th with turnarounds on the 8th and the 11th.
+func TestAdminCalendarTurnaround(t *testing.T) {
+    r, _ := http.NewRequest("GET", "/admin/calendar?y=2050&m=1", nil)
+    r = r.WithContext(getCtx(r))
+    rr := httptest.NewRecorder()
+
+    http.HandlerFunc(Repo.AdminCalendar).ServeHTTP(rr, r)
+
+    if rr.Code != http.StatusOK {
+        t.Fatalf("expected %d but got %d", http.StatusOK, rr.Code)
+    }
+
+    body := rr.Body.String()
+    if strings.Count(body, `title="Turnaround"`) != 4 {
+        t.Errorf("expected turnarounds around the reservation and the owner blocks, got %d", strings.Count(body, `title="Turnaround"`))
+    }
+    if !strings.Contains(body, `class="table-info"`) {
+        t.Error("expected turnaround days to be highlighted")
+    }
+}
+
+// TestAdminCalendarImported tests that blocks imported from other calendars
+// can't be changed in the admin calendar
+func TestAdminCalendarImported(t *testing.T) {
+    r, _ := http.NewRequest("GET", "/admin/calendar?y=2050&m=1", nil)
+    r = r.WithContext(getCtx(r))
+    rr := httptest.NewRecorder()
+
+    http.HandlerFunc(Repo.AdminCalendar).ServeHTTP(rr, r)
+
+    if rr.Code != http.StatusOK {
+        t.Fatalf("expected %d but got %d", http.StatusOK, rr.Code)
+    }
+
+    body := rr.Body.String()
+    if strings.Count(body, `title="Imported from another calendar"`) != 2 {
+        t.Errorf("expected 2 imported days, got %d", strings.Count(body, `title="Imported from another calendar"`))
+    }
+    if strings.Contains(body, `name="block_3_2050-01-10"`) {
+        t.Error("expected no checkbox on imported days")
+    }
+}
+
+// TestAdminRent tests the admin handlers working on a single rent
+func TestAdminRent(t *testing.T) {
+    for _, e := range adminRentTests {
+        var r *http.Request
+        if e.postedData != nil {
+            r, _ = http.NewRequest(e.method, e.url, strings.NewReader(e.postedData.Encode()))
+        } else {
+            r, _ = http.NewRequest(e.method, e.url, nil)
+        }
+        // create context
+        ctx := getCtx(r)
+        // add context to request
+        r = r.WithContext(ctx)
+        // set content type
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        // create recorder
+        rr := httptest.NewRecorder()
+        e.handler(Repo, rr, r)
+
+        // test for status code
+        if rr.Code != e.expectedResponseCode {
+            t.Errorf("for %s, expected %d but got %d", e.name, e.expectedResponseCode, rr.Code)
+        }
+
+        // test for Location
+        if e.expectedLocation != "" {
+            headers := rr.Result().Header
+            if headers.Get("Location") != e.expectedLocation {
+                t.Errorf("for %s, expected %s but got %s", e.name, e.expectedLocation, headers.Get("Location"))
+            }
+        }
+    }
+}
+
+// TestAdminPostShowRentInvalidForm tests that the rent page shown again after
+// a validation error keeps its status controls and history
+func TestAdminPostShowRentInvalidForm(t *testing.T) {
+    postedData := url.Values{"first_name": {"John"}, "last_name": {"Doe"}}
+    r, _ := http.NewRequest("POST", "/admin/rents/new/1", strings.NewReader(postedData.Encode()))
+    r = r.WithContext(getCtx(r))
+    r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    rr := httptest.NewRecorder()
+
+    Repo.AdminPostShowRent(rr, r)
+
+    if rr.Code != http.StatusOK {
+        t.Errorf("expected %d but got %d", http.StatusOK, rr.Code)
+    }
+    for _, want := range []string{"Status history", "/admin/rent-status/new/1"} {
+        if !strings.Contains(rr.Body.String(), want) {
+            t.Errorf("expected %q on the page", want)
+        }
+    }
+}
 
 // TestNewRepo tests the NewRepo function
 func TestNewRepo(t *testing.T) {
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sanijo/rent-app/migrations"
+)
+
+// healthCheck is the result of a single check
+type healthCheck struct {
+    Status string `json:"status"`
+    LatencyMS float64 `json:"latency_ms"`
+    Error string `json:"error,omitempty"`
+}
+
+// healthReport is the response of /healthz and /readyz
+type healthReport struct {
+    Status string `json:"status"`
+    Checks map[string]healthCheck `json:"checks"`
+}
+
+// check is a named check, it returns nil if everything is fine
+type check struct {
+    name string
+    run func() error
+}
+
+// runChecks runs checks and writes the report, with status 503 if any check
+// failed
+func runChecks(w http.ResponseWriter, checks []check) {
+    report := healthReport{
+        Status: "ok",
+        Checks: make(map[string]healthCheck),
+    }
+
+    for _, c := range checks {
+        start := time.Now()
+        err := c.run()
+
+        result := healthCheck{
+            Status: "ok",
+            LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+        }
+        if err != nil {
+            result.Status = "fail"
+            result.Error = err.Error()
+            report.Status = "fail"
+        }
+        report.Checks[c.name] = result
+    }
+
+    status := http.StatusOK
+    if report.Status != "ok" {
+        status = http.StatusServiceUnavailable
+    }
+
+    out, _ := json.MarshalIndent(report, "", "    ")
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(status)
+    w.Write(out)
+}
+
+// Healthz reports that the process is alive
+func (m *Repository) Healthz(w http.ResponseWriter, r *http.Request) {
+    runChecks(w, []check{
+        {"process", func() error { return nil }},
+    })
+}
+
+// Readyz reports whether the app can serve requests: the database is
+// reachable, templates are loaded and all migrations have been run
+func (m *Repository) Readyz(w http.ResponseWriter, r *http.Request) {
+    runChecks(w, []check{
+        {"database", m.DB.Ping},
+        {"templates", m.checkTemplates},
+        {"migrations", m.checkMigrations},
+    })
+}
+
+// checkTemplates fails if the template cache wasn't loaded
+func (m *Repository) checkTemplates() error {
+    if len(m.App.TemplateCache) == 0 {
+        return errors.New("template cache is empty")
+    }
+    return nil
+}
+
+// checkMigrations fails if a migration embedded into the binary hasn't been
+// run
+func (m *Repository) checkMigrations() error {
+    versions, err := migrations.Versions()
+    if err != nil {
+        return err
+    }
+
+    applied, err := m.DB.AppliedMigrations()
+    if err != nil {
+        return err
+    }
+
+    done := make(map[string]bool)
+    for _, v := range applied {
+        done[v] = true
+    }
+
+    var pending []string
+    for _, v := range versions {
+        if !done[v] {
+            pending = append(pending, v)
+        }
+    }
+    if len(pending) > 0 {
+        return fmt.Errorf("%d pending migrations: %s", len(pending), strings.Join(pending, ", "))
+    }
+
+    return nil
+}
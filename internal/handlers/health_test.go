@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+    var tests = []struct {
+        name string
+        handler func(*Repository, http.ResponseWriter, *http.Request)
+        emptyCache bool
+        expectedStatusCode int
+        expectedChecks map[string]string
+    }{
+        {"healthz", (*Repository).Healthz, false, http.StatusOK, map[string]string{"process": "ok"}},
+        {"readyz", (*Repository).Readyz, false, http.StatusOK, map[string]string{"database": "ok", "templates": "ok", "migrations": "ok"}},
+        {"readyz without templates", (*Repository).Readyz, true, http.StatusServiceUnavailable, map[string]string{"database": "ok", "templates": "fail", "migrations": "ok"}},
+    }
+
+    for _, e := range tests {
+        cache := app.TemplateCache
+        if e.emptyCache {
+            app.TemplateCache = map[string]*template.Template{}
+        }
+
+        r, _ := http.NewRequest("GET", "/readyz", nil)
+        rr := httptest.NewRecorder()
+
+        e.handler(Repo, rr, r)
+        app.TemplateCache = cache
+
+        if rr.Code != e.expectedStatusCode {
+            t.Errorf("for %s, expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+        }
+
+        var report healthReport
+        err := json.Unmarshal(rr.Body.Bytes(), &report)
+        if err != nil {
+            t.Errorf("for %s, can't decode response: %s", e.name, err)
+            continue
+        }
+
+        if len(report.Checks) != len(e.expectedChecks) {
+            t.Errorf("for %s, expected %d checks, got %d", e.name, len(e.expectedChecks), len(report.Checks))
+        }
+        for name, status := range e.expectedChecks {
+            if report.Checks[name].Status != status {
+                t.Errorf("for %s, expected check %s to be %s, got %q", e.name, name, status, report.Checks[name].Status)
+            }
+        }
+    }
+}
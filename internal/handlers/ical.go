@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/ical"
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/render"
+	"github.com/sanijo/rent-app/internal/repository"
+)
+
+// maxICalBytes limits the size of imported calendars
+const maxICalBytes = 1 << 20
+
+// feeds contain restrictions from a year ago to two years ahead
+const (
+    feedYearsBack = 1
+    feedYearsAhead = 2
+)
+
+// feedToken returns the token that makes the calendar feed url of a model
+// private
+func (m *Repository) feedToken(modelID int) string {
+    mac := hmac.New(sha256.New, []byte(m.App.SecretKey))
+    fmt.Fprintf(mac, "ical-feed:%d", modelID)
+    return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// feedPath returns the private calendar feed path of a model
+func (m *Repository) feedPath(modelID int) string {
+    return fmt.Sprintf("/calendar/%d/%s.ics", modelID, m.feedToken(modelID))
+}
+
+// restrictionEvent converts a restriction to a calendar event
+func restrictionEvent(rr models.RentRestriction) ical.Event {
+    e := ical.Event{
+        UID: fmt.Sprintf("restriction-%d@rent-app", rr.ID),
+        Start: rr.StartDate,
+        End: rr.EndDate,
+        Description: fmt.Sprintf("Vehicle %d", rr.VehicleID),
+    }
+
+    switch {
+    case rr.RestrictionID == models.RestrictionReservation:
+        e.Summary = fmt.Sprintf("Reservation (rent %d)", rr.RentID)
+    case rr.RestrictionID == models.RestrictionHold:
+        e.Summary = "Hold"
+    case rr.ExternalUID != "":
+        e.Summary = "External booking"
+    default:
+        e.Summary = "Owner block"
+    }
+
+    return e
+}
+
+// turnaroundEvents converts the turnaround of days whole days before and
+// after a restriction to calendar events, booking keeps both free
+func turnaroundEvents(rr models.RentRestriction, days int) []ical.Event {
+    covered := restrictionDays(rr)
+    first := covered[0]
+    end := covered[len(covered)-1].AddDate(0, 0, 1)
+
+    return []ical.Event{
+        {
+            UID: fmt.Sprintf("turnaround-before-%d@rent-app", rr.ID),
+            Start: first.AddDate(0, 0, -days),
+            End: first,
+            Summary: "Turnaround",
+            Description: fmt.Sprintf("Vehicle %d", rr.VehicleID),
+        },
+        {
+            UID: fmt.Sprintf("turnaround-%d@rent-app", rr.ID),
+            Start: end,
+            End: end.AddDate(0, 0, days),
+            Summary: "Turnaround",
+            Description: fmt.Sprintf("Vehicle %d", rr.VehicleID),
+        },
+    }
+}
+
+// ICalFeed serves the reservations, owner blocks and turnarounds of a model as
+// iCalendar feed. The url has the form /calendar/{id}/{token}.ics.
+func (m *Repository) ICalFeed(w http.ResponseWriter, r *http.Request) {
+    exploded := strings.Split(r.URL.Path, "/")
+    if len(exploded) != 4 {
+        http.NotFound(w, r)
+        return
+    }
+
+    modelID, err := strconv.Atoi(exploded[2])
+    if err != nil {
+        http.NotFound(w, r)
+        return
+    }
+
+    token := strings.TrimSuffix(exploded[3], ".ics")
+    if !hmac.Equal([]byte(token), []byte(m.feedToken(modelID))) {
+        http.NotFound(w, r)
+        return
+    }
+
+    model, err := m.DB.GetModelByID(modelID)
+    if errors.Is(err, sql.ErrNoRows) {
+        http.NotFound(w, r)
+        return
+    }
+    if err != nil {
+        m.App.Logger.ErrorContext(r.Context(), "cannot load calendar feed", "model_id", modelID, "error", err)
+        http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+        return
+    }
+
+    now := time.Now()
+    restrictions, err := m.DB.GetRestrictionsForModelByDate(modelID, now.AddDate(-feedYearsBack, 0, 0), now.AddDate(feedYearsAhead, 0, 0))
+    if err != nil {
+        m.App.Logger.ErrorContext(r.Context(), "cannot load calendar feed", "model_id", modelID, "error", err)
+        http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+        return
+    }
+
+    c := ical.Calendar{Name: "Tesla " + model.ModelName}
+    for _, rr := range restrictions {
+        c.Events = append(c.Events, restrictionEvent(rr))
+        if model.TurnaroundDays() > 0 {
+            c.Events = append(c.Events, turnaroundEvents(rr, model.TurnaroundDays())...)
+        }
+    }
+
+    w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+    w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="model-%d.ics"`, modelID))
+    err = ical.Write(w, c, now)
+    if err != nil {
+        m.App.Logger.ErrorContext(r.Context(), "cannot write calendar feed", "model_id", modelID, "error", err)
+    }
+}
+
+// icalFeed is a row of the calendar sync page
+type icalFeed struct {
+    Model models.Model
+    URL string
+}
+
+// AdminICal shows the private calendar feed urls of all models and the form
+// to import calendars of other platforms
+func (m *Repository) AdminICal(w http.ResponseWriter, r *http.Request) {
+    carModels, err := m.DB.AllModels()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get models from database")
+        http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+        return
+    }
+
+    scheme := "http"
+    if r.TLS != nil {
+        scheme = "https"
+    }
+
+    var feeds []icalFeed
+    for _, model := range carModels {
+        feeds = append(feeds, icalFeed{
+            Model: model,
+            URL: fmt.Sprintf("%s://%s%s", scheme, r.Host, m.feedPath(model.ID)),
+        })
+    }
+
+    data := make(map[string]interface{})
+    data["feeds"] = feeds
+
+    render.Template(w, r, "admin-ical.page.html", &models.TemplateData{
+        Data: data,
+    })
+}
+
+// icalClient downloads calendars to import. It only connects to public
+// addresses and follows redirects to allowed hosts only, see readICalSource.
+var icalClient = &http.Client{
+    Timeout: 10 * time.Second,
+    Transport: &http.Transport{
+        DialContext: (&net.Dialer{
+            Timeout: 10 * time.Second,
+            Control: publicAddressOnly,
+        }).DialContext,
+    },
+}
+
+// publicAddressOnly refuses connections to loopback, private, link-local and
+// other non-public addresses, e.g. internal services or the cloud metadata
+// endpoint. It runs after name resolution, so a public name resolving to an
+// internal address is refused too.
+func publicAddressOnly(network, address string, c syscall.RawConn) error {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return err
+    }
+
+    ip := net.ParseIP(host)
+    if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+        ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+        return fmt.Errorf("address %s is not public", host)
+    }
+
+    return nil
+}
+
+// allowedICalHost returns true if calendars may be imported from host
+func (m *Repository) allowedICalHost(host string) bool {
+    for _, h := range m.App.ICalHosts {
+        if strings.EqualFold(h, host) {
+            return true
+        }
+    }
+    return false
+}
+
+// readICalSource returns the calendar uploaded as ics_file, or downloaded
+// from ics_url if no file was uploaded. Urls must point to one of the
+// configured calendar hosts.
+func (m *Repository) readICalSource(r *http.Request) ([]byte, error) {
+    file, _, err := r.FormFile("ics_file")
+    if err == nil {
+        defer file.Close()
+        return io.ReadAll(io.LimitReader(file, maxICalBytes))
+    }
+    if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+        return nil, err
+    }
+
+    u, err := url.Parse(r.Form.Get("ics_url"))
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return nil, errors.New("upload an .ics file or give an http(s) url")
+    }
+    if !m.allowedICalHost(u.Hostname()) {
+        return nil, fmt.Errorf("importing from %s is not allowed, upload an .ics file instead", u.Hostname())
+    }
+
+    client := *icalClient
+    client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+        if len(via) >= 5 {
+            return errors.New("too many redirects")
+        }
+        if !m.allowedICalHost(req.URL.Hostname()) {
+            return fmt.Errorf("redirect to %s is not allowed", req.URL.Hostname())
+        }
+        return nil
+    }
+
+    resp, err := client.Get(u.String())
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("%s returned %s", u.Host, resp.Status)
+    }
+
+    return io.ReadAll(io.LimitReader(resp.Body, maxICalBytes))
+}
+
+// AdminPostICal imports the events of an .ics file or url as owner blocks of
+// a model. Importing the same calendar again doesn't duplicate blocks.
+func (m *Repository) AdminPostICal(w http.ResponseWriter, r *http.Request) {
+    err := r.ParseMultipartForm(maxICalBytes)
+    if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+        m.App.Session.Put(r.Context(), "error", "Can't parse form")
+        http.Redirect(w, r, "/admin/ical", http.StatusSeeOther)
+        return
+    }
+
+    modelID, err := strconv.Atoi(r.Form.Get("model_id"))
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Invalid model")
+        http.Redirect(w, r, "/admin/ical", http.StatusSeeOther)
+        return
+    }
+
+    content, err := m.readICalSource(r)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Can't read calendar: %s", err))
+        http.Redirect(w, r, "/admin/ical", http.StatusSeeOther)
+        return
+    }
+
+    events, err := ical.Parse(bytes.NewReader(content))
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Invalid calendar: %s", err))
+        http.Redirect(w, r, "/admin/ical", http.StatusSeeOther)
+        return
+    }
+
+    imported, conflicts := 0, 0
+    for _, e := range events {
+        err = m.DB.UpsertExternalBlock(modelID, e.UID, e.Start, e.End)
+        if errors.Is(err, repository.ErrNotAvailable) {
+            conflicts++
+            continue
+        }
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't save imported events")
+            http.Redirect(w, r, "/admin/ical", http.StatusSeeOther)
+            return
+        }
+        imported++
+    }
+
+    if conflicts > 0 {
+        m.App.Session.Put(r.Context(), "warning", fmt.Sprintf("Imported %d events, %d overlap existing bookings of every vehicle and were skipped", imported, conflicts))
+    } else {
+        m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Imported %d events", imported))
+    }
+    http.Redirect(w, r, "/admin/ical", http.StatusSeeOther)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// icsContent is a calendar with a single event
+const icsContent = "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:%s\r\nDTSTART;VALUE=DATE:20500101\r\nDTEND;VALUE=DATE:20500103\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestICalFeed(t *testing.T) {
+    // feed paths depend on the secret key set up in TestMain
+    var tests = []struct {
+        name string
+        url string
+        expectedStatusCode int
+        expectedBody string
+    }{
+        {"valid feed", Repo.feedPath(1), http.StatusOK, "BEGIN:VEVENT"},
+        {"reservation summary", Repo.feedPath(1), http.StatusOK, "SUMMARY:Reservation (rent 1)"},
+        {"turnaround summary", Repo.feedPath(1), http.StatusOK, "SUMMARY:Turnaround"},
+        {"turnaround before a restriction", Repo.feedPath(1), http.StatusOK, "UID:turnaround-before-1@rent-app"},
+        {"turnaround after a restriction", Repo.feedPath(1), http.StatusOK, "UID:turnaround-1@rent-app"},
+        {"wrong token", "/calendar/1/0123456789abcdef0123456789abcdef.ics", http.StatusNotFound, ""},
+        {"token of another model", strings.Replace(Repo.feedPath(2), "/2/", "/1/", 1), http.StatusNotFound, ""},
+        {"non existent model", Repo.feedPath(3), http.StatusNotFound, ""},
+        {"invalid model id", "/calendar/x/token.ics", http.StatusNotFound, ""},
+        {"invalid path", "/calendar/1", http.StatusNotFound, ""},
+    }
+
+    for _, e := range tests {
+        r, _ := http.NewRequest("GET", e.url, nil)
+        rr := httptest.NewRecorder()
+
+        Repo.ICalFeed(rr, r)
+
+        if rr.Code != e.expectedStatusCode {
+            t.Errorf("for %s, expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+        }
+        if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+            t.Errorf("for %s, expected body to contain %q, got %q", e.name, e.expectedBody, rr.Body.String())
+        }
+    }
+}
+
+// icsUpload returns a multipart body uploading content as ics_file
+func icsUpload(modelID, content string) (*bytes.Buffer, string) {
+    var body bytes.Buffer
+    mw := multipart.NewWriter(&body)
+    mw.WriteField("model_id", modelID)
+    fw, _ := mw.CreateFormFile("ics_file", "calendar.ics")
+    fw.Write([]byte(content))
+    mw.Close()
+
+    return &body, mw.FormDataContentType()
+}
+
+func TestAdminPostICal(t *testing.T) {
+    // serves a calendar to import by url
+    ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/calendar.ics" {
+            http.NotFound(w, r)
+            return
+        }
+        fmt.Fprintf(w, icsContent, "remote@test")
+    }))
+    defer ts.Close()
+
+    // the test server listens on a loopback address, which the real client
+    // refuses
+    client := icalClient
+    icalClient = ts.Client()
+    app.ICalHosts = []string{"127.0.0.1"}
+    defer func() {
+        icalClient = client
+        app.ICalHosts = nil
+    }()
+
+    uploadBody := func(modelID, content string) func() (*bytes.Buffer, string) {
+        return func() (*bytes.Buffer, string) {
+            return icsUpload(modelID, content)
+        }
+    }
+    formBody := func(values url.Values) func() (*bytes.Buffer, string) {
+        return func() (*bytes.Buffer, string) {
+            return bytes.NewBufferString(values.Encode()), "application/x-www-form-urlencoded"
+        }
+    }
+
+    var tests = []struct {
+        name string
+        body func() (*bytes.Buffer, string)
+        expectedFlash string
+        expectedWarning string
+        expectedError string
+    }{
+        {"upload file", uploadBody("1", fmt.Sprintf(icsContent, "a@test")), "Imported 1 events", "", ""},
+        {"event overlaps bookings", uploadBody("1", fmt.Sprintf(icsContent, "taken@test")), "", "1 overlap", ""},
+        {"database error", uploadBody("2", fmt.Sprintf(icsContent, "a@test")), "", "", "Can't save imported events"},
+        {"invalid calendar", uploadBody("1", "BEGIN:VEVENT\r\n"), "", "", "Invalid calendar"},
+        {"invalid model", uploadBody("x", fmt.Sprintf(icsContent, "a@test")), "", "", "Invalid model"},
+        {"import url", formBody(url.Values{"model_id": {"1"}, "ics_url": {ts.URL + "/calendar.ics"}}), "Imported 1 events", "", ""},
+        {"url not found", formBody(url.Values{"model_id": {"1"}, "ics_url": {ts.URL + "/missing.ics"}}), "", "", "404"},
+        {"no file and no url", formBody(url.Values{"model_id": {"1"}}), "", "", "upload an .ics file"},
+        {"file url", formBody(url.Values{"model_id": {"1"}, "ics_url": {"file:///etc/passwd"}}), "", "", "upload an .ics file"},
+        {"host not allowed", formBody(url.Values{"model_id": {"1"}, "ics_url": {"http://169.254.169.254/latest/meta-data"}}), "", "", "not allowed"},
+    }
+
+    for _, e := range tests {
+        body, contentType := e.body()
+        r, _ := http.NewRequest("POST", "/admin/ical", body)
+        ctx := getCtx(r)
+        r = r.WithContext(ctx)
+        r.Header.Set("Content-Type", contentType)
+        rr := httptest.NewRecorder()
+
+        Repo.AdminPostICal(rr, r)
+
+        if rr.Code != http.StatusSeeOther {
+            t.Errorf("for %s, expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+        }
+
+        for key, want := range map[string]string{"flash": e.expectedFlash, "warning": e.expectedWarning, "error": e.expectedError} {
+            got := session.PopString(ctx, key)
+            if !strings.Contains(got, want) || (want == "" && got != "") {
+                t.Errorf("for %s, expected %s %q, got %q", e.name, key, want, got)
+            }
+        }
+    }
+}
+
+func TestPublicAddressOnly(t *testing.T) {
+    var tests = []struct {
+        address string
+        isError bool
+    }{
+        {"93.184.216.34:443", false},
+        {"[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+        {"127.0.0.1:80", true},
+        {"[::1]:80", true},
+        {"10.0.0.5:80", true},
+        {"192.168.1.1:80", true},
+        {"169.254.169.254:80", true},
+        {"0.0.0.0:80", true},
+        {"[fd00::1]:80", true},
+    }
+
+    for _, e := range tests {
+        err := publicAddressOnly("tcp", e.address, nil)
+        if (err != nil) != e.isError {
+            t.Errorf("for %s, expected error %v but got %v", e.address, e.isError, err)
+        }
+    }
+}
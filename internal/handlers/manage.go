@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/forms"
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+	"github.com/sanijo/rent-app/internal/pricing"
+	"github.com/sanijo/rent-app/internal/render"
+	"github.com/sanijo/rent-app/internal/rentstatus"
+	"github.com/sanijo/rent-app/internal/repository"
+)
+
+// changeCutoff is how long before pick-up a rent can still be changed or
+// cancelled
+const changeCutoff = 48 * time.Hour
+
+// manageLinkGrace is how long after the return date a manage link works
+const manageLinkGrace = 30 * 24 * time.Hour
+
+// referenceAlphabet leaves out characters that are easily confused, such as
+// 0 and O. Its length divides 256, so every character is equally likely.
+const referenceAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// referenceLength is the length of reference codes
+const referenceLength = 10
+
+// newReference returns a random reference code for a rent, e.g. K7QMX2RA9T
+func newReference() (string, error) {
+    b := make([]byte, referenceLength)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+
+    for i := range b {
+        b[i] = referenceAlphabet[int(b[i])%len(referenceAlphabet)]
+    }
+
+    return string(b), nil
+}
+
+// manageToken returns the token that signs the manage link of a rent until
+// expires
+func (m *Repository) manageToken(reference string, expires int64) string {
+    mac := hmac.New(sha256.New, []byte(m.App.SecretKey))
+    fmt.Fprintf(mac, "manage-booking:%s:%d", reference, expires)
+    return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// managePath returns the signed path of the manage page of a rent, or of one
+// of its actions such as "cancel". The link expires some time after the
+// return date.
+func (m *Repository) managePath(rent models.Rent, action string) string {
+    expires := rent.EndDate.Add(manageLinkGrace).Unix()
+
+    path := "/manage/" + rent.Reference
+    if action != "" {
+        path += "/" + action
+    }
+
+    return fmt.Sprintf("%s?expires=%d&token=%s", path, expires, m.manageToken(rent.Reference, expires))
+}
+
+// manageURL returns the absolute manage link of a rent, as used in emails
+func (m *Repository) manageURL(rent models.Rent) string {
+    return m.App.BaseURL + m.managePath(rent, "")
+}
+
+// canChange reports whether a rent can still be changed or cancelled at now.
+// Customers can change rents that could be cancelled, up to the cutoff.
+func canChange(rent models.Rent, now time.Time) bool {
+    return rentstatus.Check(rent, models.RentCancelled, now) == nil && now.Before(rent.StartDate.Add(-changeCutoff))
+}
+
+// manageRent returns the rent of a manage link after checking its token and
+// expiry. If the link isn't valid the customer is sent to the home page.
+func (m *Repository) manageRent(w http.ResponseWriter, r *http.Request) (models.Rent, bool) {
+    // split url by /, the 3rd element is the reference code
+    exploded := strings.Split(r.URL.Path, "/")
+    if len(exploded) < 3 {
+        http.NotFound(w, r)
+        return models.Rent{}, false
+    }
+    reference := exploded[2]
+
+    expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+    token := r.URL.Query().Get("token")
+    if err != nil || !hmac.Equal([]byte(token), []byte(m.manageToken(reference, expires))) {
+        m.App.Session.Put(r.Context(), "error", "Invalid booking link")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return models.Rent{}, false
+    }
+    if time.Now().Unix() > expires {
+        m.App.Session.Put(r.Context(), "error", "This booking link has expired")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return models.Rent{}, false
+    }
+
+    rent, err := m.DB.GetRentByReference(reference)
+    if errors.Is(err, sql.ErrNoRows) {
+        m.App.Session.Put(r.Context(), "error", "Booking not found")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return models.Rent{}, false
+    }
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get rent from database")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return models.Rent{}, false
+    }
+
+    return rent, true
+}
+
+// renderManage shows the manage page of a rent with the date change form
+func (m *Repository) renderManage(w http.ResponseWriter, r *http.Request, rent models.Rent, form *forms.Form) {
+    data := make(map[string]interface{})
+    data["rent"] = rent
+    data["canChange"] = canChange(rent, time.Now())
+    data["cutoff"] = rent.StartDate.Add(-changeCutoff)
+    data["datesURL"] = m.managePath(rent, "dates")
+    data["cancelURL"] = m.managePath(rent, "cancel")
+
+    render.Template(w, r, "manage.page.html", &models.TemplateData{
+        Form: form,
+        Data: data,
+    })
+}
+
+// ManageBooking is the page where customers view, change or cancel their
+// rent. The url has the form /manage/{reference}?expires=...&token=...
+func (m *Repository) ManageBooking(w http.ResponseWriter, r *http.Request) {
+    rent, ok := m.manageRent(w, r)
+    if !ok {
+        return
+    }
+
+    m.renderManage(w, r, rent, forms.New(nil))
+}
+
+// ManageChangeDates moves a rent to new dates if a vehicle of its model is
+// free. Paid rents can't get more expensive, the difference of cheaper dates
+// is refunded.
+func (m *Repository) ManageChangeDates(w http.ResponseWriter, r *http.Request) {
+    rent, ok := m.manageRent(w, r)
+    if !ok {
+        return
+    }
+
+    if !canChange(rent, time.Now()) {
+        m.App.Session.Put(r.Context(), "error", "This booking can no longer be changed")
+        http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+        return
+    }
+
+    err := r.ParseForm()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't parse form")
+        http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+        return
+    }
+
+    form := forms.New(r.PostForm)
+    form.Required("start_date", "end_date")
+
+    startDate, err := time.Parse(dateLayout, r.Form.Get("start_date"))
+    if err != nil && form.Errors.Get("start_date") == "" {
+        form.Errors.Add("start_date", "Invalid date")
+    }
+    endDate, err := time.Parse(dateLayout, r.Form.Get("end_date"))
+    if err != nil && form.Errors.Get("end_date") == "" {
+        form.Errors.Add("end_date", "Invalid date")
+    }
+    if form.Valid() {
+        if !time.Now().Before(startDate.Add(-changeCutoff)) {
+            form.Errors.Add("start_date", "Pick-up date must be at least 2 days from now")
+        }
+
+        model, err := m.DB.GetModelByID(rent.ModelID)
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't get model from database")
+            http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+            return
+        }
+        addViolations(form, m.checkRules(model, startDate, endDate), "_date")
+    }
+
+    var quote pricing.Quote
+    if form.Valid() {
+        quote, err = m.quote(rent.ModelID, startDate, endDate)
+        if err != nil {
+            m.App.Session.Put(r.Context(), "error", "Can't get price from database")
+            http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+            return
+        }
+
+        paid := rent.Status == models.RentConfirmed
+        if paid && quote.Total > rent.TotalPrice {
+            form.Errors.Add("end_date", fmt.Sprintf("The new dates cost %s more than you paid, please contact us", quote.Total-rent.TotalPrice))
+        }
+    }
+
+    if !form.Valid() {
+        m.renderManage(w, r, rent, form)
+        return
+    }
+
+    changed := rent
+    changed.StartDate = startDate
+    changed.EndDate = endDate
+    changed.TotalPrice = quote.Total
+
+    err = m.DB.ChangeRentDates(changed)
+    if errors.Is(err, repository.ErrNotAvailable) {
+        m.App.Session.Put(r.Context(), "error", "Sorry, no vehicle is available for the new dates")
+        http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+        return
+    }
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't change rent in database")
+        http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+        return
+    }
+
+    switch rent.Status {
+    case models.RentConfirmed:
+        if difference := rent.TotalPrice - changed.TotalPrice; difference > 0 {
+            m.refund(r.Context(), rent.ID, difference)
+        }
+    case models.RentPending:
+        // the open payment for the old price was cancelled with the change
+        if _, err := m.startPayment(changed); err != nil {
+            m.App.Logger.ErrorContext(r.Context(), "cannot start payment", "rent", rent.ID, "error", err)
+        }
+    }
+
+    m.App.Session.Put(r.Context(), "flash", "Your booking has been changed")
+    http.Redirect(w, r, m.managePath(changed, ""), http.StatusSeeOther)
+}
+
+// ManageCancel cancels a rent and refunds its payment
+func (m *Repository) ManageCancel(w http.ResponseWriter, r *http.Request) {
+    rent, ok := m.manageRent(w, r)
+    if !ok {
+        return
+    }
+
+    if !canChange(rent, time.Now()) {
+        m.App.Session.Put(r.Context(), "error", "This booking can no longer be cancelled")
+        http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+        return
+    }
+
+    // a failed refund is only logged, so that the owner can refund by hand
+    err := rentstatus.Cancel(m.DB, m.Payments, rent, "customer")
+    if errors.Is(err, rentstatus.ErrRefundFailed) {
+        m.App.Logger.ErrorContext(r.Context(), "cannot refund payment", "rent", rent.ID, "amount", rent.TotalPrice.String(), "error", err)
+    } else if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't cancel rent in database")
+        http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+        return
+    }
+
+    m.App.Session.Put(r.Context(), "flash", "Your booking has been cancelled")
+    http.Redirect(w, r, m.managePath(rent, ""), http.StatusSeeOther)
+}
+
+// refund pays back part of the captured payment of a rent, cancelled rents
+// are refunded in full by rentstatus.Cancel. Rents without a captured
+// payment are skipped. Failures are only logged, so that the owner can
+// refund by hand.
+func (m *Repository) refund(ctx context.Context, rentID int, amount models.Money) {
+    payment, err := m.DB.GetPaymentByRentID(rentID)
+    if errors.Is(err, sql.ErrNoRows) {
+        return
+    }
+    if err == nil && payment.Status != payments.StatusCaptured {
+        return
+    }
+    if err == nil {
+        err = m.Payments.Refund(payment.IntentID, amount)
+    }
+    if err != nil {
+        m.App.Logger.ErrorContext(ctx, "cannot refund payment", "rent", rentID, "amount", amount.String(), "error", err)
+    }
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+)
+
+// manageLink returns the signed manage path of a test rent with reference
+// ref, in the test repository all rents end on 2050-01-12
+func manageLink(ref, action string) string {
+    return Repo.managePath(models.Rent{
+        Reference: ref,
+        EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+    }, action)
+}
+
+func TestNewReference(t *testing.T) {
+    seen := make(map[string]bool)
+    for i := 0; i < 100; i++ {
+        ref, err := newReference()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(ref) != referenceLength || strings.Trim(ref, referenceAlphabet) != "" {
+            t.Errorf("invalid reference %q", ref)
+        }
+        if seen[ref] {
+            t.Errorf("reference %q returned twice", ref)
+        }
+        seen[ref] = true
+    }
+}
+
+func TestManageBooking(t *testing.T) {
+    expired := Repo.managePath(models.Rent{
+        Reference: "K7QMX2RA9T",
+        EndDate: time.Now().Add(-manageLinkGrace - 24*time.Hour),
+    }, "")
+
+    var tests = []struct {
+        name string
+        url string
+        expectedResponseCode int
+        expectedHTML string
+    }{
+        {"valid link", manageLink("K7QMX2RA9T", ""), http.StatusSeeOther, ""},
+        {"tampered reference", strings.Replace(manageLink("K7QMX2RA9T", ""), "K7QMX2RA9T", "K7QMX2RA9U", 1), http.StatusSeeOther, ""},
+        {"missing token", "/manage/K7QMX2RA9T", http.StatusSeeOther, ""},
+        {"expired link", expired, http.StatusSeeOther, ""},
+        {"unknown booking", manageLink("UNKNOWN", ""), http.StatusSeeOther, ""},
+    }
+
+    for _, e := range tests {
+        r, _ := http.NewRequest("GET", e.url, nil)
+        ctx := getCtx(r)
+        r = r.WithContext(ctx)
+        rr := httptest.NewRecorder()
+
+        http.HandlerFunc(Repo.ManageBooking).ServeHTTP(rr, r)
+
+        // only the valid link shows the page
+        if e.name == "valid link" {
+            if rr.Code != http.StatusOK {
+                t.Errorf("for %s, expected %d but got %d", e.name, http.StatusOK, rr.Code)
+            }
+            if !strings.Contains(rr.Body.String(), "Cancel booking") {
+                t.Errorf("for %s, expected the cancel form", e.name)
+            }
+            continue
+        }
+        if rr.Code != e.expectedResponseCode || rr.Header().Get("Location") != "/" {
+            t.Errorf("for %s, expected redirect home but got %d %s", e.name, rr.Code, rr.Header().Get("Location"))
+        }
+    }
+
+    // bookings picked up soon can't be changed any more
+    r, _ := http.NewRequest("GET", manageLink("SOON", ""), nil)
+    r = r.WithContext(getCtx(r))
+    rr := httptest.NewRecorder()
+    http.HandlerFunc(Repo.ManageBooking).ServeHTTP(rr, r)
+    if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "Cancel booking") {
+        t.Errorf("expected a booking picked up tomorrow to be read only")
+    }
+}
+
+func TestManageChangeDates(t *testing.T) {
+    var tests = []struct {
+        name string
+        ref string
+        start string
+        end string
+        expectedResponseCode int
+        expectedError string
+    }{
+        {"cheaper dates", "K7QMX2RA9T", "2050-01-10", "2050-01-11", http.StatusSeeOther, ""},
+        {"pending booking", "PENDING", "2050-01-10", "2050-01-13", http.StatusSeeOther, ""},
+        {"more expensive dates of a paid booking", "K7QMX2RA9T", "2050-01-10", "2050-01-20", http.StatusOK, "more than you paid"},
+        {"invalid date", "K7QMX2RA9T", "tomorrow", "2050-01-11", http.StatusOK, "Invalid date"},
+        {"end before start", "K7QMX2RA9T", "2050-01-11", "2050-01-10", http.StatusOK, "must be after"},
+        {"start in the past", "K7QMX2RA9T", "2020-01-10", "2020-01-11", http.StatusOK, "at least 2 days"},
+        {"rental too long", "K7QMX2RA9T", "2050-01-10", "2050-03-01", http.StatusOK, "maximum rental is 30 days"},
+        {"no vehicle free", "K7QMX2RA9T", "2050-02-01", "2050-02-02", http.StatusSeeOther, ""},
+        {"database error", "BROKEN", "2050-01-10", "2050-01-11", http.StatusSeeOther, ""},
+        {"too late to change", "SOON", "2050-01-10", "2050-01-11", http.StatusSeeOther, ""},
+        {"cancelled booking", "CANCELLED", "2050-01-10", "2050-01-11", http.StatusSeeOther, ""},
+    }
+
+    for _, e := range tests {
+        form := url.Values{"start_date": {e.start}, "end_date": {e.end}}
+        link := manageLink(e.ref, "dates")
+        if e.ref == "SOON" {
+            link = Repo.managePath(models.Rent{Reference: "SOON", EndDate: time.Now().AddDate(0, 0, 3)}, "dates")
+        }
+        r, _ := http.NewRequest("POST", link, strings.NewReader(form.Encode()))
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        r = r.WithContext(getCtx(r))
+        rr := httptest.NewRecorder()
+
+        http.HandlerFunc(Repo.ManageChangeDates).ServeHTTP(rr, r)
+
+        if rr.Code != e.expectedResponseCode {
+            t.Errorf("for %s, expected %d but got %d", e.name, e.expectedResponseCode, rr.Code)
+        }
+        if e.expectedError != "" && !strings.Contains(rr.Body.String(), e.expectedError) {
+            t.Errorf("for %s, expected %q in the page", e.name, e.expectedError)
+        }
+        if rr.Code == http.StatusSeeOther && !strings.HasPrefix(rr.Header().Get("Location"), "/manage/"+e.ref) {
+            t.Errorf("for %s, expected redirect to the manage page but got %s", e.name, rr.Header().Get("Location"))
+        }
+    }
+}
+
+func TestManageCancel(t *testing.T) {
+    var tests = []struct {
+        name string
+        ref string
+        expectedMessage string
+    }{
+        {"confirmed booking", "K7QMX2RA9T", "flash"},
+        {"paid booking, refund fails", "PAID", "flash"},
+        {"pending booking", "PENDING", "flash"},
+        {"database error", "BROKEN", "error"},
+        {"cancelled booking", "CANCELLED", "error"},
+    }
+
+    for _, e := range tests {
+        r, _ := http.NewRequest("POST", manageLink(e.ref, "cancel"), nil)
+        ctx := getCtx(r)
+        r = r.WithContext(ctx)
+        rr := httptest.NewRecorder()
+
+        http.HandlerFunc(Repo.ManageCancel).ServeHTTP(rr, r)
+
+        if rr.Code != http.StatusSeeOther {
+            t.Errorf("for %s, expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+        }
+        if !app.Session.Exists(ctx, e.expectedMessage) {
+            t.Errorf("for %s, expected a %s message", e.name, e.expectedMessage)
+        }
+    }
+}
+
+// TestCancelRefundsPaidRent tests that cancelling a paid rent refunds it, both
+// by the customer and by an admin
+func TestCancelRefundsPaidRent(t *testing.T) {
+    fake := Repo.Payments.(*payments.Fake)
+    defer func() { Repo.Payments = fake }()
+
+    var tests = []struct {
+        name string
+        url string
+        handler http.HandlerFunc
+        body url.Values
+    }{
+        {"customer", manageLink("PAID", "cancel"), Repo.ManageCancel, nil},
+        {"admin", "/admin/rent-status/all/6", Repo.AdminRentStatus, url.Values{"status": {"cancelled"}}},
+    }
+
+    for _, e := range tests {
+        provider := &recordingProvider{Fake: fake}
+        Repo.Payments = provider
+
+        r, _ := http.NewRequest("POST", e.url, strings.NewReader(e.body.Encode()))
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        ctx := getCtx(r)
+        r = r.WithContext(ctx)
+        rr := httptest.NewRecorder()
+
+        e.handler.ServeHTTP(rr, r)
+
+        if len(provider.refunds) != 1 || provider.refunds[0] != "pi_paid" {
+            t.Errorf("for %s, expected the payment to be refunded, got refunds %v", e.name, provider.refunds)
+        }
+        if !app.Session.Exists(ctx, "flash") {
+            t.Errorf("for %s, expected a flash message", e.name)
+        }
+    }
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+	"github.com/sanijo/rent-app/internal/render"
+	"github.com/sanijo/rent-app/internal/repository"
+)
+
+// newProvider returns the payment provider chosen in the config
+func newProvider(a *config.AppConfig) payments.Provider {
+    // the fake provider is the only one so far, config.Validate rejects
+    // anything else and the fake provider in production
+    return payments.NewFake(a.SecretKey)
+}
+
+// startPayment creates a payment intent for the total price of a pending rent
+// and stores it
+func (m *Repository) startPayment(rent models.Rent) (models.Payment, error) {
+    intent, err := m.Payments.CreateIntent(rent.TotalPrice, fmt.Sprintf("rent %d", rent.ID))
+    if err != nil {
+        return models.Payment{}, err
+    }
+
+    payment := models.Payment{
+        RentID: rent.ID,
+        Provider: m.Payments.Name(),
+        IntentID: intent.ID,
+        Amount: intent.Amount,
+        Currency: intent.Currency,
+        Status: payments.StatusPending,
+        CheckoutURL: intent.CheckoutURL,
+    }
+    payment.ID, err = m.DB.InsertPayment(payment)
+    if err != nil {
+        return models.Payment{}, err
+    }
+
+    return payment, nil
+}
+
+// Payment is the payment page of the rent in the session
+func (m *Repository) Payment(w http.ResponseWriter, r *http.Request) {
+    rent, ok := m.App.Session.Get(r.Context(), "rent").(models.Rent)
+    if !ok || rent.ID == 0 {
+        m.App.Session.Put(r.Context(), "error", "Can't get rent from session")
+        http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+        return
+    }
+
+    payment, err := m.DB.GetPaymentByRentID(rent.ID)
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't get payment from database")
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+        return
+    }
+
+    // nothing left to pay
+    if payment.Status == payments.StatusAuthorized || payment.Status == payments.StatusCaptured {
+        http.Redirect(w, r, "/rent-summary", http.StatusSeeOther)
+        return
+    }
+
+    data := make(map[string]interface{})
+    data["rent"] = rent
+    data["payment"] = payment
+    // the fake provider is paid with a form on our own page
+    data["fake"] = strings.HasPrefix(payment.CheckoutURL, payments.FakeCheckoutPath)
+
+    render.Template(w, r, "payment.page.html", &models.TemplateData{
+        Data: data,
+    })
+}
+
+// FakeCheckout pays or declines an intent of the fake provider, as chosen on
+// the payment page, and processes the resulting webhook
+func (m *Repository) FakeCheckout(w http.ResponseWriter, r *http.Request) {
+    fake, ok := m.Payments.(*payments.Fake)
+    if !ok {
+        http.NotFound(w, r)
+        return
+    }
+
+    exploded := strings.Split(r.URL.Path, "/")
+    intentID := exploded[len(exploded)-1]
+
+    err := r.ParseForm()
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Can't parse form")
+        http.Redirect(w, r, "/payment", http.StatusSeeOther)
+        return
+    }
+
+    var payload []byte
+    var signature string
+    if r.Form.Get("outcome") == "decline" {
+        payload, signature, err = fake.Decline(intentID)
+    } else {
+        payload, signature, err = fake.Pay(intentID)
+    }
+    if err != nil {
+        m.App.Session.Put(r.Context(), "error", "Payment failed, please try again")
+        http.Redirect(w, r, "/payment", http.StatusSeeOther)
+        return
+    }
+
+    err = m.processPaymentEvent(payload, signature)
+    if err != nil {
+        m.App.Logger.ErrorContext(r.Context(), "cannot process payment", "intent", intentID, "error", err)
+        m.App.Session.Put(r.Context(), "error", "Payment failed, please try again")
+        http.Redirect(w, r, "/payment", http.StatusSeeOther)
+        return
+    }
+
+    if r.Form.Get("outcome") == "decline" {
+        m.App.Session.Put(r.Context(), "error", "Your payment was declined, please try again")
+        http.Redirect(w, r, "/payment", http.StatusSeeOther)
+        return
+    }
+
+    http.Redirect(w, r, "/rent-summary", http.StatusSeeOther)
+}
+
+// PaymentWebhook receives signed notifications from the payment provider.
+// Errors make the provider deliver the webhook again later.
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+    payload, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes))
+    if err != nil {
+        http.Error(w, "Can't read body", http.StatusBadRequest)
+        return
+    }
+
+    err = m.processPaymentEvent(payload, r.Header.Get(payments.SignatureHeader))
+    switch {
+    case err == nil:
+        w.WriteHeader(http.StatusNoContent)
+    case errors.Is(err, payments.ErrInvalidSignature):
+        http.Error(w, "Invalid signature", http.StatusBadRequest)
+    case errors.Is(err, sql.ErrNoRows):
+        http.Error(w, "Unknown payment", http.StatusNotFound)
+    default:
+        m.App.Logger.ErrorContext(r.Context(), "cannot process payment webhook", "error", err)
+        http.Error(w, "Can't process webhook", http.StatusInternalServerError)
+    }
+}
+
+// processPaymentEvent verifies a webhook and applies its event. An authorized
+// payment is stored as such and captured, which confirms the rent and sends
+// the booking mails. A webhook delivered twice is applied once, and one
+// delivered again after the rent couldn't be confirmed confirms it without
+// capturing twice.
+func (m *Repository) processPaymentEvent(payload []byte, signature string) error {
+    event, err := m.Payments.VerifyWebhook(payload, signature)
+    if err != nil {
+        return err
+    }
+
+    payment, err := m.DB.GetPaymentByIntentID(m.Payments.Name(), event.IntentID)
+    if err != nil {
+        return err
+    }
+
+    switch event.Type {
+    case payments.EventAuthorized:
+        if payment.Status == payments.StatusCaptured {
+            return nil
+        }
+
+        rent, err := m.DB.GetRentByID(payment.RentID)
+        if err != nil {
+            return err
+        }
+        // the customer cancelled while paying, the authorization lapses. A
+        // payment that was refunded or failed before keeps its status.
+        if rent.Status == models.RentCancelled {
+            if payment.Status != payments.StatusPending && payment.Status != payments.StatusAuthorized {
+                return nil
+            }
+            return m.DB.UpdatePaymentStatus(payment.ID, payments.StatusFailed)
+        }
+
+        // the authorization is stored first, so that a failure from here on
+        // leaves a payment the provider can deliver the webhook for again.
+        // A payment replaced after the dates changed is for the old price,
+        // it is never captured and its authorization lapses.
+        if payment.Status != payments.StatusAuthorized {
+            err = m.DB.AuthorizePayment(payment.ID)
+            if errors.Is(err, repository.ErrPaymentSuperseded) {
+                return nil
+            }
+            if err != nil {
+                return err
+            }
+        }
+
+        err = m.Payments.Capture(payment.IntentID)
+        if err != nil && !errors.Is(err, payments.ErrAlreadyCaptured) {
+            return fmt.Errorf("cannot capture payment: %w", err)
+        }
+
+        // the check above races with cancelling, the rent is only confirmed
+        // if it is still pending, otherwise the money is paid back
+        err = m.DB.ConfirmPayment(payment.ID)
+        if errors.Is(err, repository.ErrStatusChanged) {
+            err = m.Payments.Refund(payment.IntentID, payment.Amount)
+            if err != nil {
+                return fmt.Errorf("cannot refund payment of cancelled rent: %w", err)
+            }
+            return m.DB.UpdatePaymentStatus(payment.ID, payments.StatusRefunded)
+        }
+        if err != nil {
+            return err
+        }
+
+        rent.Status = models.RentConfirmed
+        m.sendBookingMail(rent)
+
+    case payments.EventFailed:
+        if payment.Status != payments.StatusPending {
+            return nil
+        }
+
+        return m.DB.UpdatePaymentStatus(payment.ID, payments.StatusFailed)
+    }
+
+    // other events are of no interest
+    return nil
+}
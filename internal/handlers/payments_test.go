@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+)
+
+// signedEvent returns a webhook payload for an event and its signature
+func signedEvent(eventType, intentID string) ([]byte, string) {
+    payload, _ := json.Marshal(payments.Event{
+        Type: eventType,
+        IntentID: intentID,
+        Amount: 16000,
+    })
+    return payload, payments.Sign([]byte(app.SecretKey), payload, time.Now())
+}
+
+// TestPayment tests the Payment handler
+func TestPayment(t *testing.T) {
+    var tests = []struct {
+        name string
+        rent *models.Rent
+        expectedResponseCode int
+        expectedLocation string
+    }{
+        {"pending rent", &models.Rent{ID: 1, ModelID: 1}, http.StatusOK, ""},
+        {"rent not in session", nil, http.StatusTemporaryRedirect, "/"},
+        {"rent not stored yet", &models.Rent{ModelID: 1}, http.StatusTemporaryRedirect, "/"},
+        {"payment not in database", &models.Rent{ID: 3, ModelID: 1}, http.StatusSeeOther, "/"},
+    }
+
+    for _, e := range tests {
+        r, _ := http.NewRequest("GET", "/payment", nil)
+        ctx := getCtx(r)
+        r = r.WithContext(ctx)
+        if e.rent != nil {
+            session.Put(ctx, "rent", *e.rent)
+        }
+        rr := httptest.NewRecorder()
+
+        http.HandlerFunc(Repo.Payment).ServeHTTP(rr, r)
+
+        if rr.Code != e.expectedResponseCode {
+            t.Errorf("for %s, expected %d but got %d", e.name, e.expectedResponseCode, rr.Code)
+        }
+        if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+            t.Errorf("for %s, expected location %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+        }
+        if rr.Code == http.StatusOK && !strings.Contains(rr.Body.String(), payments.FakeCheckoutPath+"pi_test") {
+            t.Errorf("for %s, expected the checkout form in the page", e.name)
+        }
+    }
+}
+
+// TestPaymentWebhook tests the PaymentWebhook handler
+func TestPaymentWebhook(t *testing.T) {
+    fake := Repo.Payments.(*payments.Fake)
+
+    // an intent the fake provider has authorized, so that it can be captured
+    paid, err := fake.CreateIntent(16000, "rent 1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := fake.Pay(paid.ID); err != nil {
+        t.Fatal(err)
+    }
+
+    // an intent captured by an earlier delivery whose rent wasn't confirmed
+    captured, _ := fake.CreateIntent(16000, "rent 1")
+    fake.Pay(captured.ID)
+    if err := fake.Capture(captured.ID); err != nil {
+        t.Fatal(err)
+    }
+
+    _, authorizedSig := signedEvent(payments.EventAuthorized, paid.ID)
+
+    var tests = []struct {
+        name string
+        eventType string
+        intentID string
+        signature string
+        expectedResponseCode int
+    }{
+        {"authorized payment", payments.EventAuthorized, paid.ID, "", http.StatusNoContent},
+        {"authorized payment delivered twice", payments.EventAuthorized, "pi_captured", "", http.StatusNoContent},
+        {"captured at the provider before", payments.EventAuthorized, captured.ID, "", http.StatusNoContent},
+        {"payment replaced by a newer one", payments.EventAuthorized, "pi_superseded", "", http.StatusNoContent},
+        {"rent cancelled while paying", payments.EventAuthorized, "pi_rent_cancelled", "", http.StatusNoContent},
+        {"refunded payment delivered again", payments.EventAuthorized, "pi_refunded", "", http.StatusNoContent},
+        {"failed payment", payments.EventFailed, "pi_test", "", http.StatusNoContent},
+        {"failed payment not stored", payments.EventFailed, "pi_broken", "", http.StatusInternalServerError},
+        {"capture fails", payments.EventAuthorized, "pi_broken", "", http.StatusInternalServerError},
+        {"unknown payment", payments.EventAuthorized, "pi_unknown", "", http.StatusNotFound},
+        {"other event", "payment.created", "pi_test", "", http.StatusNoContent},
+        {"signature of another payload", payments.EventFailed, "pi_test", authorizedSig, http.StatusBadRequest},
+        {"missing signature", payments.EventAuthorized, paid.ID, "none", http.StatusBadRequest},
+    }
+
+    for _, e := range tests {
+        payload, signature := signedEvent(e.eventType, e.intentID)
+        switch e.signature {
+        case "":
+        case "none":
+            signature = ""
+        default:
+            signature = e.signature
+        }
+
+        r, _ := http.NewRequest("POST", "/payment/webhook", bytes.NewReader(payload))
+        r.Header.Set(payments.SignatureHeader, signature)
+        rr := httptest.NewRecorder()
+
+        http.HandlerFunc(Repo.PaymentWebhook).ServeHTTP(rr, r)
+
+        if rr.Code != e.expectedResponseCode {
+            t.Errorf("for %s, expected %d but got %d", e.name, e.expectedResponseCode, rr.Code)
+        }
+    }
+
+    intent, _ := fake.Intent(paid.ID)
+    if intent.Status != payments.StatusCaptured {
+        t.Errorf("expected the authorized payment to be captured, got %s", intent.Status)
+    }
+}
+
+// TestFakeCheckout tests the FakeCheckout handler
+func TestFakeCheckout(t *testing.T) {
+    fake := Repo.Payments.(*payments.Fake)
+
+    pay, _ := fake.CreateIntent(16000, "rent 1")
+    decline, _ := fake.CreateIntent(16000, "rent 1")
+
+    var tests = []struct {
+        name string
+        intentID string
+        outcome string
+        expectedLocation string
+    }{
+        {"pay", pay.ID, "pay", "/rent-summary"},
+        {"pay again", pay.ID, "pay", "/payment"},
+        {"decline", decline.ID, "decline", "/payment"},
+        {"unknown intent", "pi_unknown", "pay", "/payment"},
+    }
+
+    for _, e := range tests {
+        form := url.Values{"outcome": {e.outcome}}
+        r, _ := http.NewRequest("POST", payments.FakeCheckoutPath+e.intentID, strings.NewReader(form.Encode()))
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        ctx := getCtx(r)
+        r = r.WithContext(ctx)
+        rr := httptest.NewRecorder()
+
+        http.HandlerFunc(Repo.FakeCheckout).ServeHTTP(rr, r)
+
+        if rr.Code != http.StatusSeeOther {
+            t.Errorf("for %s, expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+        }
+        if rr.Header().Get("Location") != e.expectedLocation {
+            t.Errorf("for %s, expected location %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+        }
+    }
+
+    intent, _ := fake.Intent(decline.ID)
+    if intent.Status != payments.StatusFailed {
+        t.Errorf("expected the declined intent to fail, got %s", intent.Status)
+    }
+}
+
+// recordingProvider is the fake provider, but captures and refunds any intent
+// and records the refunds
+type recordingProvider struct {
+    *payments.Fake
+    refunds []string
+}
+
+func (p *recordingProvider) Capture(intentID string) error {
+    return nil
+}
+
+func (p *recordingProvider) Refund(intentID string, amount models.Money) error {
+    p.refunds = append(p.refunds, intentID)
+    return nil
+}
+
+// TestPaymentWebhookCancelledRent tests that a payment of a rent cancelled
+// while paying is refunded instead of confirming the rent
+func TestPaymentWebhookCancelledRent(t *testing.T) {
+    fake := Repo.Payments.(*payments.Fake)
+    provider := &recordingProvider{Fake: fake}
+    Repo.Payments = provider
+    defer func() { Repo.Payments = fake }()
+
+    payload, signature := signedEvent(payments.EventAuthorized, "pi_cancelled")
+    r, _ := http.NewRequest("POST", "/payment/webhook", bytes.NewReader(payload))
+    r.Header.Set(payments.SignatureHeader, signature)
+    rr := httptest.NewRecorder()
+
+    http.HandlerFunc(Repo.PaymentWebhook).ServeHTTP(rr, r)
+
+    if rr.Code != http.StatusNoContent {
+        t.Errorf("expected %d but got %d", http.StatusNoContent, rr.Code)
+    }
+    if len(provider.refunds) != 1 || provider.refunds[0] != "pi_cancelled" {
+        t.Errorf("expected the payment to be refunded, got refunds %v", provider.refunds)
+    }
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -16,22 +17,31 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
 	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/logging"
 	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/pricing"
 	"github.com/sanijo/rent-app/internal/render"
+	"github.com/sanijo/rent-app/internal/rules"
 )
 
 
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
-var functions = template.FuncMap{}
+var functions = render.Functions()
 
 func TestMain(m *testing.M) {
     // What to put in session
     gob.Register(models.Rent{})
+    gob.Register(pricing.Quote{})
+    gob.Register(models.RentRestriction{})
 
     // Change to true if in production
     app.InProduction = false
+    app.SecretKey = "test-secret-key-0123"
+    app.HoldDuration = 15 * time.Minute
+    // no booking horizon, the tests use fixed dates in the future
+    app.Booking = rules.Rules{MinDays: 1, MaxDays: 30}
 
     session = scs.New()
     session.Lifetime = 24 * time.Hour
@@ -39,15 +49,17 @@ func TestMain(m *testing.M) {
     session.Cookie.SameSite = http.SameSiteLaxMode
     session.Cookie.Secure = app.InProduction // in production: true
 
-    // Set up info and error loggers
-    infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-    app.InfoLog = infoLog
-    errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-    app.ErrorLog = errorLog
+    // Set up logger
+    app.Logger = logging.New(os.Stdout, "text", slog.LevelInfo)
 
     // Set pointer in config to session so that is available in program
     app.Session = session
 
+    // Set up mail channel and drain it, no mail is sent in tests
+    mailChan := make(chan models.MailData)
+    app.MailChan = mailChan
+    listenForMail()
+
     tc, err := CreateTestTemplateCache()
 	if err != nil {
         log.Fatal("cannot create template cache")
@@ -68,6 +80,14 @@ func TestMain(m *testing.M) {
     os.Exit(m.Run())
 }
 
+// listenForMail discards messages sent to the mail channel
+func listenForMail() {
+    go func() {
+        for range app.MailChan {
+        }
+    }()
+}
+
 func getRoutes() http.Handler {
     mux := chi.NewRouter()
 
@@ -87,10 +107,38 @@ func getRoutes() http.Handler {
     mux.Get("/rent", Repo.Rent)
     mux.Post("/rent", Repo.PostRent)
     mux.Get("/rent-summary", Repo.RentSummary)
+    mux.Get("/payment", Repo.Payment)
+    mux.Post("/payment/fake/{intent}", Repo.FakeCheckout)
+    mux.Post("/payment/webhook", Repo.PaymentWebhook)
+
+    mux.Get("/manage/{reference}", Repo.ManageBooking)
+    mux.Post("/manage/{reference}/dates", Repo.ManageChangeDates)
+    mux.Post("/manage/{reference}/cancel", Repo.ManageCancel)
 
     mux.Get("/about", Repo.About)
     mux.Get("/contact", Repo.Contact)
 
+    mux.Get("/user/login", Repo.ShowLogin)
+    mux.Post("/user/login", Repo.PostShowLogin)
+    mux.Post("/user/logout", Repo.Logout)
+
+    mux.Get("/calendar/{id}/{file}", Repo.ICalFeed)
+
+    mux.Route("/api/v1", func(mux chi.Router) {
+        mux.Get("/models", Repo.APIListModels)
+        mux.Get("/models/{id}", Repo.APIGetModel)
+        mux.Get("/availability", Repo.APIAvailability)
+        mux.Post("/bookings", Repo.APICreateBooking)
+        mux.Get("/bookings/{id}", Repo.APIGetBooking)
+    })
+
+    mux.Get("/admin/dashboard", Repo.AdminDashboard)
+    mux.Get("/admin/rents-new", Repo.AdminNewRents)
+    mux.Get("/admin/rents-all", Repo.AdminAllRents)
+    mux.Get("/admin/rents/{src}/{id}", Repo.AdminShowRent)
+    mux.Get("/admin/calendar", Repo.AdminCalendar)
+    mux.Get("/admin/ical", Repo.AdminICal)
+
     // In static folder are all things that are not html template such as JS,
     // figures
     filesServer := http.FileServer(http.Dir("./static/"))
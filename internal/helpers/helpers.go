@@ -1,11 +1,11 @@
 package helpers
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 
 	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/models"
 )
 
 
@@ -17,17 +17,33 @@ func NewHelpers(a *config.AppConfig) {
 }
 
 // ClientError logs client errors
-func CilentError(w http.ResponseWriter, status int) {
-    app.InfoLog.Println("Client error. Status:", status)
+func CilentError(w http.ResponseWriter, r *http.Request, status int) {
+    app.Logger.InfoContext(r.Context(), "client error",
+        "status", status,
+        "method", r.Method,
+        "path", r.URL.Path)
     http.Error(w, http.StatusText(status), status)
 }
 
-// ServerError logs server errors
-func ServerError(w http.ResponseWriter, err error) {
-    trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-    app.ErrorLog.Println(trace)
+// ServerError logs server errors together with the stack trace
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+    app.Logger.ErrorContext(r.Context(), "server error",
+        "error", err,
+        "method", r.Method,
+        "path", r.URL.Path,
+        "stack", string(debug.Stack()))
     http.Error(
         w, 
         http.StatusText(http.StatusInternalServerError),
         http.StatusInternalServerError)
 }
+
+// IsAuthenticated returns true if a user is logged in
+func IsAuthenticated(r *http.Request) bool {
+    return app.Session.Exists(r.Context(), "user_id")
+}
+
+// IsAdmin returns true if the logged in user may access the admin area
+func IsAdmin(r *http.Request) bool {
+    return app.Session.GetInt(r.Context(), "access_level") >= models.AccessLevelAdmin
+}
@@ -0,0 +1,136 @@
+// Package holds releases the vehicle holds of customers who never finished
+// the rent form, and the vehicles of rents that were never paid
+package holds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/repository"
+)
+
+// Releaser deletes expired holds and cancels unpaid rents, it is implemented
+// by repository.DatabaseRepo
+type Releaser interface {
+    DeleteExpiredHolds(now time.Time) (int, error)
+    UnpaidRentsBefore(before time.Time) ([]int, error)
+    UpdateRentStatus(id int, from, to, changedBy string) error
+}
+
+// Sweeper releases expired holds every interval
+type Sweeper struct {
+    releaser Releaser
+    interval time.Duration
+    logger *slog.Logger
+    stop chan struct{}
+    done chan struct{}
+    // PaymentTimeout is how long a pending rent may wait for its payment
+    // before it is cancelled, zero keeps pending rents
+    PaymentTimeout time.Duration
+}
+
+// NewSweeper returns a sweeper that releases the expired holds of r every
+// interval once started
+func NewSweeper(r Releaser, interval time.Duration, logger *slog.Logger) *Sweeper {
+    return &Sweeper{
+        releaser: r,
+        interval: interval,
+        logger: logger,
+    }
+}
+
+// Start starts a goroutine that sweeps every interval until Stop is called
+func (s *Sweeper) Start() {
+    s.stop = make(chan struct{})
+    s.done = make(chan struct{})
+
+    go func() {
+        defer close(s.done)
+
+        ticker := time.NewTicker(s.interval)
+        defer ticker.Stop()
+
+        for {
+            select {
+            case <-s.stop:
+                return
+            case <-ticker.C:
+                s.Sweep()
+            }
+        }
+    }()
+}
+
+// Sweep releases the holds that have expired by now and cancels the rents
+// that weren't paid in time, and returns how many holds and rents there were
+func (s *Sweeper) Sweep() int {
+    return s.releaseHolds() + s.cancelUnpaid()
+}
+
+// releaseHolds releases the holds that have expired by now and returns how
+// many there were
+func (s *Sweeper) releaseHolds() int {
+    n, err := s.releaser.DeleteExpiredHolds(time.Now())
+    if err != nil {
+        s.logger.Error("cannot release expired holds", "error", err)
+        return 0
+    }
+    if n > 0 {
+        s.logger.Info("released expired holds", "count", n)
+    }
+
+    return n
+}
+
+// cancelUnpaid cancels the pending rents whose payment timeout has passed,
+// which releases their vehicles, and returns how many there were
+func (s *Sweeper) cancelUnpaid() int {
+    if s.PaymentTimeout <= 0 {
+        return 0
+    }
+
+    ids, err := s.releaser.UnpaidRentsBefore(time.Now().Add(-s.PaymentTimeout))
+    if err != nil {
+        s.logger.Error("cannot get unpaid rents", "error", err)
+        return 0
+    }
+
+    n := 0
+    for _, id := range ids {
+        err := s.releaser.UpdateRentStatus(id, models.RentPending, models.RentCancelled, "payment timeout")
+        // paid or cancelled in the meantime
+        if errors.Is(err, repository.ErrStatusChanged) {
+            continue
+        }
+        if err != nil {
+            s.logger.Error("cannot cancel unpaid rent", "rent", id, "error", err)
+            continue
+        }
+        n++
+    }
+    if n > 0 {
+        s.logger.Info("cancelled unpaid rents", "count", n)
+    }
+
+    return n
+}
+
+// Stop stops the sweeper and waits until a running sweep is finished or ctx
+// is done
+func (s *Sweeper) Stop(ctx context.Context) error {
+    if s.stop == nil {
+        return nil
+    }
+    close(s.stop)
+
+    select {
+    case <-s.done:
+        return nil
+    case <-ctx.Done():
+        return fmt.Errorf("hold sweeper: %w", ctx.Err())
+    }
+}
@@ -0,0 +1,159 @@
+package holds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/repository"
+)
+
+// fakeReleaser counts sweeps and releases n holds per sweep, or fails with
+// err. Its unpaid rents are cancelled unless their status changed.
+type fakeReleaser struct {
+    mu sync.Mutex
+    sweeps int
+    n int
+    err error
+    block chan struct{}
+    unpaid []int
+    changed map[int]bool
+    before time.Time
+    cancelled []int
+}
+
+func (f *fakeReleaser) DeleteExpiredHolds(now time.Time) (int, error) {
+    if f.block != nil {
+        <-f.block
+    }
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.sweeps++
+
+    return f.n, f.err
+}
+
+func (f *fakeReleaser) UnpaidRentsBefore(before time.Time) ([]int, error) {
+    f.before = before
+    return f.unpaid, f.err
+}
+
+func (f *fakeReleaser) UpdateRentStatus(id int, from, to, changedBy string) error {
+    if f.changed[id] {
+        return repository.ErrStatusChanged
+    }
+    if from != models.RentPending || to != models.RentCancelled {
+        return fmt.Errorf("unexpected change from %s to %s", from, to)
+    }
+    f.cancelled = append(f.cancelled, id)
+    return nil
+}
+
+func (f *fakeReleaser) count() int {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    return f.sweeps
+}
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestSweep(t *testing.T) {
+    var tests = []struct {
+        name string
+        releaser *fakeReleaser
+        expected int
+    }{
+        {"expired holds", &fakeReleaser{n: 3}, 3},
+        {"nothing expired", &fakeReleaser{}, 0},
+        {"database error", &fakeReleaser{n: 3, err: errors.New("some error")}, 0},
+    }
+
+    for _, e := range tests {
+        s := NewSweeper(e.releaser, time.Minute, testLogger)
+        if n := s.Sweep(); n != e.expected {
+            t.Errorf("for %s, expected %d released holds but got %d", e.name, e.expected, n)
+        }
+    }
+}
+
+func TestSweepUnpaidRents(t *testing.T) {
+    var tests = []struct {
+        name string
+        releaser *fakeReleaser
+        timeout time.Duration
+        expected []int
+    }{
+        {"unpaid rents", &fakeReleaser{unpaid: []int{1, 2}}, time.Hour, []int{1, 2}},
+        {"paid in the meantime", &fakeReleaser{unpaid: []int{1, 2}, changed: map[int]bool{1: true}}, time.Hour, []int{2}},
+        {"no timeout", &fakeReleaser{unpaid: []int{1, 2}}, 0, nil},
+        {"database error", &fakeReleaser{unpaid: []int{1, 2}, err: errors.New("some error")}, time.Hour, nil},
+    }
+
+    for _, e := range tests {
+        s := NewSweeper(e.releaser, time.Minute, testLogger)
+        s.PaymentTimeout = e.timeout
+        n := s.Sweep()
+        if n != len(e.expected) || fmt.Sprint(e.releaser.cancelled) != fmt.Sprint(e.expected) {
+            t.Errorf("for %s, expected %v cancelled but got %v", e.name, e.expected, e.releaser.cancelled)
+        }
+        if e.timeout > 0 && e.releaser.err == nil && time.Since(e.releaser.before) < e.timeout {
+            t.Errorf("for %s, expected rents unpaid for %s, got since %s", e.name, e.timeout, e.releaser.before)
+        }
+    }
+}
+
+func TestStartStop(t *testing.T) {
+    f := &fakeReleaser{}
+    s := NewSweeper(f, time.Millisecond, testLogger)
+
+    s.Start()
+    deadline := time.Now().Add(time.Second)
+    for f.count() < 2 && time.Now().Before(deadline) {
+        time.Sleep(time.Millisecond)
+    }
+    if f.count() < 2 {
+        t.Fatalf("expected the sweeper to run repeatedly, it ran %d times", f.count())
+    }
+
+    if err := s.Stop(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    n := f.count()
+    time.Sleep(10 * time.Millisecond)
+    if f.count() != n {
+        t.Error("expected no sweeps after Stop")
+    }
+}
+
+func TestStopTimeout(t *testing.T) {
+    f := &fakeReleaser{block: make(chan struct{})}
+    defer close(f.block)
+
+    s := NewSweeper(f, time.Millisecond, testLogger)
+    s.Start()
+    // give the ticker time to start a sweep that blocks
+    time.Sleep(10 * time.Millisecond)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+    defer cancel()
+
+    err := s.Stop(ctx)
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("expected deadline exceeded, got %v", err)
+    }
+}
+
+func TestStopNotStarted(t *testing.T) {
+    s := NewSweeper(&fakeReleaser{}, time.Minute, testLogger)
+    if err := s.Stop(context.Background()); err != nil {
+        t.Errorf("expected no error, got %v", err)
+    }
+}
@@ -0,0 +1,239 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// dateLayout is the iCalendar DATE value format, e.g. 20500102
+const dateLayout = "20060102"
+
+// maxLineLength is the maximum length of a content line in octets, longer
+// lines are folded
+const maxLineLength = 75
+
+// Event is an all day event covering the days [Start, End)
+type Event struct {
+    UID string
+    Start time.Time
+    End time.Time
+    Summary string
+    Description string
+}
+
+// Calendar is a named list of events
+type Calendar struct {
+    Name string
+    Events []Event
+}
+
+// Write writes c as an iCalendar (RFC 5545) stream. stamp is used as DTSTAMP
+// of every event.
+func Write(w io.Writer, c Calendar, stamp time.Time) error {
+    bw := bufio.NewWriter(w)
+
+    writeLine(bw, "BEGIN:VCALENDAR")
+    writeLine(bw, "VERSION:2.0")
+    writeLine(bw, "PRODID:-//eRent//rent-app//EN")
+    writeLine(bw, "CALSCALE:GREGORIAN")
+    writeLine(bw, "METHOD:PUBLISH")
+    if c.Name != "" {
+        writeLine(bw, "X-WR-CALNAME:"+escapeText(c.Name))
+    }
+
+    for _, e := range c.Events {
+        end := e.End
+        if !end.After(e.Start) {
+            end = e.Start.AddDate(0, 0, 1)
+        }
+
+        writeLine(bw, "BEGIN:VEVENT")
+        writeLine(bw, "UID:"+escapeText(e.UID))
+        writeLine(bw, "DTSTAMP:"+stamp.UTC().Format("20060102T150405Z"))
+        writeLine(bw, "DTSTART;VALUE=DATE:"+e.Start.Format(dateLayout))
+        writeLine(bw, "DTEND;VALUE=DATE:"+end.Format(dateLayout))
+        writeLine(bw, "SUMMARY:"+escapeText(e.Summary))
+        if e.Description != "" {
+            writeLine(bw, "DESCRIPTION:"+escapeText(e.Description))
+        }
+        writeLine(bw, "TRANSP:OPAQUE")
+        writeLine(bw, "END:VEVENT")
+    }
+
+    writeLine(bw, "END:VCALENDAR")
+
+    return bw.Flush()
+}
+
+// writeLine writes a content line terminated by CRLF, folding it after
+// maxLineLength octets without splitting UTF-8 characters
+func writeLine(w *bufio.Writer, line string) {
+    limit := maxLineLength
+    for len(line) > limit {
+        cut := limit
+        // back up to the start of a UTF-8 character
+        for cut > 0 && line[cut]&0xC0 == 0x80 {
+            cut--
+        }
+        w.WriteString(line[:cut])
+        w.WriteString("\r\n ")
+        line = line[cut:]
+        // continuation lines start with a space
+        limit = maxLineLength - 1
+    }
+    w.WriteString(line)
+    w.WriteString("\r\n")
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+    r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+    return r.Replace(s)
+}
+
+// unescapeText reverses escapeText
+func unescapeText(s string) string {
+    r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+    return r.Replace(s)
+}
+
+// Parse reads the VEVENTs of an iCalendar stream. Only the properties needed
+// for blocking days are read: UID, DTSTART, DTEND, SUMMARY and DESCRIPTION.
+// Date-time values are cut down to their date. An event without DTEND covers
+// a single day.
+func Parse(r io.Reader) ([]Event, error) {
+    lines, err := unfold(r)
+    if err != nil {
+        return nil, err
+    }
+
+    var events []Event
+    var event *Event
+    var hasEnd bool
+
+    for n, line := range lines {
+        name, params, value, ok := splitLine(line)
+        if !ok {
+            continue
+        }
+
+        switch {
+        case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+            event = &Event{}
+            hasEnd = false
+        case name == "END" && strings.EqualFold(value, "VEVENT"):
+            if event == nil {
+                return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", n+1)
+            }
+            if event.UID == "" {
+                return nil, fmt.Errorf("line %d: event without UID", n+1)
+            }
+            if event.Start.IsZero() {
+                return nil, fmt.Errorf("line %d: event %s without DTSTART", n+1, event.UID)
+            }
+            if !hasEnd || !event.End.After(event.Start) {
+                event.End = event.Start.AddDate(0, 0, 1)
+            }
+            events = append(events, *event)
+            event = nil
+        case event == nil:
+            // calendar properties and other components are ignored
+        case name == "UID":
+            event.UID = unescapeText(value)
+        case name == "SUMMARY":
+            event.Summary = unescapeText(value)
+        case name == "DESCRIPTION":
+            event.Description = unescapeText(value)
+        case name == "DTSTART":
+            event.Start, err = parseDate(value, params)
+            if err != nil {
+                return nil, fmt.Errorf("line %d: %w", n+1, err)
+            }
+        case name == "DTEND":
+            event.End, err = parseDate(value, params)
+            if err != nil {
+                return nil, fmt.Errorf("line %d: %w", n+1, err)
+            }
+            hasEnd = true
+        }
+    }
+
+    if event != nil {
+        return nil, errors.New("unterminated VEVENT")
+    }
+
+    return events, nil
+}
+
+// unfold reads content lines, joining folded lines
+func unfold(r io.Reader) ([]string, error) {
+    var lines []string
+
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        line := strings.TrimRight(scanner.Text(), "\r")
+        if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+            lines[len(lines)-1] += line[1:]
+            continue
+        }
+        lines = append(lines, line)
+    }
+
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+
+    return lines, nil
+}
+
+// splitLine splits a content line into its upper-cased name, parameters and
+// value
+func splitLine(line string) (string, string, string, bool) {
+    colon := strings.Index(line, ":")
+    if colon < 0 {
+        return "", "", "", false
+    }
+
+    name, params, _ := strings.Cut(line[:colon], ";")
+
+    return strings.ToUpper(name), params, line[colon+1:], true
+}
+
+// parseDate parses a DATE or DATE-TIME value and returns its date in UTC.
+// Date-times with a TZID are taken as local time of that zone.
+func parseDate(value, params string) (time.Time, error) {
+    loc := time.UTC
+    for _, p := range strings.Split(params, ";") {
+        k, v, _ := strings.Cut(p, "=")
+        if strings.EqualFold(k, "TZID") {
+            if l, err := time.LoadLocation(strings.Trim(v, `"`)); err == nil {
+                loc = l
+            }
+        }
+    }
+
+    if len(value) < len(dateLayout) {
+        return time.Time{}, fmt.Errorf("invalid date %q", value)
+    }
+
+    var t time.Time
+    var err error
+    switch {
+    case len(value) == len(dateLayout):
+        t, err = time.Parse(dateLayout, value)
+    case strings.HasSuffix(value, "Z"):
+        t, err = time.Parse("20060102T150405Z", value)
+    default:
+        t, err = time.ParseInLocation("20060102T150405", value, loc)
+    }
+    if err != nil {
+        return time.Time{}, fmt.Errorf("invalid date %q", value)
+    }
+
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
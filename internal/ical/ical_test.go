@@ -0,0 +1,151 @@
+package ical
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+    d, _ := time.Parse("2006-01-02", s)
+    return d
+}
+
+func TestWrite(t *testing.T) {
+    var buf bytes.Buffer
+
+    c := Calendar{
+        Name: "Tesla Model 3",
+        Events: []Event{
+            {
+                UID: "restriction-1@erent",
+                Start: date("2050-01-01"),
+                End: date("2050-01-03"),
+                Summary: "Reservation, rent 7",
+            },
+            {
+                UID: "restriction-2@erent",
+                Start: date("2050-01-05"),
+                End: date("2050-01-05"),
+                Summary: "Owner block",
+                Description: strings.Repeat("x", 100),
+            },
+        },
+    }
+
+    err := Write(&buf, c, time.Date(2049, 12, 1, 10, 0, 0, 0, time.UTC))
+    if err != nil {
+        t.Fatal(err)
+    }
+    out := buf.String()
+
+    for _, want := range []string{
+        "BEGIN:VCALENDAR\r\n",
+        "X-WR-CALNAME:Tesla Model 3\r\n",
+        "DTSTAMP:20491201T100000Z\r\n",
+        "DTSTART;VALUE=DATE:20500101\r\nDTEND;VALUE=DATE:20500103\r\n",
+        "SUMMARY:Reservation\\, rent 7\r\n",
+        // events without a positive length cover a single day
+        "DTSTART;VALUE=DATE:20500105\r\nDTEND;VALUE=DATE:20500106\r\n",
+        "END:VCALENDAR\r\n",
+    } {
+        if !strings.Contains(out, want) {
+            t.Errorf("expected output to contain %q, got %q", want, out)
+        }
+    }
+
+    for _, line := range strings.Split(out, "\r\n") {
+        if len(line) > maxLineLength {
+            t.Errorf("line longer than %d octets: %q", maxLineLength, line)
+        }
+    }
+}
+
+func TestWriteParse(t *testing.T) {
+    events := []Event{
+        {
+            UID: "restriction-1@erent",
+            Start: date("2050-01-01"),
+            End: date("2050-01-03"),
+            Summary: "Reservation; rent 7",
+            Description: strings.Repeat("čćž ", 40),
+        },
+    }
+
+    var buf bytes.Buffer
+    err := Write(&buf, Calendar{Events: events}, time.Now())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    got, err := Parse(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, events) {
+        t.Errorf("expected %v, got %v", events, got)
+    }
+}
+
+var parseTests = []struct {
+    name string
+    input string
+    expected []Event
+    expectedError bool
+}{
+    {
+        name: "date values",
+        input: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:a@b\nDTSTART;VALUE=DATE:20500101\nDTEND;VALUE=DATE:20500104\nSUMMARY:Booked\nEND:VEVENT\nEND:VCALENDAR\n",
+        expected: []Event{{UID: "a@b", Start: date("2050-01-01"), End: date("2050-01-04"), Summary: "Booked"}},
+    },
+    {
+        name: "date-time values and folded uid",
+        input: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:abc\r\n def@example.com\r\nDTSTART:20500101T150000Z\r\nDTEND;TZID=Europe/Zagreb:20500103T100000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+        expected: []Event{{UID: "abcdef@example.com", Start: date("2050-01-01"), End: date("2050-01-03")}},
+    },
+    {
+        name: "missing end covers one day",
+        input: "BEGIN:VEVENT\nUID:x\nDTSTART;VALUE=DATE:20500101\nEND:VEVENT\n",
+        expected: []Event{{UID: "x", Start: date("2050-01-01"), End: date("2050-01-02")}},
+    },
+    {
+        name: "other components are ignored",
+        input: "BEGIN:VCALENDAR\nBEGIN:VTIMEZONE\nTZID:Europe/Zagreb\nEND:VTIMEZONE\nEND:VCALENDAR\n",
+    },
+    {
+        name: "missing uid",
+        input: "BEGIN:VEVENT\nDTSTART;VALUE=DATE:20500101\nEND:VEVENT\n",
+        expectedError: true,
+    },
+    {
+        name: "invalid date",
+        input: "BEGIN:VEVENT\nUID:x\nDTSTART;VALUE=DATE:2050-01-01\nEND:VEVENT\n",
+        expectedError: true,
+    },
+    {
+        name: "unterminated event",
+        input: "BEGIN:VEVENT\nUID:x\nDTSTART;VALUE=DATE:20500101\n",
+        expectedError: true,
+    },
+}
+
+func TestParse(t *testing.T) {
+    for _, e := range parseTests {
+        got, err := Parse(strings.NewReader(e.input))
+        if e.expectedError {
+            if err == nil {
+                t.Errorf("for %s, expected an error, but got nil", e.name)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("for %s, unexpected error: %s", e.name, err)
+            continue
+        }
+        if !reflect.DeepEqual(got, e.expected) {
+            t.Errorf("for %s, expected %v, got %v", e.name, e.expected, got)
+        }
+    }
+}
@@ -0,0 +1,65 @@
+// Package logging sets up the structured application logger and carries the
+// request id of a request through its context.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+)
+
+// ctxKey is the context key of the request id
+type ctxKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestID returns the request id carried by ctx, or an empty string
+func RequestID(ctx context.Context) string {
+    id, _ := ctx.Value(ctxKey{}).(string)
+    return id
+}
+
+// NewRequestID returns a random request id
+func NewRequestID() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// New returns a logger writing to w in text or json format. Records logged
+// with a context, e.g. with ErrorContext, get the request id of the context.
+func New(w io.Writer, format string, level slog.Level) *slog.Logger {
+    opts := &slog.HandlerOptions{Level: level}
+
+    var h slog.Handler = slog.NewTextHandler(w, opts)
+    if format == "json" {
+        h = slog.NewJSONHandler(w, opts)
+    }
+
+    return slog.New(contextHandler{h})
+}
+
+// contextHandler adds the request id of the context to every record
+type contextHandler struct {
+    slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+    if id := RequestID(ctx); id != "" {
+        r.AddAttrs(slog.String("request_id", id))
+    }
+    return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+    return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+    ctx := WithRequestID(context.Background(), "abc")
+    if got := RequestID(ctx); got != "abc" {
+        t.Errorf("expected abc, got %q", got)
+    }
+    if got := RequestID(context.Background()); got != "" {
+        t.Errorf("expected empty request id, got %q", got)
+    }
+
+    if id := NewRequestID(); len(id) != 16 || id == NewRequestID() {
+        t.Errorf("expected random 16 character ids, got %q", id)
+    }
+}
+
+func TestNew(t *testing.T) {
+    var buf bytes.Buffer
+    logger := New(&buf, "json", slog.LevelInfo).With("component", "test")
+
+    ctx := WithRequestID(context.Background(), "abc")
+    logger.ErrorContext(ctx, "something failed", "error", "boom")
+    logger.Debug("not logged")
+
+    lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+    if len(lines) != 1 {
+        t.Fatalf("expected 1 line, got %d: %s", len(lines), buf.String())
+    }
+
+    var record map[string]interface{}
+    err := json.Unmarshal([]byte(lines[0]), &record)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for key, want := range map[string]string{"msg": "something failed", "error": "boom", "component": "test", "request_id": "abc"} {
+        if record[key] != want {
+            t.Errorf("expected %s %q, got %v", key, want, record[key])
+        }
+    }
+
+    buf.Reset()
+    New(&buf, "text", slog.LevelDebug).Debug("hello", "n", 1)
+    if !strings.Contains(buf.String(), "msg=hello n=1") {
+        t.Errorf("expected text record, got %s", buf.String())
+    }
+}
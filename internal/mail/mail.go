@@ -0,0 +1,169 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/render"
+	"github.com/sanijo/rent-app/templates"
+)
+
+var app *config.AppConfig
+var transport Transport
+
+// listenerDone is closed when the mail listener has sent every message
+var listenerDone chan struct{}
+
+// listenerStop is closed to tell the mail listener to send what is queued
+// and return
+var listenerStop chan struct{}
+
+// Message is a rendered email ready to be handed to a transport
+type Message struct {
+    From string
+    To string
+    Subject string
+    HTMLBody string
+    Date time.Time
+}
+
+// NewMail sets the app config and the transport used by the mail package
+func NewMail(a *config.AppConfig, t Transport) {
+    app = a
+    transport = t
+}
+
+// ListenForMail starts a goroutine that sends every message arriving on the
+// app mail channel, until StopListening is called or the channel is closed
+func ListenForMail() {
+    done := make(chan struct{})
+    stop := make(chan struct{})
+    listenerDone = done
+    listenerStop = stop
+
+    go func() {
+        defer close(done)
+        for {
+            select {
+            case msg, ok := <-app.MailChan:
+                if !ok {
+                    return
+                }
+                send(msg)
+            case <-stop:
+                drain()
+                return
+            }
+        }
+    }()
+}
+
+// drain sends the messages already queued on the app mail channel
+func drain() {
+    for {
+        select {
+        case msg, ok := <-app.MailChan:
+            if !ok {
+                return
+            }
+            send(msg)
+        default:
+            return
+        }
+    }
+}
+
+// send sends msg and logs if it can't be sent
+func send(msg models.MailData) {
+    err := sendMsg(msg)
+    if err != nil {
+        app.Logger.Error("cannot send email", "to", msg.To, "subject", msg.Subject, "error", err)
+    }
+}
+
+// StopListening tells the mail listener to stop and waits until the messages
+// already queued are sent or ctx is done. The mail channel is not closed, so
+// that a request still running after a timed out shutdown can't panic on it.
+// Messages sent after the listener stopped are not delivered.
+func StopListening(ctx context.Context) error {
+    if listenerDone == nil {
+        return nil
+    }
+    close(listenerStop)
+
+    select {
+    case <-listenerDone:
+        return nil
+    case <-ctx.Done():
+        return fmt.Errorf("mail listener: %d messages not sent: %w", len(app.MailChan), ctx.Err())
+    }
+}
+
+// sendMsg renders msg and hands it to the transport
+func sendMsg(m models.MailData) error {
+    message, err := Render(m)
+    if err != nil {
+        return err
+    }
+
+    return transport.Send(message)
+}
+
+// Render builds a Message from mail data. If a template is set, the body is
+// the template executed with the mail data, otherwise it is Content.
+func Render(m models.MailData) (Message, error) {
+    message := Message{
+        From: m.From,
+        To: m.To,
+        Subject: m.Subject,
+        HTMLBody: m.Content,
+        Date: time.Now(),
+    }
+
+    if m.Template == "" {
+        return message, nil
+    }
+
+    fsys := fs.FS(templates.FS)
+    if app != nil && app.TemplateFS != nil {
+        fsys = app.TemplateFS
+    }
+
+    t, err := template.New(path.Base(m.Template)).Funcs(render.Functions()).ParseFS(fsys, path.Join("email", m.Template))
+    if err != nil {
+        return message, fmt.Errorf("cannot parse email template %s: %w", m.Template, err)
+    }
+
+    buffer := new(bytes.Buffer)
+    err = t.Execute(buffer, m)
+    if err != nil {
+        return message, fmt.Errorf("cannot execute email template %s: %w", m.Template, err)
+    }
+
+    message.HTMLBody = buffer.String()
+
+    return message, nil
+}
+
+// Bytes returns the message in RFC 5322 format with an HTML body
+func (m Message) Bytes() []byte {
+    var b bytes.Buffer
+
+    fmt.Fprintf(&b, "From: %s\r\n", m.From)
+    fmt.Fprintf(&b, "To: %s\r\n", m.To)
+    fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+    fmt.Fprintf(&b, "Date: %s\r\n", m.Date.Format(time.RFC1123Z))
+    b.WriteString("MIME-Version: 1.0\r\n")
+    b.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+    b.WriteString("\r\n")
+    b.WriteString(m.HTMLBody)
+
+    return b.Bytes()
+}
@@ -0,0 +1,195 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/logging"
+	"github.com/sanijo/rent-app/internal/models"
+)
+
+var testApp config.AppConfig
+
+func TestMain(m *testing.M) {
+    testApp.Logger = logging.New(os.Stdout, "text", slog.LevelInfo)
+
+    os.Exit(m.Run())
+}
+
+func testRent() models.Rent {
+    return models.Rent{
+        FirstName: "John",
+        LastName: "Doe",
+        Email: "john@doe.com",
+        StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+        EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+        Model: models.Model{
+            ModelName: "Model 3",
+        },
+    }
+}
+
+func TestRender(t *testing.T) {
+    // Case 1: plain content
+    msg, err := Render(models.MailData{
+        To: "john@doe.com",
+        From: "rent@erent.com",
+        Subject: "Hello",
+        Content: "<p>Hello</p>",
+    })
+    if err != nil {
+        t.Error(err)
+    }
+    if msg.HTMLBody != "<p>Hello</p>" {
+        t.Errorf("expected content as body, got %s", msg.HTMLBody)
+    }
+
+    // Case 2: template
+    data := make(map[string]interface{})
+    data["rent"] = testRent()
+
+    msg, err = Render(models.MailData{
+        To: "john@doe.com",
+        From: "rent@erent.com",
+        Subject: "Rent confirmation",
+        Template: "rent-confirmation.html",
+        Data: data,
+    })
+    if err != nil {
+        t.Error(err)
+    }
+    if !strings.Contains(msg.HTMLBody, "Mon, 3 Jan 2050") {
+        t.Errorf("expected return date in body, got %s", msg.HTMLBody)
+    }
+
+    // Case 3: non-existent template
+    _, err = Render(models.MailData{Template: "non-existent.html"})
+    if err == nil {
+        t.Error("expected an error, but got nil")
+    }
+}
+
+func TestMessage_Bytes(t *testing.T) {
+    msg := Message{
+        From: "rent@erent.com",
+        To: "john@doe.com",
+        Subject: "Hello",
+        HTMLBody: "<p>Hello</p>",
+        Date: time.Now(),
+    }
+
+    out := string(msg.Bytes())
+    for _, want := range []string{"To: john@doe.com\r\n", "Subject: Hello\r\n", "text/html", "\r\n\r\n<p>Hello</p>"} {
+        if !strings.Contains(out, want) {
+            t.Errorf("expected %q in message, got %s", want, out)
+        }
+    }
+}
+
+func TestFileTransport(t *testing.T) {
+    dir := t.TempDir()
+    ft := &FileTransport{Dir: filepath.Join(dir, "mail")}
+
+    err := ft.Send(Message{To: "john@doe.com", Subject: "Hello", Date: time.Now()})
+    if err != nil {
+        t.Error(err)
+    }
+
+    err = ft.Send(Message{To: "../../x/y@doe.com", Subject: "Hello", Date: time.Now()})
+    if err != nil {
+        t.Error(err)
+    }
+
+    files, _ := filepath.Glob(filepath.Join(dir, "mail", "*.eml"))
+    if len(files) != 2 {
+        t.Errorf("expected 2 files, got %d", len(files))
+    }
+
+    entries, _ := os.ReadDir(dir)
+    if len(entries) != 1 {
+        t.Errorf("expected only the mail directory in %s, got %d entries", dir, len(entries))
+    }
+}
+
+func TestListenForMail(t *testing.T) {
+    mt := &MemoryTransport{}
+    testApp.MailChan = make(chan models.MailData)
+    NewMail(&testApp, mt)
+    ListenForMail()
+
+    testApp.MailChan <- models.MailData{To: "john@doe.com", Content: "first"}
+    testApp.MailChan <- models.MailData{To: "owner@erent.com", Content: "second"}
+    close(testApp.MailChan)
+
+    // wait for the listener to hand over the last message
+    deadline := time.Now().Add(time.Second)
+    for len(mt.Messages()) < 2 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    messages := mt.Messages()
+    if len(messages) != 2 {
+        t.Fatalf("expected 2 messages, got %d", len(messages))
+    }
+    if messages[1].To != "owner@erent.com" {
+        t.Errorf("expected second message to owner@erent.com, got %s", messages[1].To)
+    }
+}
+
+// blockingTransport doesn't return until release is closed
+type blockingTransport struct {
+    release chan struct{}
+}
+
+func (t *blockingTransport) Send(m Message) error {
+    <-t.release
+    return nil
+}
+
+func TestStopListening(t *testing.T) {
+    // Case 1: queued messages are sent before StopListening returns
+    mt := &MemoryTransport{}
+    testApp.MailChan = make(chan models.MailData, 10)
+    NewMail(&testApp, mt)
+    ListenForMail()
+
+    for i := 0; i < 3; i++ {
+        testApp.MailChan <- models.MailData{To: "john@doe.com", Content: "queued"}
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    err := StopListening(ctx)
+    if err != nil {
+        t.Error(err)
+    }
+    if len(mt.Messages()) != 3 {
+        t.Errorf("expected 3 messages, got %d", len(mt.Messages()))
+    }
+
+    // a request still running after shutdown can send without a panic
+    testApp.MailChan <- models.MailData{To: "john@doe.com", Content: "late"}
+
+    // Case 2: a transport that hangs doesn't block shutdown forever
+    bt := &blockingTransport{release: make(chan struct{})}
+    defer close(bt.release)
+    testApp.MailChan = make(chan models.MailData, 10)
+    NewMail(&testApp, bt)
+    ListenForMail()
+
+    testApp.MailChan <- models.MailData{To: "john@doe.com", Content: "stuck"}
+
+    ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    err = StopListening(ctx)
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("expected deadline exceeded, got %v", err)
+    }
+}
@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Transport delivers rendered messages
+type Transport interface {
+    Send(m Message) error
+}
+
+// SMTPTransport sends messages through an SMTP server. For development a
+// local stand-in such as MailHog on localhost:1025 can be used.
+type SMTPTransport struct {
+    Host string
+    Port int
+    Username string
+    Password string
+}
+
+// Send sends the message through the SMTP server
+func (t *SMTPTransport) Send(m Message) error {
+    addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+
+    var auth smtp.Auth
+    if t.Username != "" {
+        auth = smtp.PlainAuth("", t.Username, t.Password, t.Host)
+    }
+
+    return smtp.SendMail(addr, auth, m.From, []string{m.To}, m.Bytes())
+}
+
+// FileTransport writes every message as an .eml file into Dir, so that mail
+// can be inspected without any mail server running
+type FileTransport struct {
+    Dir string
+}
+
+// Send writes the message into a new file in Dir
+func (t *FileTransport) Send(m Message) error {
+    err := os.MkdirAll(t.Dir, 0755)
+    if err != nil {
+        return err
+    }
+
+    name := fmt.Sprintf("%s-%s.eml", m.Date.Format("20060102-150405.000000000"), fileSafe(m.To))
+
+    return os.WriteFile(filepath.Join(t.Dir, name), m.Bytes(), 0644)
+}
+
+// fileSafe replaces every character of s that is not a letter, a digit or one of
+// "@.+-" with "_", so that the recipient can't add path elements to a file name
+func fileSafe(s string) string {
+    return strings.Map(func(r rune) rune {
+        switch {
+        case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+            return r
+        case r == '@' || r == '.' || r == '+' || r == '-':
+            return r
+        }
+        return '_'
+    }, s)
+}
+
+// MemoryTransport keeps sent messages in memory. It is meant for tests.
+type MemoryTransport struct {
+    mu sync.Mutex
+    messages []Message
+}
+
+// Send stores the message
+func (t *MemoryTransport) Send(m Message) error {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    t.messages = append(t.messages, m)
+
+    return nil
+}
+
+// Messages returns a copy of all messages sent so far
+func (t *MemoryTransport) Messages() []Message {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    messages := make([]Message, len(t.messages))
+    copy(messages, t.messages)
+
+    return messages
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Default is the registry served on /metrics
+var Default = NewRegistry()
+
+// HTTP metrics, route is the chi route pattern, e.g. /admin/rents/{src}/{id}
+var (
+    HTTPRequests = Default.NewCounterVec("http_requests_total",
+        "HTTP requests by method, route pattern and status code.",
+        "method", "route", "status")
+    HTTPDuration = Default.NewHistogramVec("http_request_duration_seconds",
+        "HTTP request latency by method and route pattern.",
+        DefBuckets, "method", "route")
+)
+
+// DBQueryDuration is the duration of repository methods
+var DBQueryDuration = Default.NewHistogramVec("db_query_duration_seconds",
+    "Duration of database queries by repository method.",
+    DefBuckets, "method")
+
+// Business metrics, source is web or api
+var (
+    AvailabilitySearches = Default.NewCounterVec("availability_searches_total",
+        "Availability searches.",
+        "source")
+    EmptySearches = Default.NewCounterVec("availability_searches_empty_total",
+        "Availability searches without any free vehicle.",
+        "source")
+    BookingsCreated = Default.NewCounterVec("bookings_created_total",
+        "Bookings stored in the database.",
+        "source")
+    BookingFailures = Default.NewCounterVec("booking_failures_total",
+        "Booking attempts that failed, by reason.",
+        "source", "reason")
+)
+
+// Booking failure reasons
+const (
+    ReasonInvalid = "invalid"
+    ReasonNotAvailable = "not_available"
+    ReasonPrice = "price"
+    ReasonDatabase = "database"
+)
+
+// ObserveQuery records the duration of a repository method since start, it is
+// meant to be deferred
+func ObserveQuery(method string, start time.Time) {
+    DBQueryDuration.Observe(time.Since(start).Seconds(), method)
+}
+
+// RegisterDBStats exposes the connection pool statistics of db
+func RegisterDBStats(r *Registry, db *sql.DB) {
+    r.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+        return float64(db.Stats().MaxOpenConnections)
+    })
+    r.NewGaugeFunc("db_open_connections", "Established connections, in use and idle.", func() float64 {
+        return float64(db.Stats().OpenConnections)
+    })
+    r.NewGaugeFunc("db_in_use_connections", "Connections currently in use.", func() float64 {
+        return float64(db.Stats().InUse)
+    })
+    r.NewGaugeFunc("db_idle_connections", "Idle connections.", func() float64 {
+        return float64(db.Stats().Idle)
+    })
+    r.NewCounterFunc("db_wait_count_total", "Connections waited for.", func() float64 {
+        return float64(db.Stats().WaitCount)
+    })
+    r.NewCounterFunc("db_wait_duration_seconds_total", "Time blocked waiting for a new connection.", func() float64 {
+        return db.Stats().WaitDuration.Seconds()
+    })
+    r.NewCounterFunc("db_max_idle_closed_total", "Connections closed due to the idle limit.", func() float64 {
+        return float64(db.Stats().MaxIdleClosed)
+    })
+    r.NewCounterFunc("db_max_lifetime_closed_total", "Connections closed due to the maximum lifetime.", func() float64 {
+        return float64(db.Stats().MaxLifetimeClosed)
+    })
+}
@@ -0,0 +1,284 @@
+// Package metrics collects counters, histograms and gauges and exposes them
+// in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets in seconds, suited to request
+// and query latencies
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that can write itself in the text format
+type collector interface {
+    write(b *bytes.Buffer)
+}
+
+// Registry holds the metrics exposed together
+type Registry struct {
+    mu sync.Mutex
+    collectors []collector
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+    return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.collectors = append(r.collectors, c)
+}
+
+// Write writes all metrics of the registry in the Prometheus text format
+func (r *Registry) Write(b *bytes.Buffer) {
+    r.mu.Lock()
+    collectors := append([]collector(nil), r.collectors...)
+    r.mu.Unlock()
+
+    for _, c := range collectors {
+        c.write(b)
+    }
+}
+
+// Handler serves the metrics of the registry
+func (r *Registry) Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        var b bytes.Buffer
+        r.Write(&b)
+
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        w.Write(b.Bytes())
+    })
+}
+
+// desc describes a metric family
+type desc struct {
+    name string
+    help string
+    typ string
+    labels []string
+}
+
+// writeHeader writes the HELP and TYPE lines of the family
+func (d desc) writeHeader(b *bytes.Buffer) {
+    fmt.Fprintf(b, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+    fmt.Fprintf(b, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+// key joins label values to a map key
+func (d desc) key(labelValues []string) string {
+    if len(labelValues) != len(d.labels) {
+        panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+    }
+    return strings.Join(labelValues, "\xff")
+}
+
+// labelValueEscaper escapes label values as required by the text format
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelString formats label names and values, e.g. {method="GET",le="0.5"}
+func labelString(names, values []string) string {
+    if len(names) == 0 {
+        return ""
+    }
+
+    pairs := make([]string, len(names))
+    for i := range names {
+        pairs[i] = fmt.Sprintf(`%s="%s"`, names[i], labelValueEscaper.Replace(values[i]))
+    }
+    return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatFloat formats a sample value
+func formatFloat(v float64) string {
+    switch {
+    case math.IsInf(v, 1):
+        return "+Inf"
+    case math.IsInf(v, -1):
+        return "-Inf"
+    }
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of m in order, so that output is stable
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+    desc
+    mu sync.Mutex
+    values map[string]float64
+    labelValues map[string][]string
+}
+
+// NewCounterVec registers a counter with the given label names
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+    c := &CounterVec{
+        desc: desc{name: name, help: help, typ: "counter", labels: labels},
+        values: make(map[string]float64),
+        labelValues: make(map[string][]string),
+    }
+    r.register(c)
+    return c
+}
+
+// Inc adds 1 to the counter with the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+    c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter with the given label
+// values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+    if v < 0 {
+        panic(fmt.Sprintf("metrics: counter %s can't decrease", c.name))
+    }
+
+    k := c.key(labelValues)
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.values[k] += v
+    c.labelValues[k] = labelValues
+}
+
+// Value returns the counter with the given label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+    k := c.key(labelValues)
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.values[k]
+}
+
+func (c *CounterVec) write(b *bytes.Buffer) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    c.writeHeader(b)
+    for _, k := range sortedKeys(c.values) {
+        fmt.Fprintf(b, "%s%s %s\n", c.name, labelString(c.labels, c.labelValues[k]), formatFloat(c.values[k]))
+    }
+}
+
+// histogram holds the observations of one label combination
+type histogram struct {
+    labelValues []string
+    counts []uint64
+    count uint64
+    sum float64
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+    desc
+    buckets []float64
+    mu sync.Mutex
+    histograms map[string]*histogram
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds and
+// label names
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+    h := &HistogramVec{
+        desc: desc{name: name, help: help, typ: "histogram", labels: labels},
+        buckets: append([]float64(nil), buckets...),
+        histograms: make(map[string]*histogram),
+    }
+    sort.Float64s(h.buckets)
+    r.register(h)
+    return h
+}
+
+// Observe adds v to the histogram with the given label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+    k := h.key(labelValues)
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    hist, ok := h.histograms[k]
+    if !ok {
+        hist = &histogram{
+            labelValues: labelValues,
+            counts: make([]uint64, len(h.buckets)),
+        }
+        h.histograms[k] = hist
+    }
+
+    for i, upper := range h.buckets {
+        if v <= upper {
+            hist.counts[i]++
+        }
+    }
+    hist.count++
+    hist.sum += v
+}
+
+// Count returns the number of observations with the given label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+    k := h.key(labelValues)
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    if hist, ok := h.histograms[k]; ok {
+        return hist.count
+    }
+    return 0
+}
+
+func (h *HistogramVec) write(b *bytes.Buffer) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.writeHeader(b)
+    names := append(append([]string(nil), h.labels...), "le")
+    for _, k := range sortedKeys(h.histograms) {
+        hist := h.histograms[k]
+        for i, upper := range h.buckets {
+            values := append(append([]string(nil), hist.labelValues...), formatFloat(upper))
+            fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, labelString(names, values), hist.counts[i])
+        }
+        values := append(append([]string(nil), hist.labelValues...), "+Inf")
+        fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, labelString(names, values), hist.count)
+        fmt.Fprintf(b, "%s_sum%s %s\n", h.name, labelString(h.labels, hist.labelValues), formatFloat(hist.sum))
+        fmt.Fprintf(b, "%s_count%s %d\n", h.name, labelString(h.labels, hist.labelValues), hist.count)
+    }
+}
+
+// valueFunc is a gauge or counter whose value is read when metrics are
+// written
+type valueFunc struct {
+    desc
+    f func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is f()
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+    r.register(&valueFunc{desc{name: name, help: help, typ: "gauge"}, f})
+}
+
+// NewCounterFunc registers a counter whose value is f(), f must never
+// decrease
+func (r *Registry) NewCounterFunc(name, help string, f func() float64) {
+    r.register(&valueFunc{desc{name: name, help: help, typ: "counter"}, f})
+}
+
+func (g *valueFunc) write(b *bytes.Buffer) {
+    g.writeHeader(b)
+    fmt.Fprintf(b, "%s %s\n", g.name, formatFloat(g.f()))
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestCounterVec(t *testing.T) {
+    r := NewRegistry()
+    c := r.NewCounterVec("requests_total", "Requests.", "method", "path")
+
+    c.Inc("GET", "/")
+    c.Inc("GET", "/")
+    c.Add(3, "POST", `/a"b`)
+
+    if c.Value("GET", "/") != 2 {
+        t.Errorf("expected 2, got %v", c.Value("GET", "/"))
+    }
+
+    var b bytes.Buffer
+    r.Write(&b)
+    want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/"} 2
+requests_total{method="POST",path="/a\"b"} 3
+`
+    if b.String() != want {
+        t.Errorf("expected\n%s\ngot\n%s", want, b.String())
+    }
+}
+
+func TestHistogramVec(t *testing.T) {
+    r := NewRegistry()
+    h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+
+    h.Observe(0.05, "/")
+    h.Observe(0.5, "/")
+    h.Observe(5, "/")
+
+    if h.Count("/") != 3 || h.Count("/other") != 0 {
+        t.Errorf("expected 3 and 0 observations, got %d and %d", h.Count("/"), h.Count("/other"))
+    }
+
+    var b bytes.Buffer
+    r.Write(&b)
+    want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/",le="0.1"} 1
+latency_seconds_bucket{route="/",le="1"} 2
+latency_seconds_bucket{route="/",le="+Inf"} 3
+latency_seconds_sum{route="/"} 5.55
+latency_seconds_count{route="/"} 3
+`
+    if b.String() != want {
+        t.Errorf("expected\n%s\ngot\n%s", want, b.String())
+    }
+}
+
+func TestWrongLabelCount(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Error("expected a panic for a missing label value")
+        }
+    }()
+
+    NewRegistry().NewCounterVec("x_total", "X.", "a", "b").Inc("only one")
+}
+
+func TestHandler(t *testing.T) {
+    r := NewRegistry()
+    r.NewGaugeFunc("answer", "The answer.", func() float64 { return 42 })
+    // the pool doesn't connect until it is used
+    db, err := sql.Open("pgx", "host=127.0.0.1 port=1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer db.Close()
+    db.SetMaxOpenConns(10)
+    RegisterDBStats(r, db)
+
+    rr := httptest.NewRecorder()
+    r.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+    if rr.Code != http.StatusOK {
+        t.Errorf("expected %d, got %d", http.StatusOK, rr.Code)
+    }
+    if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+        t.Errorf("expected prometheus content type, got %s", rr.Header().Get("Content-Type"))
+    }
+    for _, want := range []string{"# TYPE answer gauge\nanswer 42\n", "db_max_open_connections 10\n", "# TYPE db_wait_count_total counter\n"} {
+        if !strings.Contains(rr.Body.String(), want) {
+            t.Errorf("expected %q in body, got %s", want, rr.Body.String())
+        }
+    }
+}
@@ -0,0 +1,698 @@
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Fizz translates the subset of the fizz migration language used by soda to
+// postgres SQL: create_table with t.Column, drop_table, rename_table,
+// add_column, change_column, rename_column, drop_column, add_index,
+// drop_index, add_foreign_key, drop_foreign_key and sql.
+func Fizz(src string) (string, error) {
+    p := &fizzParser{src: src}
+
+    var statements []string
+    for {
+        p.skipSpace()
+        if p.pos >= len(p.src) {
+            break
+        }
+
+        c, err := p.call()
+        if err != nil {
+            return "", err
+        }
+
+        sql, err := c.sql()
+        if err != nil {
+            return "", fmt.Errorf("%s: %w", c.name, err)
+        }
+        statements = append(statements, sql...)
+    }
+
+    if len(statements) == 0 {
+        return "", nil
+    }
+    return strings.Join(statements, ";\n") + ";\n", nil
+}
+
+// fizzCall is a function call, e.g. add_index("users", "email", {}), with the
+// calls inside its block for create_table
+type fizzCall struct {
+    name string
+    args []interface{}
+    block []fizzCall
+}
+
+// fizzParser is a recursive descent parser of fizz calls
+type fizzParser struct {
+    src string
+    pos int
+}
+
+func (p *fizzParser) errorf(format string, args ...interface{}) error {
+    line := strings.Count(p.src[:p.pos], "\n") + 1
+    return fmt.Errorf("fizz line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips white space and // comments
+func (p *fizzParser) skipSpace() {
+    for p.pos < len(p.src) {
+        switch {
+        case unicode.IsSpace(rune(p.src[p.pos])):
+            p.pos++
+        case strings.HasPrefix(p.src[p.pos:], "//"):
+            for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+                p.pos++
+            }
+        default:
+            return
+        }
+    }
+}
+
+// peek returns the next character that isn't white space, or 0 at the end
+func (p *fizzParser) peek() byte {
+    p.skipSpace()
+    if p.pos >= len(p.src) {
+        return 0
+    }
+    return p.src[p.pos]
+}
+
+// expect consumes c or fails
+func (p *fizzParser) expect(c byte) error {
+    if p.peek() != c {
+        return p.errorf("expected %q", c)
+    }
+    p.pos++
+    return nil
+}
+
+// ident reads a name like create_table or t
+func (p *fizzParser) ident() (string, error) {
+    p.skipSpace()
+    start := p.pos
+    for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+        p.pos++
+    }
+    if start == p.pos {
+        return "", p.errorf("expected a name")
+    }
+    return p.src[start:p.pos], nil
+}
+
+// call reads name(args) and an optional block of calls on t
+func (p *fizzParser) call() (fizzCall, error) {
+    var c fizzCall
+
+    name, err := p.ident()
+    if err != nil {
+        return c, err
+    }
+    c.name = name
+
+    c.args, err = p.list('(', ')')
+    if err != nil {
+        return c, err
+    }
+
+    if p.peek() != '{' {
+        return c, nil
+    }
+    p.pos++
+
+    for p.peek() != '}' {
+        if p.peek() == 0 {
+            return c, p.errorf("unterminated block of %s", c.name)
+        }
+
+        receiver, err := p.ident()
+        if err != nil {
+            return c, err
+        }
+        if err := p.expect('.'); err != nil {
+            return c, err
+        }
+
+        inner, err := p.call()
+        if err != nil {
+            return c, err
+        }
+        inner.name = receiver + "." + inner.name
+        c.block = append(c.block, inner)
+    }
+    p.pos++
+
+    return c, nil
+}
+
+// list reads values separated by commas between open and close, a trailing
+// comma is allowed
+func (p *fizzParser) list(open, close byte) ([]interface{}, error) {
+    if err := p.expect(open); err != nil {
+        return nil, err
+    }
+
+    var values []interface{}
+    for p.peek() != close {
+        v, err := p.value()
+        if err != nil {
+            return nil, err
+        }
+        values = append(values, v)
+
+        if p.peek() == ',' {
+            p.pos++
+        } else if p.peek() != close {
+            return nil, p.errorf("expected ',' or %q", close)
+        }
+    }
+    p.pos++
+
+    return values, nil
+}
+
+// value reads a string, number, boolean, array or map
+func (p *fizzParser) value() (interface{}, error) {
+    switch c := p.peek(); {
+    case c == '"' || c == '`':
+        return p.str()
+    case c == '[':
+        return p.list('[', ']')
+    case c == '{':
+        return p.object()
+    case c == '-' || (c >= '0' && c <= '9'):
+        start := p.pos
+        p.pos++
+        for p.pos < len(p.src) && strings.IndexByte("0123456789.", p.src[p.pos]) >= 0 {
+            p.pos++
+        }
+        n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+        if err != nil {
+            return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+        }
+        return n, nil
+    default:
+        word, err := p.ident()
+        if err != nil {
+            return nil, err
+        }
+        switch word {
+        case "true":
+            return true, nil
+        case "false":
+            return false, nil
+        case "nil":
+            return nil, nil
+        }
+        return nil, p.errorf("unexpected %q", word)
+    }
+}
+
+// str reads a double quoted string with escapes, or a raw string in
+// backticks
+func (p *fizzParser) str() (string, error) {
+    quote := p.src[p.pos]
+    start := p.pos
+    p.pos++
+
+    for p.pos < len(p.src) && p.src[p.pos] != quote {
+        if quote == '"' && p.src[p.pos] == '\\' {
+            p.pos++
+        }
+        p.pos++
+    }
+    if p.pos >= len(p.src) {
+        return "", p.errorf("unterminated string")
+    }
+    p.pos++
+
+    if quote == '`' {
+        return p.src[start+1 : p.pos-1], nil
+    }
+    s, err := strconv.Unquote(p.src[start:p.pos])
+    if err != nil {
+        return "", p.errorf("invalid string %s", p.src[start:p.pos])
+    }
+    return s, nil
+}
+
+// object reads a map with string keys
+func (p *fizzParser) object() (map[string]interface{}, error) {
+    p.pos++
+
+    m := make(map[string]interface{})
+    for p.peek() != '}' {
+        if c := p.peek(); c != '"' && c != '`' {
+            return nil, p.errorf("expected a string key")
+        }
+        key, err := p.str()
+        if err != nil {
+            return nil, err
+        }
+        if err := p.expect(':'); err != nil {
+            return nil, err
+        }
+        m[key], err = p.value()
+        if err != nil {
+            return nil, err
+        }
+
+        if p.peek() == ',' {
+            p.pos++
+        } else if p.peek() != '}' {
+            return nil, p.errorf("expected ',' or '}'")
+        }
+    }
+    p.pos++
+
+    return m, nil
+}
+
+// stringArg returns argument i, which must be a string
+func (c fizzCall) stringArg(i int) (string, error) {
+    if i >= len(c.args) {
+        return "", fmt.Errorf("missing argument %d", i+1)
+    }
+    s, ok := c.args[i].(string)
+    if !ok {
+        return "", fmt.Errorf("argument %d must be a string", i+1)
+    }
+    return s, nil
+}
+
+// options returns argument i as map, options may be left out
+func (c fizzCall) options(i int) (map[string]interface{}, error) {
+    if i >= len(c.args) {
+        return map[string]interface{}{}, nil
+    }
+    m, ok := c.args[i].(map[string]interface{})
+    if !ok {
+        return nil, fmt.Errorf("argument %d must be a map of options", i+1)
+    }
+    return m, nil
+}
+
+// quote quotes an identifier
+func quote(name string) string {
+    return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// literal quotes a default value as string literal
+func literal(v interface{}) string {
+    s := fmt.Sprint(v)
+    if f, ok := v.(float64); ok {
+        s = strconv.FormatFloat(f, 'f', -1, 64)
+    }
+    return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// column is a column definition of create_table, add_column and
+// change_column
+type column struct {
+    name string
+    typ string
+    options map[string]interface{}
+}
+
+// columnFromArgs reads name, type and options starting at argument i
+func columnFromArgs(c fizzCall, i int) (column, error) {
+    var col column
+    var err error
+
+    col.name, err = c.stringArg(i)
+    if err != nil {
+        return col, err
+    }
+    col.typ, err = c.stringArg(i + 1)
+    if err != nil {
+        return col, err
+    }
+    col.options, err = c.options(i + 2)
+    return col, err
+}
+
+func (col column) primary() bool {
+    return col.options["primary"] == true
+}
+
+// sqlType maps fizz column types to postgres types
+func (col column) sqlType() string {
+    switch strings.ToLower(col.typ) {
+    case "string":
+        size := 255
+        if s, ok := col.options["size"].(float64); ok {
+            size = int(s)
+        }
+        return fmt.Sprintf("VARCHAR (%d)", size)
+    case "int", "integer":
+        if col.primary() {
+            return "SERIAL"
+        }
+        return "integer"
+    case "bigint":
+        if col.primary() {
+            return "BIGSERIAL"
+        }
+        return "bigint"
+    case "bool", "boolean":
+        return "boolean"
+    case "time", "datetime", "timestamp":
+        return "timestamp"
+    case "blob", "[]byte":
+        return "bytea"
+    case "json":
+        return "jsonb"
+    case "float", "decimal":
+        if p, ok := col.options["precision"].(float64); ok {
+            if s, ok := col.options["scale"].(float64); ok {
+                return fmt.Sprintf("DECIMAL(%d,%d)", int(p), int(s))
+            }
+            return fmt.Sprintf("DECIMAL(%d)", int(p))
+        }
+        return "DECIMAL"
+    }
+    return col.typ
+}
+
+// definition returns the column as used in CREATE TABLE and ADD COLUMN
+func (col column) definition() string {
+    def := quote(col.name) + " " + col.sqlType()
+    if col.options["null"] != true {
+        def += " NOT NULL"
+    }
+    if v, ok := col.options["default_raw"]; ok {
+        def += fmt.Sprintf(" DEFAULT %v", v)
+    } else if v, ok := col.options["default"]; ok {
+        def += " DEFAULT " + literal(v)
+    }
+    return def
+}
+
+// sql translates the call to SQL statements
+func (c fizzCall) sql() ([]string, error) {
+    switch c.name {
+    case "create_table":
+        return c.createTable()
+    case "drop_table":
+        table, err := c.stringArg(0)
+        if err != nil {
+            return nil, err
+        }
+        return []string{"DROP TABLE " + quote(table)}, nil
+    case "rename_table":
+        from, err := c.stringArg(0)
+        if err != nil {
+            return nil, err
+        }
+        to, err := c.stringArg(1)
+        if err != nil {
+            return nil, err
+        }
+        return []string{fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quote(from), quote(to))}, nil
+    case "add_column":
+        table, err := c.stringArg(0)
+        if err != nil {
+            return nil, err
+        }
+        col, err := columnFromArgs(c, 1)
+        if err != nil {
+            return nil, err
+        }
+        return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", quote(table), col.definition())}, nil
+    case "change_column":
+        return c.changeColumn()
+    case "rename_column":
+        table, err := c.stringArg(0)
+        if err != nil {
+            return nil, err
+        }
+        from, err := c.stringArg(1)
+        if err != nil {
+            return nil, err
+        }
+        to, err := c.stringArg(2)
+        if err != nil {
+            return nil, err
+        }
+        return []string{fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", quote(table), quote(from), quote(to))}, nil
+    case "drop_column":
+        table, err := c.stringArg(0)
+        if err != nil {
+            return nil, err
+        }
+        col, err := c.stringArg(1)
+        if err != nil {
+            return nil, err
+        }
+        return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", quote(table), quote(col))}, nil
+    case "add_index":
+        return c.addIndex()
+    case "drop_index":
+        if _, err := c.stringArg(0); err != nil {
+            return nil, err
+        }
+        name, err := c.stringArg(1)
+        if err != nil {
+            return nil, err
+        }
+        return []string{"DROP INDEX " + quote(name)}, nil
+    case "add_foreign_key":
+        return c.addForeignKey()
+    case "drop_foreign_key":
+        table, err := c.stringArg(0)
+        if err != nil {
+            return nil, err
+        }
+        name, err := c.stringArg(1)
+        if err != nil {
+            return nil, err
+        }
+        options, err := c.options(2)
+        if err != nil {
+            return nil, err
+        }
+        ifExists := ""
+        if options["if_exists"] == true {
+            ifExists = "IF EXISTS "
+        }
+        return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s%s", quote(table), ifExists, quote(name))}, nil
+    case "sql":
+        raw, err := c.stringArg(0)
+        if err != nil {
+            return nil, err
+        }
+        return []string{strings.TrimRight(strings.TrimSpace(raw), ";")}, nil
+    }
+
+    return nil, fmt.Errorf("unsupported command")
+}
+
+// createTable translates create_table. Like soda, it adds an id primary key
+// and created_at and updated_at columns if they are missing, unless
+// t.DisableTimestamps() is called.
+func (c fizzCall) createTable() ([]string, error) {
+    table, err := c.stringArg(0)
+    if err != nil {
+        return nil, err
+    }
+
+    var columns []column
+    var primaryKeys []string
+    seen := make(map[string]bool)
+    timestamps := true
+
+    for _, inner := range c.block {
+        switch inner.name {
+        case "t.Column":
+            col, err := columnFromArgs(inner, 0)
+            if err != nil {
+                return nil, fmt.Errorf("t.Column: %w", err)
+            }
+            if col.primary() {
+                primaryKeys = append(primaryKeys, quote(col.name))
+            }
+            columns = append(columns, col)
+            seen[col.name] = true
+        case "t.PrimaryKey":
+            for _, arg := range inner.args {
+                name, ok := arg.(string)
+                if !ok {
+                    return nil, fmt.Errorf("t.PrimaryKey: columns must be strings")
+                }
+                primaryKeys = append(primaryKeys, quote(name))
+            }
+        case "t.Timestamps":
+            timestamps = true
+        case "t.DisableTimestamps":
+            timestamps = false
+        default:
+            return nil, fmt.Errorf("unsupported %s", inner.name)
+        }
+    }
+
+    if len(primaryKeys) == 0 && !seen["id"] {
+        columns = append([]column{{name: "id", typ: "integer", options: map[string]interface{}{"primary": true}}}, columns...)
+        primaryKeys = append(primaryKeys, quote("id"))
+    }
+    if timestamps {
+        for _, name := range []string{"created_at", "updated_at"} {
+            if !seen[name] {
+                columns = append(columns, column{name: name, typ: "timestamp", options: map[string]interface{}{}})
+            }
+        }
+    }
+
+    var lines []string
+    for _, col := range columns {
+        lines = append(lines, col.definition())
+    }
+    if len(primaryKeys) > 0 {
+        lines = append(lines, fmt.Sprintf("PRIMARY KEY(%s)", strings.Join(primaryKeys, ", ")))
+    }
+
+    return []string{fmt.Sprintf("CREATE TABLE %s (\n%s\n)", quote(table), strings.Join(lines, ",\n"))}, nil
+}
+
+// changeColumn translates change_column to a single ALTER TABLE that sets
+// type, nullability and default
+func (c fizzCall) changeColumn() ([]string, error) {
+    table, err := c.stringArg(0)
+    if err != nil {
+        return nil, err
+    }
+    col, err := columnFromArgs(c, 1)
+    if err != nil {
+        return nil, err
+    }
+
+    name := quote(col.name)
+    alters := []string{fmt.Sprintf("ALTER COLUMN %s TYPE %s", name, col.sqlType())}
+    if col.options["null"] == true {
+        alters = append(alters, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", name))
+    } else {
+        alters = append(alters, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", name))
+    }
+    if v, ok := col.options["default_raw"]; ok {
+        alters = append(alters, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %v", name, v))
+    } else if v, ok := col.options["default"]; ok {
+        alters = append(alters, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", name, literal(v)))
+    } else {
+        alters = append(alters, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", name))
+    }
+
+    return []string{fmt.Sprintf("ALTER TABLE %s %s", quote(table), strings.Join(alters, ", "))}, nil
+}
+
+// addIndex translates add_index, the index is named table_columns_idx unless
+// a name is given
+func (c fizzCall) addIndex() ([]string, error) {
+    table, err := c.stringArg(0)
+    if err != nil {
+        return nil, err
+    }
+    if len(c.args) < 2 {
+        return nil, fmt.Errorf("missing columns")
+    }
+
+    var columns []string
+    switch v := c.args[1].(type) {
+    case string:
+        columns = []string{v}
+    case []interface{}:
+        for _, col := range v {
+            s, ok := col.(string)
+            if !ok {
+                return nil, fmt.Errorf("columns must be strings")
+            }
+            columns = append(columns, s)
+        }
+    default:
+        return nil, fmt.Errorf("columns must be a string or an array")
+    }
+
+    options, err := c.options(2)
+    if err != nil {
+        return nil, err
+    }
+
+    name := fmt.Sprintf("%s_%s_idx", table, strings.Join(columns, "_"))
+    if n, ok := options["name"].(string); ok {
+        name = n
+    }
+    unique := ""
+    if options["unique"] == true {
+        unique = "UNIQUE "
+    }
+
+    quoted := make([]string, len(columns))
+    for i, col := range columns {
+        quoted[i] = quote(col)
+    }
+
+    return []string{fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, quote(name), quote(table), strings.Join(quoted, ", "))}, nil
+}
+
+// addForeignKey translates add_foreign_key, the constraint is named
+// table_reftable_refcolumn_fk unless a name is given
+func (c fizzCall) addForeignKey() ([]string, error) {
+    table, err := c.stringArg(0)
+    if err != nil {
+        return nil, err
+    }
+    col, err := c.stringArg(1)
+    if err != nil {
+        return nil, err
+    }
+    refs, err := c.options(2)
+    if err != nil || len(refs) != 1 {
+        return nil, fmt.Errorf("argument 3 must be a map of one table to its columns")
+    }
+
+    var refTable string
+    var refColumns []string
+    for t, cols := range refs {
+        refTable = t
+        list, ok := cols.([]interface{})
+        if !ok || len(list) == 0 {
+            return nil, fmt.Errorf("referenced columns must be a non-empty array")
+        }
+        for _, rc := range list {
+            s, ok := rc.(string)
+            if !ok {
+                return nil, fmt.Errorf("referenced columns must be strings")
+            }
+            refColumns = append(refColumns, s)
+        }
+    }
+
+    options, err := c.options(3)
+    if err != nil {
+        return nil, err
+    }
+
+    name := fmt.Sprintf("%s_%s_%s_fk", table, refTable, strings.Join(refColumns, "_"))
+    if n, ok := options["name"].(string); ok {
+        name = n
+    }
+
+    quoted := make([]string, len(refColumns))
+    for i, rc := range refColumns {
+        quoted[i] = quote(rc)
+    }
+
+    sql := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+        quote(table), quote(name), quote(col), quote(refTable), strings.Join(quoted, ", "))
+    if v, ok := options["on_delete"].(string); ok {
+        sql += " ON DELETE " + strings.ToUpper(v)
+    }
+    if v, ok := options["on_update"].(string); ok {
+        sql += " ON UPDATE " + strings.ToUpper(v)
+    }
+
+    return []string{sql}, nil
+}
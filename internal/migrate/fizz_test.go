@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+)
+
+var fizzTests = []struct {
+    name string
+    fizz string
+    expected string
+}{
+    {
+        "create table",
+        `create_table("users") {
+  t.Column("id", "integer", {"primary": true})
+  t.Column("email", "string", {})
+  t.Column("password", "string", {"size": 60})
+  t.Column("access_level", "integer", {"default": 1})
+  t.Column("active", "bool", {"default": true, "null": true})
+  t.Column("created_at", "timestamptz", {"default_raw": "now()"})
+}`,
+        `CREATE TABLE "users" (
+"id" SERIAL NOT NULL,
+"email" VARCHAR (255) NOT NULL,
+"password" VARCHAR (60) NOT NULL,
+"access_level" integer NOT NULL DEFAULT '1',
+"active" boolean DEFAULT 'true',
+"created_at" timestamptz NOT NULL DEFAULT now(),
+"updated_at" timestamp NOT NULL,
+PRIMARY KEY("id")
+);
+`,
+    },
+    {
+        "create table without id and timestamps",
+        `create_table("notes") {
+  t.Column("body", "text", {})
+  t.DisableTimestamps()
+}`,
+        `CREATE TABLE "notes" (
+"id" SERIAL NOT NULL,
+"body" text NOT NULL,
+PRIMARY KEY("id")
+);
+`,
+    },
+    {
+        "drop table",
+        `drop_table("rent")`,
+        `DROP TABLE "rent";` + "\n",
+    },
+    {
+        "columns",
+        `add_column("rent", "processed", "integer", {"default": 0})
+drop_column("rent", "processed")
+rename_column("rent", "phone", "mobile")`,
+        `ALTER TABLE "rent" ADD COLUMN "processed" integer NOT NULL DEFAULT '0';
+ALTER TABLE "rent" DROP COLUMN "processed";
+ALTER TABLE "rent" RENAME COLUMN "phone" TO "mobile";
+`,
+    },
+    {
+        "change column",
+        `change_column("rent_restrictions", "rent_id", "integer", {"null": true})`,
+        `ALTER TABLE "rent_restrictions" ALTER COLUMN "rent_id" TYPE integer, ALTER COLUMN "rent_id" DROP NOT NULL, ALTER COLUMN "rent_id" DROP DEFAULT;` + "\n",
+    },
+    {
+        "indices",
+        `add_index("users", "email", {"unique": true})
+add_index("rent_restrictions", ["model_id", "external_uid"], {})
+add_index("rent", "email", {"name": "rent_by_email"})
+drop_index("users", "users_email_idx")`,
+        `CREATE UNIQUE INDEX "users_email_idx" ON "users" ("email");
+CREATE INDEX "rent_restrictions_model_id_external_uid_idx" ON "rent_restrictions" ("model_id", "external_uid");
+CREATE INDEX "rent_by_email" ON "rent" ("email");
+DROP INDEX "users_email_idx";
+`,
+    },
+    {
+        "foreign keys",
+        `// cascade like the other foreign keys
+add_foreign_key("rent", "model_id", {"models": ["id"]}, {
+    "on_delete": "cascade",
+    "on_update": "cascade",
+})
+
+drop_foreign_key("rent", "rent_models_id_fk", {"if_exists": true})`,
+        `ALTER TABLE "rent" ADD CONSTRAINT "rent_models_id_fk" FOREIGN KEY ("model_id") REFERENCES "models" ("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "rent" DROP CONSTRAINT IF EXISTS "rent_models_id_fk";
+`,
+    },
+    {
+        "raw sql",
+        "sql(`update models set daily_rate = 0;`)\nsql(\"select \\\"x\\\"\")",
+        "update models set daily_rate = 0;\nselect \"x\";\n",
+    },
+    {
+        "empty",
+        "\n// nothing to do\n",
+        "",
+    },
+}
+
+func TestFizz(t *testing.T) {
+    for _, e := range fizzTests {
+        got, err := Fizz(e.fizz)
+        if err != nil {
+            t.Errorf("for %s, unexpected error: %s", e.name, err)
+            continue
+        }
+        if got != e.expected {
+            t.Errorf("for %s, expected\n%s\ngot\n%s", e.name, e.expected, got)
+        }
+    }
+}
+
+var fizzErrorTests = []struct {
+    name string
+    fizz string
+    expectedError string
+}{
+    {"unknown command", `add_trigger("rent")`, "unsupported command"},
+    {"unknown table command", `create_table("rent") { t.Index("x") }`, "unsupported t.Index"},
+    {"unterminated string", `drop_table("rent)`, "unterminated string"},
+    {"missing argument", `drop_column("rent")`, "missing argument 2"},
+    {"wrong argument", `drop_table(1)`, "must be a string"},
+    {"missing paren", "drop_table(\"rent\"\ndrop_table(\"models\")", "line 2"},
+}
+
+func TestFizzErrors(t *testing.T) {
+    for _, e := range fizzErrorTests {
+        _, err := Fizz(e.fizz)
+        if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+            t.Errorf("for %s, expected error containing %q, got %v", e.name, e.expectedError, err)
+        }
+    }
+}
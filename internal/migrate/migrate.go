@@ -0,0 +1,308 @@
+// Package migrate applies and rolls back the database migrations without the
+// soda tool. Versions of applied migrations are recorded in the
+// schema_migration table, like soda does, so both can be used on the same
+// database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// dialect is the database of this app, .sql migrations of other databases
+// are skipped
+const dialect = "postgres"
+
+// lockID is the postgres advisory lock held while migrating, so that two
+// instances starting at the same time don't both migrate
+const lockID = 72706410
+
+// timeout limits the time of a whole migrate run
+const timeout = 5 * time.Minute
+
+// fileName matches migration files, e.g. 20230615130512_create_rent_table.up.fizz
+// or 20230628171610_seed_models_table.postgres.up.sql
+var fileName = regexp.MustCompile(`^(\d{14})_(.+?)(\.[a-z]+)?\.(up|down)\.(fizz|sql)$`)
+
+// ErrUnknownVersion is returned when rolling back to a version that has no
+// migration
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+// Migration is a version with its up and down files
+type Migration struct {
+    Version string
+    Name string
+    Up string
+    Down string
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+    Migration
+    Applied bool
+}
+
+// Load returns the migrations in fsys sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+    files, err := fs.ReadDir(fsys, ".")
+    if err != nil {
+        return nil, err
+    }
+
+    byVersion := make(map[string]*Migration)
+    for _, f := range files {
+        match := fileName.FindStringSubmatch(f.Name())
+        if match == nil {
+            continue
+        }
+        version, name, fileDialect, direction := match[1], match[2], match[3], match[4]
+        if fileDialect != "" && fileDialect != "."+dialect {
+            continue
+        }
+
+        m, ok := byVersion[version]
+        if !ok {
+            m = &Migration{Version: version, Name: name}
+            byVersion[version] = m
+        }
+        if m.Name != name {
+            return nil, fmt.Errorf("migration %s has files with different names: %s and %s", version, m.Name, name)
+        }
+
+        if direction == "up" {
+            m.Up = f.Name()
+        } else {
+            m.Down = f.Name()
+        }
+    }
+
+    var migrations []Migration
+    for _, m := range byVersion {
+        if m.Up == "" {
+            return nil, fmt.Errorf("migration %s_%s has no up file", m.Version, m.Name)
+        }
+        migrations = append(migrations, *m)
+    }
+    sort.Slice(migrations, func(i, j int) bool {
+        return migrations[i].Version < migrations[j].Version
+    })
+
+    return migrations, nil
+}
+
+// statements returns the SQL of a migration file, fizz files are translated
+func statements(fsys fs.FS, file string) (string, error) {
+    content, err := fs.ReadFile(fsys, file)
+    if err != nil {
+        return "", err
+    }
+
+    if fileName.FindStringSubmatch(file)[5] == "fizz" {
+        sql, err := Fizz(string(content))
+        if err != nil {
+            return "", fmt.Errorf("%s: %w", file, err)
+        }
+        return sql, nil
+    }
+
+    return string(content), nil
+}
+
+// Migrator runs the migrations in FS against DB
+type Migrator struct {
+    DB *sql.DB
+    FS fs.FS
+    // Log, if not nil, is called for every applied or rolled back migration
+    Log func(direction string, m Migration)
+}
+
+// New returns a migrator for the migrations in fsys
+func New(db *sql.DB, fsys fs.FS) *Migrator {
+    return &Migrator{
+        DB: db,
+        FS: fsys,
+    }
+}
+
+// Up applies all pending migrations in order and returns how many were
+// applied. Every migration runs in its own transaction.
+func (m *Migrator) Up() (int, error) {
+    applied := 0
+    err := m.locked(func(ctx context.Context, conn *sql.Conn, migrations []Migration, done map[string]bool) error {
+        for _, mig := range migrations {
+            if done[mig.Version] {
+                continue
+            }
+
+            err := m.run(ctx, conn, mig, "up")
+            if err != nil {
+                return err
+            }
+            applied++
+        }
+        return nil
+    })
+
+    return applied, err
+}
+
+// Down rolls back the latest applied migration
+func (m *Migrator) Down() error {
+    return m.locked(func(ctx context.Context, conn *sql.Conn, migrations []Migration, done map[string]bool) error {
+        for i := len(migrations) - 1; i >= 0; i-- {
+            if done[migrations[i].Version] {
+                return m.run(ctx, conn, migrations[i], "down")
+            }
+        }
+        return nil
+    })
+}
+
+// DownTo rolls back all applied migrations newer than version, newest first.
+// Version 0 rolls back every migration.
+func (m *Migrator) DownTo(version string) (int, error) {
+    rolledBack := 0
+    err := m.locked(func(ctx context.Context, conn *sql.Conn, migrations []Migration, done map[string]bool) error {
+        known := version == "0"
+        for _, mig := range migrations {
+            known = known || mig.Version == version
+        }
+        if !known {
+            return fmt.Errorf("%w: %s", ErrUnknownVersion, version)
+        }
+
+        for i := len(migrations) - 1; i >= 0; i-- {
+            mig := migrations[i]
+            if mig.Version <= version || !done[mig.Version] {
+                continue
+            }
+
+            err := m.run(ctx, conn, mig, "down")
+            if err != nil {
+                return err
+            }
+            rolledBack++
+        }
+        return nil
+    })
+
+    return rolledBack, err
+}
+
+// Status returns every migration and whether it has been applied
+func (m *Migrator) Status() ([]Status, error) {
+    var status []Status
+    err := m.locked(func(ctx context.Context, conn *sql.Conn, migrations []Migration, done map[string]bool) error {
+        for _, mig := range migrations {
+            status = append(status, Status{Migration: mig, Applied: done[mig.Version]})
+        }
+        return nil
+    })
+
+    return status, err
+}
+
+// locked calls f on a single connection that holds the migration lock, with
+// the migrations and the versions already applied
+func (m *Migrator) locked(f func(ctx context.Context, conn *sql.Conn, migrations []Migration, done map[string]bool) error) error {
+    migrations, err := Load(m.FS)
+    if err != nil {
+        return err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+
+    conn, err := m.DB.Conn(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, lockID)
+    if err != nil {
+        return fmt.Errorf("cannot get migration lock: %w", err)
+    }
+    defer conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, lockID)
+
+    _, err = conn.ExecContext(ctx, `
+        create table if not exists schema_migration (
+            version character varying(14) not null,
+            constraint schema_migration_pkey primary key (version)
+        )`)
+    if err != nil {
+        return fmt.Errorf("cannot create schema_migration table: %w", err)
+    }
+
+    rows, err := conn.QueryContext(ctx, `select version from schema_migration`)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    done := make(map[string]bool)
+    for rows.Next() {
+        var version string
+        err = rows.Scan(&version)
+        if err != nil {
+            return err
+        }
+        done[version] = true
+    }
+    if err = rows.Err(); err != nil {
+        return err
+    }
+    rows.Close()
+
+    return f(ctx, conn, migrations, done)
+}
+
+// run applies or rolls back a single migration in a transaction
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, direction string) error {
+    file, record := mig.Up, `insert into schema_migration (version) values ($1)`
+    if direction == "down" {
+        if mig.Down == "" {
+            return fmt.Errorf("migration %s_%s has no down file", mig.Version, mig.Name)
+        }
+        file, record = mig.Down, `delete from schema_migration where version = $1`
+    }
+
+    sql, err := statements(m.FS, file)
+    if err != nil {
+        return err
+    }
+
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if sql != "" {
+        _, err = tx.ExecContext(ctx, sql)
+        if err != nil {
+            return fmt.Errorf("%s: %w", file, err)
+        }
+    }
+
+    _, err = tx.ExecContext(ctx, record, mig.Version)
+    if err != nil {
+        return err
+    }
+
+    err = tx.Commit()
+    if err != nil {
+        return err
+    }
+
+    if m.Log != nil {
+        m.Log(direction, mig)
+    }
+    return nil
+}
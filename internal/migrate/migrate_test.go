@@ -0,0 +1,65 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/sanijo/rent-app/migrations"
+)
+
+func TestLoad(t *testing.T) {
+    fsys := fstest.MapFS{
+        "20230102000000_second.up.fizz": {Data: []byte(`drop_table("b")`)},
+        "20230101000000_first.postgres.up.sql": {Data: []byte("select 1;")},
+        "20230101000000_first.postgres.down.sql": {Data: []byte("select 2;")},
+        "20230101000000_first.mysql.up.sql": {Data: []byte("select 3;")},
+        "schema.sql": {Data: []byte("")},
+        "embed.go": {Data: []byte("")},
+    }
+
+    migs, err := Load(fsys)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(migs) != 2 {
+        t.Fatalf("expected 2 migrations, got %d", len(migs))
+    }
+    if migs[0].Version != "20230101000000" || migs[0].Name != "first" || migs[0].Up != "20230101000000_first.postgres.up.sql" || migs[0].Down != "20230101000000_first.postgres.down.sql" {
+        t.Errorf("unexpected first migration %+v", migs[0])
+    }
+    if migs[1].Version != "20230102000000" || migs[1].Down != "" {
+        t.Errorf("unexpected second migration %+v", migs[1])
+    }
+
+    _, err = Load(fstest.MapFS{"20230101000000_first.down.fizz": {Data: []byte("")}})
+    if err == nil {
+        t.Error("expected an error for a migration without up file, but got nil")
+    }
+}
+
+// TestEmbeddedMigrations checks that every migration of the app can be
+// translated in both directions
+func TestEmbeddedMigrations(t *testing.T) {
+    migs, err := Load(migrations.FS)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    versions, _ := migrations.Versions()
+    if len(migs) != len(versions) {
+        t.Errorf("expected %d migrations, got %d", len(versions), len(migs))
+    }
+
+    for _, m := range migs {
+        for _, file := range []string{m.Up, m.Down} {
+            if file == "" {
+                t.Errorf("migration %s has no down file", m.Version)
+                continue
+            }
+            if _, err := statements(migrations.FS, file); err != nil {
+                t.Errorf("for %s, unexpected error: %s", file, err)
+            }
+        }
+    }
+}
@@ -1,6 +1,31 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// AccessLevelAdmin is the minimum users.access_level allowed into the admin
+// area
+const AccessLevelAdmin = 3
+
+// Restriction type ids as seeded into the restriction_types table
+const (
+    RestrictionReservation = 1
+    RestrictionOwnerBlock = 2
+    RestrictionHold = 3
+)
+
+// Rent statuses. A rent is pending until its payment is captured, see
+// package rentstatus for the allowed changes.
+const (
+    RentPending = "pending"
+    RentConfirmed = "confirmed"
+    RentCheckedOut = "checked_out"
+    RentReturned = "returned"
+    RentCancelled = "cancelled"
+    RentNoShow = "no_show"
+)
 
 // User holds database users data
 type User struct {
@@ -14,14 +39,91 @@ type User struct {
     AccessLevel int
 }
 
+// Money is an amount in euro cents
+type Money int64
+
+// String formats the amount as e.g. €80.00
+func (m Money) String() string {
+    sign := ""
+    if m < 0 {
+        sign = "-"
+        m = -m
+    }
+    return fmt.Sprintf("%s€%d.%02d", sign, m/100, m%100)
+}
+
 // Model holds database models data
 type Model struct {
     ID int
     ModelName string
+    DailyRate Money
+    WeekendRate Money
+    // MinDays and MaxDays limit the rental length of the model, zero means
+    // the global booking rules apply
+    MinDays int
+    MaxDays int
+    // TurnaroundHours is how long a vehicle of the model is kept free after
+    // every rent, block or hold for cleaning and charging
+    TurnaroundHours int
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    // FreeUnits is the number of vehicles free for the searched dates, it is
+    // only set by availability searches
+    FreeUnits int
+}
+
+// TurnaroundDays returns the number of days after a return on which the
+// vehicle can't be picked up, that is the turnaround rounded up to whole days
+func (m Model) TurnaroundDays() int {
+    return (m.TurnaroundHours + 23) / 24
+}
+
+// Vehicle holds database vehicles data. A vehicle is a physical car of a
+// model, inactive vehicles are never booked.
+type Vehicle struct {
+    ID int
+    ModelID int
+    VIN string
+    Plate string
+    Color string
+    Active bool
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    Model Model
+}
+
+// RatePeriod holds database rate periods data. It overrides the rates of a
+// model between start and end date, e.g. for a summer season.
+type RatePeriod struct {
+    ID int
+    ModelID int
+    Name string
+    StartDate time.Time
+    EndDate time.Time
+    DailyRate Money
+    WeekendRate Money
     CreatedAt time.Time
     UpdatedAt time.Time
 }
 
+// RentalDiscount holds database rental discounts data. Rents of at least
+// MinDays days get Percent off.
+type RentalDiscount struct {
+    ID int
+    ModelID int
+    MinDays int
+    Percent int
+    CreatedAt time.Time
+    UpdatedAt time.Time
+}
+
+// PriceList holds the rates and discounts of a model
+type PriceList struct {
+    Model Model
+    Periods []RatePeriod
+    Discounts []RentalDiscount
+}
+
 // RestrictionType holds database restriction types data
 type RestrictionType struct {
     ID int
@@ -42,7 +144,27 @@ type Rent struct {
     ModelID int
     CreatedAt time.Time
     UpdatedAt time.Time
+    Processed int
+    TotalPrice Money
+    // Status is one of the Rent* status constants
+    Status string
+    // Reference is the code customers use to manage the rent
+    Reference string
     Model Model
+    // VehicleID is the vehicle assigned to the rent by its reservation
+    VehicleID int
+    Vehicle Vehicle
+}
+
+// RentStatusChange holds database rent status history data. ChangedBy tells
+// who changed the status, e.g. "user 1", "customer" or "payment".
+type RentStatusChange struct {
+    ID int
+    RentID int
+    FromStatus string
+    ToStatus string
+    ChangedBy string
+    CreatedAt time.Time
 }
 
 // RentRestriction holds database rent restrictions data
@@ -55,7 +177,48 @@ type RentRestriction struct {
     CreatedAt time.Time
     UpdatedAt time.Time
     RestrictionID int
+    VehicleID int
+    // ExternalUID is the iCalendar UID of owner blocks imported from other
+    // platforms
+    ExternalUID string
+    // ExpiresAt is when a hold is released, it is zero for other restrictions
+    ExpiresAt time.Time
     Model Model
+    Vehicle Vehicle
     Rent Rent
     Restriction RestrictionType
 }
+
+// OwnerBlockChange holds the owner blocks of a vehicle to delete and the days
+// to block, as saved from the admin calendar
+type OwnerBlockChange struct {
+    VehicleID int
+    AddDays []time.Time
+    RemoveIDs []int
+}
+
+// Payment holds database payments data. IntentID is the id of the payment at
+// the provider, Status one of the payments.Status constants.
+type Payment struct {
+    ID int
+    RentID int
+    Provider string
+    IntentID string
+    Amount Money
+    Currency string
+    Status string
+    // CheckoutURL is where the customer pays
+    CheckoutURL string
+    CreatedAt time.Time
+    UpdatedAt time.Time
+}
+
+// MailData holds an email message to be sent
+type MailData struct {
+    To string
+    From string
+    Subject string
+    Content string
+    Template string
+    Data map[string]interface{}
+}
@@ -13,4 +13,5 @@ type TemplateData struct {
     Warning string
     Error string
     Form *forms.Form
+    IsAuthenticated bool
 }
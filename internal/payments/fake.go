@@ -0,0 +1,179 @@
+package payments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+)
+
+// FakeCheckoutPath is the path of the checkout page of the fake provider, the
+// intent id is appended
+const FakeCheckoutPath = "/payment/fake/"
+
+// Fake is an in-process provider for development and tests. No money is
+// moved, the customer decides on the checkout page whether a payment succeeds
+// and the resulting webhook is signed like a real one. Intents are kept in
+// memory only.
+type Fake struct {
+    secret []byte
+    mu sync.Mutex
+    intents map[string]*fakeIntent
+    // Now returns the current time, it can be replaced in tests
+    Now func() time.Time
+}
+
+// fakeIntent is an intent together with the amount refunded so far
+type fakeIntent struct {
+    Intent
+    refunded models.Money
+}
+
+// NewFake returns a fake provider that signs webhooks with secret
+func NewFake(secret string) *Fake {
+    return &Fake{
+        secret: []byte(secret),
+        intents: make(map[string]*fakeIntent),
+        Now: time.Now,
+    }
+}
+
+// Name identifies the provider in the payments table
+func (f *Fake) Name() string {
+    return "fake"
+}
+
+// CreateIntent starts a payment of amount
+func (f *Fake) CreateIntent(amount models.Money, reference string) (Intent, error) {
+    b := make([]byte, 12)
+    if _, err := rand.Read(b); err != nil {
+        return Intent{}, err
+    }
+
+    id := "pi_fake_" + hex.EncodeToString(b)
+    intent := Intent{
+        ID: id,
+        Amount: amount,
+        Currency: "eur",
+        Status: StatusPending,
+        CheckoutURL: FakeCheckoutPath + id,
+    }
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.intents[id] = &fakeIntent{Intent: intent}
+
+    return intent, nil
+}
+
+// Pay authorizes an intent as if the customer paid, and returns the signed
+// webhook the provider sends
+func (f *Fake) Pay(intentID string) ([]byte, string, error) {
+    return f.settle(intentID, StatusAuthorized, EventAuthorized)
+}
+
+// Decline fails an intent as if the card was declined, and returns the signed
+// webhook the provider sends
+func (f *Fake) Decline(intentID string) ([]byte, string, error) {
+    return f.settle(intentID, StatusFailed, EventFailed)
+}
+
+// settle moves a pending or failed intent to status and returns the signed
+// webhook of eventType
+func (f *Fake) settle(intentID, status, eventType string) ([]byte, string, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    intent, ok := f.intents[intentID]
+    if !ok {
+        return nil, "", ErrUnknownIntent
+    }
+    // a declined payment can be tried again
+    if intent.Status != StatusPending && intent.Status != StatusFailed {
+        return nil, "", ErrInvalidStatus
+    }
+    intent.Status = status
+
+    payload, err := json.Marshal(Event{
+        Type: eventType,
+        IntentID: intentID,
+        Amount: intent.Amount,
+    })
+    if err != nil {
+        return nil, "", err
+    }
+
+    return payload, Sign(f.secret, payload, f.Now()), nil
+}
+
+// Capture collects an authorized payment, once
+func (f *Fake) Capture(intentID string) error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    intent, ok := f.intents[intentID]
+    if !ok {
+        return ErrUnknownIntent
+    }
+    if intent.Status == StatusCaptured {
+        return ErrAlreadyCaptured
+    }
+    if intent.Status != StatusAuthorized {
+        return ErrInvalidStatus
+    }
+    intent.Status = StatusCaptured
+
+    return nil
+}
+
+// Refund pays back amount of a captured payment, the intent is refunded once
+// the whole amount is paid back
+func (f *Fake) Refund(intentID string, amount models.Money) error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    intent, ok := f.intents[intentID]
+    if !ok {
+        return ErrUnknownIntent
+    }
+    if intent.Status != StatusCaptured || amount <= 0 || intent.refunded+amount > intent.Amount {
+        return ErrInvalidStatus
+    }
+    intent.refunded += amount
+    if intent.refunded == intent.Amount {
+        intent.Status = StatusRefunded
+    }
+
+    return nil
+}
+
+// VerifyWebhook checks the signature of a webhook and returns its event
+func (f *Fake) VerifyWebhook(payload []byte, signature string) (Event, error) {
+    var event Event
+
+    if err := Verify(f.secret, payload, signature, f.Now()); err != nil {
+        return event, err
+    }
+    if err := json.Unmarshal(payload, &event); err != nil {
+        return event, fmt.Errorf("invalid webhook payload: %w", err)
+    }
+
+    return event, nil
+}
+
+// Intent returns an intent by id
+func (f *Fake) Intent(intentID string) (Intent, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    intent, ok := f.intents[intentID]
+    if !ok {
+        return Intent{}, ErrUnknownIntent
+    }
+
+    return intent.Intent, nil
+}
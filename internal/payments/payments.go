@@ -0,0 +1,132 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+)
+
+// Payment statuses, both of intents at the provider and of rows in the
+// payments table
+const (
+    StatusPending = "pending"
+    StatusAuthorized = "authorized"
+    StatusCaptured = "captured"
+    StatusFailed = "failed"
+    StatusRefunded = "refunded"
+    // StatusCancelled is a payment replaced by a newer one of the same rent
+    StatusCancelled = "cancelled"
+)
+
+// Webhook event types
+const (
+    EventAuthorized = "payment.authorized"
+    EventFailed = "payment.failed"
+)
+
+// SignatureHeader carries the signature of webhook requests
+const SignatureHeader = "Payment-Signature"
+
+// signatureTolerance is how old a signed webhook may be, older ones are
+// rejected as replays
+const signatureTolerance = 5 * time.Minute
+
+// ErrInvalidSignature is returned for webhooks with a missing, wrong or
+// expired signature
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// ErrUnknownIntent is returned for intents the provider doesn't know
+var ErrUnknownIntent = errors.New("unknown payment intent")
+
+// ErrInvalidStatus is returned when an intent can't be captured or refunded
+// in its current status
+var ErrInvalidStatus = errors.New("payment intent has the wrong status")
+
+// ErrAlreadyCaptured is returned when capturing an intent that has been
+// captured before
+var ErrAlreadyCaptured = errors.New("payment intent has been captured already")
+
+// Intent is a payment the customer is asked to make
+type Intent struct {
+    ID string
+    Amount models.Money
+    Currency string
+    Status string
+    // CheckoutURL is where the customer pays
+    CheckoutURL string
+}
+
+// Event is a webhook notification from the provider
+type Event struct {
+    Type string `json:"type"`
+    IntentID string `json:"intent_id"`
+    Amount models.Money `json:"amount"`
+}
+
+// Provider is a payment service provider
+type Provider interface {
+    // Name identifies the provider in the payments table
+    Name() string
+    // CreateIntent starts a payment of amount, reference is shown to the
+    // customer, e.g. the rent id
+    CreateIntent(amount models.Money, reference string) (Intent, error)
+    // Capture collects an authorized payment. It returns ErrAlreadyCaptured
+    // if the payment has been collected before.
+    Capture(intentID string) error
+    // Refund pays back amount of a captured payment
+    Refund(intentID string, amount models.Money) error
+    // VerifyWebhook checks the signature of a webhook request and returns its
+    // event
+    VerifyWebhook(payload []byte, signature string) (Event, error)
+}
+
+// Sign returns the signature header for payload sent at t, e.g.
+// t=1690000000,v1=5257a869...
+func Sign(secret, payload []byte, t time.Time) string {
+    ts := strconv.FormatInt(t.Unix(), 10)
+    return fmt.Sprintf("t=%s,v1=%s", ts, signature(secret, ts, payload))
+}
+
+// Verify checks a signature header made by Sign against payload. Signatures
+// older than five minutes at now are rejected.
+func Verify(secret, payload []byte, header string, now time.Time) error {
+    var ts, sig string
+    for _, part := range strings.Split(header, ",") {
+        key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+        switch key {
+        case "t":
+            ts = value
+        case "v1":
+            sig = value
+        }
+    }
+
+    unix, err := strconv.ParseInt(ts, 10, 64)
+    if err != nil || sig == "" {
+        return ErrInvalidSignature
+    }
+    if age := now.Sub(time.Unix(unix, 0)); age > signatureTolerance || age < -signatureTolerance {
+        return ErrInvalidSignature
+    }
+    if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, payload))) {
+        return ErrInvalidSignature
+    }
+
+    return nil
+}
+
+// signature is the hex HMAC-SHA256 of the timestamp and payload
+func signature(secret []byte, ts string, payload []byte) string {
+    mac := hmac.New(sha256.New, secret)
+    mac.Write([]byte(ts))
+    mac.Write([]byte("."))
+    mac.Write(payload)
+    return hex.EncodeToString(mac.Sum(nil))
+}
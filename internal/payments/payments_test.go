@@ -0,0 +1,112 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+    secret := []byte("0123456789abcdef")
+    payload := []byte(`{"type":"payment.authorized"}`)
+    now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+    header := Sign(secret, payload, now)
+
+    var tests = []struct {
+        name string
+        secret []byte
+        payload []byte
+        header string
+        now time.Time
+        valid bool
+    }{
+        {"valid", secret, payload, header, now, true},
+        {"valid a minute later", secret, payload, header, now.Add(time.Minute), true},
+        {"expired", secret, payload, header, now.Add(10 * time.Minute), false},
+        {"changed payload", secret, []byte(`{"type":"payment.failed"}`), header, now, false},
+        {"wrong secret", []byte("fedcba9876543210"), payload, header, now, false},
+        {"missing signature", secret, payload, "", now, false},
+        {"missing timestamp", secret, payload, "v1=abc", now, false},
+    }
+
+    for _, e := range tests {
+        err := Verify(e.secret, e.payload, e.header, e.now)
+        if e.valid && err != nil {
+            t.Errorf("for %s, expected valid signature, got %s", e.name, err)
+        }
+        if !e.valid && !errors.Is(err, ErrInvalidSignature) {
+            t.Errorf("for %s, expected ErrInvalidSignature, got %v", e.name, err)
+        }
+    }
+}
+
+func TestFake(t *testing.T) {
+    f := NewFake("0123456789abcdef")
+    var _ Provider = f
+
+    intent, err := f.CreateIntent(16000, "rent 1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if intent.Status != StatusPending || intent.CheckoutURL != FakeCheckoutPath+intent.ID {
+        t.Errorf("unexpected intent %+v", intent)
+    }
+
+    // Case 1: capture before payment fails
+    if err := f.Capture(intent.ID); !errors.Is(err, ErrInvalidStatus) {
+        t.Errorf("expected ErrInvalidStatus capturing a pending intent, got %v", err)
+    }
+
+    // Case 2: a declined payment can be tried again
+    payload, sig, err := f.Decline(intent.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    event, err := f.VerifyWebhook(payload, sig)
+    if err != nil || event.Type != EventFailed || event.IntentID != intent.ID {
+        t.Errorf("unexpected event %+v, %v", event, err)
+    }
+
+    payload, sig, err = f.Pay(intent.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    event, err = f.VerifyWebhook(payload, sig)
+    if err != nil || event.Type != EventAuthorized || event.Amount != 16000 {
+        t.Errorf("unexpected event %+v, %v", event, err)
+    }
+
+    // Case 3: tampered webhooks are rejected
+    if _, err := f.VerifyWebhook(append(payload, ' '), sig); !errors.Is(err, ErrInvalidSignature) {
+        t.Errorf("expected ErrInvalidSignature for tampered payload, got %v", err)
+    }
+
+    // Case 4: capture and partial refunds
+    if err := f.Capture(intent.ID); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := f.Pay(intent.ID); !errors.Is(err, ErrInvalidStatus) {
+        t.Errorf("expected ErrInvalidStatus paying a captured intent, got %v", err)
+    }
+    if err := f.Capture(intent.ID); !errors.Is(err, ErrAlreadyCaptured) {
+        t.Errorf("expected ErrAlreadyCaptured capturing twice, got %v", err)
+    }
+    if err := f.Refund(intent.ID, 6000); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Refund(intent.ID, 12000); !errors.Is(err, ErrInvalidStatus) {
+        t.Errorf("expected ErrInvalidStatus refunding more than paid, got %v", err)
+    }
+    if err := f.Refund(intent.ID, 10000); err != nil {
+        t.Fatal(err)
+    }
+    intent, _ = f.Intent(intent.ID)
+    if intent.Status != StatusRefunded {
+        t.Errorf("expected refunded intent, got %s", intent.Status)
+    }
+
+    // Case 5: unknown intents
+    if err := f.Capture("pi_nope"); !errors.Is(err, ErrUnknownIntent) {
+        t.Errorf("expected ErrUnknownIntent, got %v", err)
+    }
+}
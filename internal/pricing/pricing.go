@@ -0,0 +1,110 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+)
+
+// LineItem is a single line of a quote, e.g. 3 weekdays at €80.00
+type LineItem struct {
+    Description string
+    Days int
+    UnitPrice models.Money
+    Amount models.Money
+}
+
+// Quote is the itemized price of renting a model between two dates
+type Quote struct {
+    ModelID int
+    StartDate time.Time
+    EndDate time.Time
+    Days int
+    Items []LineItem
+    Subtotal models.Money
+    DiscountPercent int
+    Discount models.Money
+    Total models.Money
+}
+
+// Calculate returns the quote for renting the model of pl from start to end.
+// Every day in [start, end) is charged at the rate of the first rate period
+// covering it, or at the model rate otherwise. Saturdays and Sundays use the
+// weekend rate if one is set. The largest discount whose MinDays is reached
+// is applied to the subtotal.
+func Calculate(pl models.PriceList, start, end time.Time) Quote {
+    quote := Quote{
+        ModelID: pl.Model.ID,
+        StartDate: start,
+        EndDate: end,
+    }
+
+    // index of each line item by description, to keep the order in which
+    // the items first occur
+    index := make(map[string]int)
+
+    for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+        description, price := dayRate(pl, d)
+
+        i, ok := index[description]
+        if !ok {
+            i = len(quote.Items)
+            index[description] = i
+            quote.Items = append(quote.Items, LineItem{
+                Description: description,
+                UnitPrice: price,
+            })
+        }
+
+        quote.Items[i].Days++
+        quote.Items[i].Amount += price
+        quote.Days++
+        quote.Subtotal += price
+    }
+
+    for _, discount := range pl.Discounts {
+        if quote.Days >= discount.MinDays && discount.Percent > quote.DiscountPercent {
+            quote.DiscountPercent = discount.Percent
+        }
+    }
+
+    // round the discount to the nearest cent
+    quote.Discount = (quote.Subtotal*models.Money(quote.DiscountPercent) + 50) / 100
+    quote.Total = quote.Subtotal - quote.Discount
+
+    return quote
+}
+
+// dayRate returns the line item description and price for a single day
+func dayRate(pl models.PriceList, d time.Time) (string, models.Money) {
+    name := ""
+    daily := pl.Model.DailyRate
+    weekend := pl.Model.WeekendRate
+
+    for _, period := range pl.Periods {
+        if !d.Before(period.StartDate) && d.Before(period.EndDate) {
+            name = period.Name
+            daily = period.DailyRate
+            weekend = period.WeekendRate
+            break
+        }
+    }
+
+    // without a weekend rate every day costs the same
+    kind := "Day"
+    price := daily
+    if weekend > 0 {
+        kind = "Weekday"
+        if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+            kind = "Weekend day"
+            price = weekend
+        }
+    }
+
+    if name != "" {
+        return fmt.Sprintf("%s (%s)", kind, name), price
+    }
+
+    return kind, price
+}
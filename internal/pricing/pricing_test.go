@@ -0,0 +1,100 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+)
+
+func date(s string) time.Time {
+    d, _ := time.Parse("2006-01-02", s)
+    return d
+}
+
+var priceList = models.PriceList{
+    Model: models.Model{
+        ID: 1,
+        DailyRate: 8000,
+        WeekendRate: 10000,
+    },
+    Periods: []models.RatePeriod{
+        {
+            Name: "Summer",
+            StartDate: date("2050-07-01"),
+            EndDate: date("2050-09-01"),
+            DailyRate: 12000,
+            WeekendRate: 15000,
+        },
+    },
+    Discounts: []models.RentalDiscount{
+        {MinDays: 7, Percent: 10},
+        {MinDays: 28, Percent: 20},
+    },
+}
+
+var calculateTests = []struct {
+    name string
+    priceList models.PriceList
+    start string
+    end string
+    expectedDays int
+    expectedItems int
+    expectedDiscount models.Money
+    expectedTotal models.Money
+}{
+    // 2050-01-03 is a Monday
+    {"weekdays only", priceList, "2050-01-03", "2050-01-06", 3, 1, 0, 24000},
+    {"weekdays and weekend", priceList, "2050-01-06", "2050-01-10", 4, 2, 0, 36000},
+    {"one week with discount", priceList, "2050-01-03", "2050-01-10", 7, 2, 6000, 54000},
+    {"four weeks with larger discount", priceList, "2050-01-03", "2050-01-31", 28, 2, 48000, 192000},
+    {"into summer season", priceList, "2050-06-29", "2050-07-02", 3, 2, 0, 28000},
+    {"no weekend rate", models.PriceList{Model: models.Model{DailyRate: 5000}}, "2050-01-06", "2050-01-10", 4, 1, 0, 20000},
+    {"end before start", priceList, "2050-01-06", "2050-01-03", 0, 0, 0, 0},
+}
+
+func TestCalculate(t *testing.T) {
+    for _, e := range calculateTests {
+        quote := Calculate(e.priceList, date(e.start), date(e.end))
+
+        if quote.Days != e.expectedDays {
+            t.Errorf("for %s, expected %d days but got %d", e.name, e.expectedDays, quote.Days)
+        }
+        if len(quote.Items) != e.expectedItems {
+            t.Errorf("for %s, expected %d line items but got %d", e.name, e.expectedItems, len(quote.Items))
+        }
+        if quote.Discount != e.expectedDiscount {
+            t.Errorf("for %s, expected discount %s but got %s", e.name, e.expectedDiscount, quote.Discount)
+        }
+        if quote.Total != e.expectedTotal {
+            t.Errorf("for %s, expected total %s but got %s", e.name, e.expectedTotal, quote.Total)
+        }
+
+        // line items have to add up to the subtotal
+        var sum models.Money
+        for _, item := range quote.Items {
+            sum += item.Amount
+        }
+        if sum != quote.Subtotal {
+            t.Errorf("for %s, line items add up to %s but subtotal is %s", e.name, sum, quote.Subtotal)
+        }
+    }
+}
+
+func TestMoney_String(t *testing.T) {
+    var tests = []struct {
+        money models.Money
+        expected string
+    }{
+        {0, "€0.00"},
+        {8000, "€80.00"},
+        {12345, "€123.45"},
+        {-505, "-€5.05"},
+    }
+
+    for _, e := range tests {
+        if e.money.String() != e.expected {
+            t.Errorf("expected %s but got %s", e.expected, e.money.String())
+        }
+    }
+}
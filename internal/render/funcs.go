@@ -0,0 +1,122 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/rentstatus"
+)
+
+// functions are available in every page, layout and email template
+var functions = template.FuncMap{
+    "humanDate": HumanDate,
+    "isoDate": ISODate,
+    "nights": Nights,
+    "currency": Currency,
+    "pluralize": Pluralize,
+    "add": Add,
+    "seq": Seq,
+    "checked": Checked,
+    "selected": Selected,
+    "disabled": Disabled,
+    "statusLabel": rentstatus.Label,
+}
+
+// Functions returns the template functions, for packages that parse their
+// own templates
+func Functions() template.FuncMap {
+    return functions
+}
+
+// HumanDate formats t for people, e.g. Mon, 2 Jan 2006. The zero time is
+// formatted as an empty string.
+func HumanDate(t time.Time) string {
+    if t.IsZero() {
+        return ""
+    }
+    return t.Format("Mon, 2 Jan 2006")
+}
+
+// ISODate formats t as used in forms and urls, e.g. 2006-01-02. The zero time
+// is formatted as an empty string.
+func ISODate(t time.Time) string {
+    if t.IsZero() {
+        return ""
+    }
+    return t.Format("2006-01-02")
+}
+
+// Nights returns the number of nights between start and end, rents are
+// charged per night
+func Nights(start, end time.Time) int {
+    if !end.After(start) {
+        return 0
+    }
+    return int(end.Sub(start).Hours()+12) / 24
+}
+
+// Currency formats an amount in cents, e.g. €80.00. It accepts models.Money
+// and plain integers.
+func Currency(v interface{}) (string, error) {
+    switch a := v.(type) {
+    case models.Money:
+        return a.String(), nil
+    case int:
+        return models.Money(a).String(), nil
+    case int64:
+        return models.Money(a).String(), nil
+    default:
+        return "", fmt.Errorf("currency: unsupported type %T", v)
+    }
+}
+
+// Pluralize returns singular if n is 1 and plural otherwise
+func Pluralize(n int, singular, plural string) string {
+    if n == 1 {
+        return singular
+    }
+    return plural
+}
+
+// Add returns a + b
+func Add(a, b int) int {
+    return a + b
+}
+
+// Seq returns the numbers from 0 to n-1, to range n times in a template
+func Seq(n int) []int {
+    if n < 0 {
+        n = 0
+    }
+    s := make([]int, n)
+    for i := range s {
+        s[i] = i
+    }
+    return s
+}
+
+// boolAttr returns name as attribute if on is true. The attribute is a
+// constant, so it is safe to insert into a tag.
+func boolAttr(name string, on bool) template.HTMLAttr {
+    if on {
+        return template.HTMLAttr(name)
+    }
+    return ""
+}
+
+// Checked returns the checked attribute if on is true
+func Checked(on bool) template.HTMLAttr {
+    return boolAttr("checked", on)
+}
+
+// Selected returns the selected attribute if on is true
+func Selected(on bool) template.HTMLAttr {
+    return boolAttr("selected", on)
+}
+
+// Disabled returns the disabled attribute if on is true
+func Disabled(on bool) template.HTMLAttr {
+    return boolAttr("disabled", on)
+}
@@ -0,0 +1,93 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+)
+
+func date(s string) time.Time {
+    d, _ := time.Parse("2006-01-02", s)
+    return d
+}
+
+func TestDates(t *testing.T) {
+    if got := HumanDate(date("2050-01-03")); got != "Mon, 3 Jan 2050" {
+        t.Errorf("expected Mon, 3 Jan 2050, got %s", got)
+    }
+    if got := ISODate(date("2050-01-03")); got != "2050-01-03" {
+        t.Errorf("expected 2050-01-03, got %s", got)
+    }
+    if HumanDate(time.Time{}) != "" || ISODate(time.Time{}) != "" {
+        t.Error("expected zero time to be formatted as empty string")
+    }
+}
+
+var nightsTests = []struct {
+    start time.Time
+    end time.Time
+    expected int
+}{
+    {date("2050-01-01"), date("2050-01-04"), 3},
+    {date("2050-01-01"), date("2050-01-01"), 0},
+    {date("2050-01-04"), date("2050-01-01"), 0},
+    // daylight saving time change in between
+    {time.Date(2050, 3, 26, 0, 0, 0, 0, time.FixedZone("CET", 3600)), time.Date(2050, 3, 28, 0, 0, 0, 0, time.FixedZone("CEST", 7200)), 2},
+}
+
+func TestNights(t *testing.T) {
+    for _, e := range nightsTests {
+        if got := Nights(e.start, e.end); got != e.expected {
+            t.Errorf("for %s - %s, expected %d nights, got %d", e.start, e.end, e.expected, got)
+        }
+    }
+}
+
+func TestCurrency(t *testing.T) {
+    for _, v := range []interface{}{models.Money(8050), 8050, int64(8050)} {
+        got, err := Currency(v)
+        if err != nil {
+            t.Errorf("for %T, unexpected error: %s", v, err)
+        }
+        if got != "€80.50" {
+            t.Errorf("for %T, expected €80.50, got %s", v, got)
+        }
+    }
+
+    if _, err := Currency("80"); err == nil {
+        t.Error("expected an error for a string, but got nil")
+    }
+}
+
+func TestHelpers(t *testing.T) {
+    if Pluralize(1, "day", "days") != "day" || Pluralize(2, "day", "days") != "days" || Pluralize(0, "day", "days") != "days" {
+        t.Error("pluralize returned wrong word")
+    }
+    if Add(2, 3) != 5 {
+        t.Error("expected 2 + 3 to be 5")
+    }
+    if !reflect.DeepEqual(Seq(3), []int{0, 1, 2}) || len(Seq(-1)) != 0 {
+        t.Error("seq returned wrong numbers")
+    }
+}
+
+func TestFunctionsInTemplate(t *testing.T) {
+    tmpl := template.Must(template.New("t").Funcs(Functions()).Parse(
+        `<input type="checkbox" {{checked .On}}><option {{selected .Off}}>{{range seq 2}}{{add . 1}}{{end}}`,
+    ))
+
+    var buf bytes.Buffer
+    err := tmpl.Execute(&buf, map[string]bool{"On": true, "Off": false})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    want := `<input type="checkbox" checked><option >12`
+    if buf.String() != want {
+        t.Errorf("expected %q, got %q", want, buf.String())
+    }
+}
@@ -2,21 +2,19 @@ package render
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"net/http"
-	"path/filepath"
+	"path"
 
 	"github.com/justinas/nosurf"
 	"github.com/sanijo/rent-app/internal/config"
 	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/templates"
 )
 
-var functions = template.FuncMap{}
-
 var app *config.AppConfig
-var pathToTemplates = "./templates"
 
 // NewRenderer sets the config for the template package
 func NewRenderer(a *config.AppConfig) {
@@ -28,6 +26,7 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
     td.Warning = app.Session.PopString(r.Context(), "warning")
     td.Error = app.Session.PopString(r.Context(), "error")
     td.CSRFToken = nosurf.Token(r)
+    td.IsAuthenticated = app.Session.Exists(r.Context(), "user_id")
     return td
 }
 
@@ -43,7 +42,7 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
     } else {
         tc, err = CreateTemplateCache()
 	    if err != nil {
-            fmt.Println("Cannot create template cache:", err)
+            app.Logger.ErrorContext(r.Context(), "cannot create template cache", "error", err)
             http.Error(w, "Internal Server Error", http.StatusInternalServerError)
             return err
 	    }
@@ -52,10 +51,9 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
     // Get requested template from cache
     t, available := tc[tmpl]
     if !available {
-        err := fmt.Sprintf("Template unavailable: %s", tmpl)
-        fmt.Println(err)
+        app.Logger.ErrorContext(r.Context(), "template unavailable", "template", tmpl)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return errors.New(err)
+		return fmt.Errorf("template unavailable: %s", tmpl)
     }
 
     // Render the template
@@ -66,13 +64,13 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 
     err = t.Execute(buffer, td)
     if err != nil {
-        fmt.Println("Error executing template:", err)
+        app.Logger.ErrorContext(r.Context(), "cannot execute template", "template", tmpl, "error", err)
         http.Error(w, "Internal Server Error", http.StatusInternalServerError)
         return err
     }
     _, err = buffer.WriteTo(w)
     if err != nil {
-        fmt.Println("Error writing template to response:", err)
+        app.Logger.ErrorContext(r.Context(), "cannot write template to response", "template", tmpl, "error", err)
         http.Error(w, "Internal Server Error", http.StatusInternalServerError)
         return err
     }
@@ -80,40 +78,43 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
     return nil
 }
 
+// templateFS returns where templates are read from, the embedded templates
+// unless the config says otherwise
+func templateFS() fs.FS {
+    if app != nil && app.TemplateFS != nil {
+        return app.TemplateFS
+    }
+    return templates.FS
+}
+
 //CreateTemplateCache creates a template cache as a map
 func CreateTemplateCache() (map[string]*template.Template, error) {
     // Create empty cache map of pointers to templates
     cache := make(map[string]*template.Template)
+
+    fsys := templateFS()
    
-    // Get all files ending with *.page.html from ./templates/
-    pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.html", pathToTemplates))
+    // Get all files ending with *.page.html
+    pages, err := fs.Glob(fsys, "*.page.html")
+    if err != nil {
+        return cache, err
+    }
+
+    // Get all files ending with *.layout.html
+    layouts, err := fs.Glob(fsys, "*.layout.html")
     if err != nil {
         return cache, err
     }
 
     // Iterate through each page template file ending with *.page.html
     for _, page := range pages {
-        name := filepath.Base(page)
-        // Parse the page template file
-        ts, err := template.New(name).Funcs(functions).ParseFiles(page)
+        name := path.Base(page)
+        // Parse the page template file together with all layouts
+        ts, err := template.New(name).Funcs(functions).ParseFS(fsys, append([]string{page}, layouts...)...)
         if err != nil {
             return cache, err
         }
 
-        // Get all files ending with *.layout.html
-        layouts, err := filepath.Glob(fmt.Sprintf("%s/*.layout.html", pathToTemplates))
-        if err != nil {
-            return cache, err
-        }
-        
-        // If layout files exist, parse and add them to the template set
-        if len(layouts) > 0 {
-            ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.html", pathToTemplates))
-            if err != nil {
-                return cache, err
-            }
-        }
-
         // Add the parsed template to the cache map
         cache[name] = ts
     }
@@ -26,7 +26,6 @@ func TestAddDefaultData(t *testing.T) {
 }
 
 func TestTemplate(t *testing.T) {
-    pathToTemplates = "./../../templates"
     tc, err := CreateTemplateCache()
     if err != nil {
         t.Error(err)
@@ -73,7 +72,6 @@ func TestNewRenderer(t *testing.T) {
 }
 
 func TestCreateTemplateCache(t *testing.T) {
-    pathToTemplates = "./../../templates"
 
     _, err := CreateTemplateCache()
     if err != nil {
@@ -2,7 +2,7 @@ package render
 
 import (
 	"encoding/gob"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
@@ -10,6 +10,7 @@ import (
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/sanijo/rent-app/internal/config"
+	"github.com/sanijo/rent-app/internal/logging"
 	"github.com/sanijo/rent-app/internal/models"
 )
 
@@ -25,11 +26,8 @@ func TestMain(m *testing.M) {
     // Change to true if in production
     testApp.InProduction = false
 
-    // Set up info and error loggers
-    infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-    testApp.InfoLog = infoLog
-    errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-    testApp.ErrorLog = errorLog
+    // Set up logger
+    testApp.Logger = logging.New(os.Stdout, "text", slog.LevelInfo)
 
     session = scs.New()
     session.Lifetime = 24 * time.Hour
@@ -0,0 +1,123 @@
+// Package rentstatus is the state machine of rent statuses. A rent is
+// pending until paid, then confirmed. It is checked out when the customer
+// picks up the vehicle and returned when it is brought back. Rents can be
+// cancelled before pick-up, and marked as no-show if nobody came.
+package rentstatus
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+)
+
+// ErrInvalidTransition is returned for status changes the state machine
+// doesn't allow, e.g. returning a rent that was never checked out
+var ErrInvalidTransition = errors.New("invalid status change")
+
+// ErrTooEarly is returned when a rent is checked out or marked as no-show
+// before its start date
+var ErrTooEarly = errors.New("rent hasn't started yet")
+
+// ErrRefundFailed is returned by Cancel when the rent was cancelled, but its
+// payment couldn't be refunded and has to be refunded by hand
+var ErrRefundFailed = errors.New("rent cancelled, but the payment couldn't be refunded")
+
+// Store is the part of the repository Cancel needs
+type Store interface {
+    UpdateRentStatus(id int, from, to, changedBy string) error
+    GetPaymentByRentID(rentID int) (models.Payment, error)
+    UpdatePaymentStatus(id int, status string) error
+}
+
+// Refunder pays back captured payments, e.g. a payments.Provider
+type Refunder interface {
+    Refund(intentID string, amount models.Money) error
+}
+
+// transitions lists the statuses a rent can change to from each status.
+// Returned, cancelled and no-show rents are final.
+var transitions = map[string][]string{
+    models.RentPending: {models.RentConfirmed, models.RentCancelled},
+    models.RentConfirmed: {models.RentCheckedOut, models.RentCancelled, models.RentNoShow},
+    models.RentCheckedOut: {models.RentReturned},
+}
+
+// labels are the statuses as shown to people
+var labels = map[string]string{
+    models.RentPending: "Awaiting payment",
+    models.RentConfirmed: "Confirmed",
+    models.RentCheckedOut: "Checked out",
+    models.RentReturned: "Returned",
+    models.RentCancelled: "Cancelled",
+    models.RentNoShow: "No-show",
+}
+
+// Next returns the statuses a rent in status from can change to
+func Next(from string) []string {
+    return transitions[from]
+}
+
+// Check returns an error if rent can't change to status to at now
+func Check(rent models.Rent, to string, now time.Time) error {
+    allowed := false
+    for _, s := range transitions[rent.Status] {
+        if s == to {
+            allowed = true
+        }
+    }
+    if !allowed {
+        return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, Label(rent.Status), Label(to))
+    }
+
+    // the vehicle can be picked up, or not, from the start date on
+    if (to == models.RentCheckedOut || to == models.RentNoShow) && now.Before(rent.StartDate) {
+        return fmt.Errorf("%w, it starts on %s", ErrTooEarly, rent.StartDate.Format("2006-01-02"))
+    }
+
+    return nil
+}
+
+// Label returns status as shown to people
+func Label(status string) string {
+    if l, ok := labels[status]; ok {
+        return l
+    }
+    return status
+}
+
+// Cancel cancels rent, which frees its vehicle, and refunds the total price
+// if the rent was paid. Errors of the status change are returned as they are,
+// e.g. repository.ErrStatusChanged, refund errors wrap ErrRefundFailed.
+func Cancel(store Store, refunder Refunder, rent models.Rent, changedBy string) error {
+    err := store.UpdateRentStatus(rent.ID, rent.Status, models.RentCancelled, changedBy)
+    if err != nil {
+        return err
+    }
+
+    if rent.Status != models.RentConfirmed {
+        return nil
+    }
+
+    payment, err := store.GetPaymentByRentID(rent.ID)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil
+    }
+    if err == nil && payment.Status != payments.StatusCaptured {
+        return nil
+    }
+    if err == nil {
+        err = refunder.Refund(payment.IntentID, rent.TotalPrice)
+    }
+    if err == nil {
+        err = store.UpdatePaymentStatus(payment.ID, payments.StatusRefunded)
+    }
+    if err != nil {
+        return fmt.Errorf("%w: %s", ErrRefundFailed, err)
+    }
+
+    return nil
+}
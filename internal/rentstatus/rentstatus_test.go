@@ -0,0 +1,169 @@
+package rentstatus
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+)
+
+func TestCheck(t *testing.T) {
+    start := time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+    before := start.Add(-time.Hour)
+    after := start.Add(10 * time.Hour)
+
+    var tests = []struct {
+        name string
+        from string
+        to string
+        now time.Time
+        expected error
+    }{
+        {"pay", models.RentPending, models.RentConfirmed, before, nil},
+        {"cancel pending", models.RentPending, models.RentCancelled, before, nil},
+        {"cancel confirmed", models.RentConfirmed, models.RentCancelled, before, nil},
+        {"check out", models.RentConfirmed, models.RentCheckedOut, after, nil},
+        {"check out on the start date", models.RentConfirmed, models.RentCheckedOut, start, nil},
+        {"check out too early", models.RentConfirmed, models.RentCheckedOut, before, ErrTooEarly},
+        {"no-show", models.RentConfirmed, models.RentNoShow, after, nil},
+        {"no-show too early", models.RentConfirmed, models.RentNoShow, before, ErrTooEarly},
+        {"return", models.RentCheckedOut, models.RentReturned, after, nil},
+        {"check out unpaid", models.RentPending, models.RentCheckedOut, after, ErrInvalidTransition},
+        {"return without check out", models.RentConfirmed, models.RentReturned, after, ErrInvalidTransition},
+        {"cancel checked out", models.RentCheckedOut, models.RentCancelled, after, ErrInvalidTransition},
+        {"reopen cancelled", models.RentCancelled, models.RentConfirmed, before, ErrInvalidTransition},
+        {"reopen no-show", models.RentNoShow, models.RentConfirmed, after, ErrInvalidTransition},
+        {"unknown status", models.RentConfirmed, "lost", after, ErrInvalidTransition},
+        {"same status", models.RentConfirmed, models.RentConfirmed, after, ErrInvalidTransition},
+    }
+
+    for _, e := range tests {
+        rent := models.Rent{Status: e.from, StartDate: start}
+        err := Check(rent, e.to, e.now)
+        if e.expected == nil && err != nil {
+            t.Errorf("for %s, unexpected error %s", e.name, err)
+        }
+        if e.expected != nil && !errors.Is(err, e.expected) {
+            t.Errorf("for %s, expected %s but got %v", e.name, e.expected, err)
+        }
+    }
+}
+
+func TestNext(t *testing.T) {
+    for _, status := range []string{models.RentReturned, models.RentCancelled, models.RentNoShow} {
+        if len(Next(status)) != 0 {
+            t.Errorf("expected %s to be final, got %v", status, Next(status))
+        }
+    }
+
+    // every status a rent can change to is allowed by Check
+    now := time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+    for from := range transitions {
+        for _, to := range Next(from) {
+            if err := Check(models.Rent{Status: from}, to, now); err != nil {
+                t.Errorf("expected %s to %s to be allowed, got %s", from, to, err)
+            }
+        }
+    }
+}
+
+func TestLabel(t *testing.T) {
+    if Label(models.RentCheckedOut) != "Checked out" {
+        t.Errorf("expected Checked out, got %s", Label(models.RentCheckedOut))
+    }
+    if Label("lost") != "lost" {
+        t.Errorf("expected unknown statuses as they are, got %s", Label("lost"))
+    }
+}
+
+// fakeStore holds one payment and records the status changes
+type fakeStore struct {
+    payment *models.Payment
+    statusErr error
+    rentStatus string
+    paymentStatus string
+}
+
+func (f *fakeStore) UpdateRentStatus(id int, from, to, changedBy string) error {
+    if f.statusErr != nil {
+        return f.statusErr
+    }
+    f.rentStatus = to
+    return nil
+}
+
+func (f *fakeStore) GetPaymentByRentID(rentID int) (models.Payment, error) {
+    if f.payment == nil {
+        return models.Payment{}, sql.ErrNoRows
+    }
+    return *f.payment, nil
+}
+
+func (f *fakeStore) UpdatePaymentStatus(id int, status string) error {
+    f.paymentStatus = status
+    return nil
+}
+
+// fakeRefunder records refunds, or fails them with err
+type fakeRefunder struct {
+    err error
+    refunded models.Money
+}
+
+func (f *fakeRefunder) Refund(intentID string, amount models.Money) error {
+    if f.err != nil {
+        return f.err
+    }
+    f.refunded += amount
+    return nil
+}
+
+func TestCancel(t *testing.T) {
+    captured := &models.Payment{ID: 1, IntentID: "pi_1", Amount: 16000, Status: payments.StatusCaptured}
+    pending := &models.Payment{ID: 1, IntentID: "pi_1", Amount: 16000, Status: payments.StatusPending}
+    statusErr := errors.New("status changed")
+
+    var tests = []struct {
+        name string
+        status string
+        payment *models.Payment
+        statusErr error
+        refundErr error
+        expectedErr error
+        expectedRefund models.Money
+        expectedPaymentStatus string
+    }{
+        {"paid rent", models.RentConfirmed, captured, nil, nil, nil, 12000, payments.StatusRefunded},
+        {"pending rent", models.RentPending, pending, nil, nil, nil, 0, ""},
+        {"confirmed without payment", models.RentConfirmed, nil, nil, nil, nil, 0, ""},
+        {"payment not captured", models.RentConfirmed, pending, nil, nil, nil, 0, ""},
+        {"status change fails", models.RentConfirmed, captured, statusErr, nil, statusErr, 0, ""},
+        {"refund fails", models.RentConfirmed, captured, nil, errors.New("declined"), ErrRefundFailed, 0, ""},
+    }
+
+    for _, e := range tests {
+        store := &fakeStore{payment: e.payment, statusErr: e.statusErr}
+        refunder := &fakeRefunder{err: e.refundErr}
+        rent := models.Rent{ID: 1, Status: e.status, TotalPrice: 12000}
+
+        err := Cancel(store, refunder, rent, "test")
+        if e.expectedErr == nil && err != nil {
+            t.Errorf("for %s, unexpected error %s", e.name, err)
+        }
+        if e.expectedErr != nil && !errors.Is(err, e.expectedErr) {
+            t.Errorf("for %s, expected %s but got %v", e.name, e.expectedErr, err)
+        }
+        if e.statusErr == nil && store.rentStatus != models.RentCancelled {
+            t.Errorf("for %s, expected the rent to be cancelled, got %q", e.name, store.rentStatus)
+        }
+        if refunder.refunded != e.expectedRefund {
+            t.Errorf("for %s, expected a refund of %d, got %d", e.name, e.expectedRefund, refunder.refunded)
+        }
+        if store.paymentStatus != e.expectedPaymentStatus {
+            t.Errorf("for %s, expected payment status %q, got %q", e.name, e.expectedPaymentStatus, store.paymentStatus)
+        }
+    }
+}
@@ -2,11 +2,22 @@ package dbrepo
 
 import (
 	"database/sql"
+	"errors"
 
 	"github.com/sanijo/rent-app/internal/config"
 	"github.com/sanijo/rent-app/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// exclusionViolation is the postgres error code raised when a row conflicts
+// with an exclusion constraint, e.g. rent_restrictions_no_overlap_excl.
+const exclusionViolation = "23P01"
+
+// uniqueViolation is the postgres error code raised when a row conflicts with
+// a unique index, e.g. users_email_idx.
+const uniqueViolation = "23505"
+
 
 type postgresDbRepo struct {
     App *config.AppConfig
@@ -32,3 +43,17 @@ func NewTestingRepo(a *config.AppConfig) repository.DatabaseRepo {
         App: a,
     }
 }
+
+// translateError maps postgres errors that callers need to tell apart onto
+// repository errors. Other errors are returned unchanged.
+func translateError(err error) error {
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == exclusionViolation {
+        return repository.ErrNotAvailable
+    }
+    if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+        return repository.ErrAlreadyExists
+    }
+
+    return err
+}
@@ -2,9 +2,15 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/sanijo/rent-app/internal/metrics"
 	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+	"github.com/sanijo/rent-app/internal/repository"
+	"golang.org/x/crypto/bcrypt"
 )
 
 
@@ -15,6 +21,8 @@ func (m *postgresDbRepo) AllUsers() bool {
 // InsertRent inserts a rent into the database after data is obtained from the
 // form.
 func (m *postgresDbRepo) InsertRent(rent models.Rent) (int, error) {
+    defer metrics.ObserveQuery("InsertRent", time.Now())
+
     // Create a context with a timeout of 3 seconds which will be used to
     // kill the query if it takes too long.
     ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -23,8 +31,8 @@ func (m *postgresDbRepo) InsertRent(rent models.Rent) (int, error) {
     var newID int
 
     query := `insert into rent (first_name, last_name, email, phone, start_date,
-            end_date, model_id, created_at, updated_at)
-            values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+            end_date, model_id, total_price, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
 
     err := m.DB.QueryRowContext(
         ctx,
@@ -36,6 +44,7 @@ func (m *postgresDbRepo) InsertRent(rent models.Rent) (int, error) {
         rent.StartDate,
         rent.EndDate,
         rent.ModelID,
+        rent.TotalPrice,
         time.Now(),
         time.Now(),
     ).Scan(&newID)
@@ -50,12 +59,14 @@ func (m *postgresDbRepo) InsertRent(rent models.Rent) (int, error) {
 // InsertRentRestriction inserts a rent restriction into the database after data 
 // is obtained from the form.
 func (m *postgresDbRepo) InsertRentRestriction(rentRestriction models.RentRestriction) error {
+    defer metrics.ObserveQuery("InsertRentRestriction", time.Now())
+
     ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
     defer cancel()
 
     query := `insert into rent_restrictions (start_date, end_date, model_id, 
-            rent_id, restriction_id, created_at, updated_at)
-            values ($1, $2, $3, $4, $5, $6, $7)`
+            rent_id, restriction_id, vehicle_id, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7, $8)`
 
     _, err := m.DB.ExecContext(
         ctx,
@@ -65,51 +76,317 @@ func (m *postgresDbRepo) InsertRentRestriction(rentRestriction models.RentRestri
         rentRestriction.ModelID,
         rentRestriction.RentID,
         rentRestriction.RestrictionID,
+        rentRestriction.VehicleID,
         time.Now(),
         time.Now(),
     )
     
     if err != nil {
-        return err
+        return translateError(err)
     }
 
     return nil
 }
 
-// SearchAvailabilityByDatesByModelID returns true if availability exists for
-// modelID, and false if no availability exists.
-func (m *postgresDbRepo) SearchAvailabilityByDatesAndModelID(start, end time.Time, modelID int) (bool, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// CreateBooking inserts a rent and its reservation restriction in a single
+// transaction, so that a rent is never stored without blocking the calendar.
+// The reservation is assigned to the first free active vehicle of the model.
+// Returns the id of the new rent, or repository.ErrNotAvailable if no vehicle
+// of the model is free for the dates. The transaction is rolled back if ctx is
+// cancelled, e.g. because the client went away.
+func (m *postgresDbRepo) CreateBooking(ctx context.Context, rent models.Rent) (int, error) {
+    defer metrics.ObserveQuery("CreateBooking", time.Now())
+
+    return m.createBooking(ctx, rent, 0)
+}
+
+// CreateBookingFromHold is CreateBooking for a rent whose dates are held by
+// the hold with holdID. The hold is converted into the reservation of the
+// rent, so the rent gets the held vehicle. If the hold has expired or doesn't
+// match the rent, it is dropped and the rent gets any free vehicle.
+func (m *postgresDbRepo) CreateBookingFromHold(ctx context.Context, rent models.Rent, holdID int) (int, error) {
+    defer metrics.ObserveQuery("CreateBookingFromHold", time.Now())
+
+    return m.createBooking(ctx, rent, holdID)
+}
+
+// createBooking stores rent and its reservation, converting the hold with
+// holdID if it is not zero
+func (m *postgresDbRepo) createBooking(ctx context.Context, rent models.Rent, holdID int) (int, error) {
+    ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
     defer cancel()
 
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, err
+    }
+    // Rollback is a no-op once the transaction has been committed
+    defer tx.Rollback()
+
+    vehicleID, err := takeHold(ctx, tx, holdID, rent)
+    if err != nil {
+        return 0, err
+    }
+    if vehicleID == 0 {
+        vehicleID, err = freeVehicleID(ctx, tx, rent.ModelID, rent.StartDate, rent.EndDate)
+        if err != nil {
+            return 0, err
+        }
+    }
+
+    var newID int
+
+    // rents without a status don't wait for a payment
+    status := rent.Status
+    if status == "" {
+        status = models.RentConfirmed
+    }
+
+    // rents created without a reference get none, NULLs don't violate the
+    // unique index
+    var reference interface{}
+    if rent.Reference != "" {
+        reference = rent.Reference
+    }
+
+    query := `insert into rent (first_name, last_name, email, phone, start_date,
+            end_date, model_id, total_price, status, reference, created_at,
+            updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+            returning id`
+
+    err = tx.QueryRowContext(
+        ctx,
+        query,
+        rent.FirstName,
+        rent.LastName,
+        rent.Email,
+        rent.Phone,
+        rent.StartDate,
+        rent.EndDate,
+        rent.ModelID,
+        rent.TotalPrice,
+        status,
+        reference,
+        time.Now(),
+        time.Now(),
+    ).Scan(&newID)
+
+    if err != nil {
+        return 0, translateError(err)
+    }
+
+    query = `insert into rent_restrictions (start_date, end_date, model_id,
+            rent_id, restriction_id, vehicle_id, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+    _, err = tx.ExecContext(
+        ctx,
+        query,
+        rent.StartDate,
+        rent.EndDate,
+        rent.ModelID,
+        newID,
+        models.RestrictionReservation,
+        vehicleID,
+        time.Now(),
+        time.Now(),
+    )
+
+    if err != nil {
+        // overlapping restriction means someone else booked the vehicle first
+        return 0, translateError(err)
+    }
+
+    if err = tx.Commit(); err != nil {
+        return 0, err
+    }
+
+    return newID, nil
+}
+
+// takeHold deletes the hold with holdID and returns its vehicle if the hold
+// is still valid for rent. It returns zero if there is no such hold, or it
+// expired or is for other dates.
+func takeHold(ctx context.Context, tx *sql.Tx, holdID int, rent models.Rent) (int, error) {
+    if holdID == 0 {
+        return 0, nil
+    }
+
+    query := `
+        delete from 
+            rent_restrictions 
+        where 
+            id = $1 and restriction_id = $2
+        returning 
+            vehicle_id, model_id = $3 and start_date = $4 and end_date = $5 
+                and expires_at > $6`
+
+    var vehicleID int
+    var valid bool
+
+    err := tx.QueryRowContext(
+        ctx,
+        query,
+        holdID,
+        models.RestrictionHold,
+        rent.ModelID,
+        rent.StartDate,
+        rent.EndDate,
+        time.Now(),
+    ).Scan(&vehicleID, &valid)
+    if errors.Is(err, sql.ErrNoRows) {
+        return 0, nil
+    }
+    if err != nil {
+        return 0, err
+    }
+    if !valid {
+        return 0, nil
+    }
+
+    return vehicleID, nil
+}
+
+// freeVehicleID returns the id of the first active vehicle of modelID that is
+// free between start and end, or repository.ErrNotAvailable if there is none.
+// Like the availability searches it keeps the turnaround of the model free
+// around every restriction. The vehicle is locked, concurrent transactions
+// skip it and take the next free one. If every free vehicle is locked, the
+// first one is waited for, since its transaction may roll back. Expired holds
+// the sweeper hasn't removed yet are deleted first, so that they don't block
+// the vehicle.
+func freeVehicleID(ctx context.Context, tx *sql.Tx, modelID int, start, end time.Time) (int, error) {
     query := `
+        delete from 
+            rent_restrictions 
+        where 
+            model_id = $1 and restriction_id = $2 and expires_at <= $3`
+
+    _, err := tx.ExecContext(ctx, query, modelID, models.RestrictionHold, time.Now())
+    if err != nil {
+        return 0, err
+    }
+
+    query = `
         select 
-            count(id) 
+            v.id 
         from 
-            rent_restrictions 
+            vehicles v
+            join models m on (m.id = v.model_id)
+        where 
+            v.model_id = $1 and v.active = true and not exists 
+            (select 
+                1 
+            from 
+                rent_restrictions rr 
+            where 
+                rr.vehicle_id = v.id 
+                and $2 < rr.end_date + make_interval(hours => m.turnaround_hours)
+                and $3 > rr.start_date - make_interval(hours => m.turnaround_hours))
+        order by 
+            v.id
+        limit 1`
+
+    var vehicleID int
+
+    err = tx.QueryRowContext(ctx, query+" for update of v skip locked", modelID, start, end).Scan(&vehicleID)
+    if err == nil {
+        return vehicleID, nil
+    }
+    if !errors.Is(err, sql.ErrNoRows) {
+        return 0, err
+    }
+
+    // wait for the transaction holding the vehicle to finish
+    err = tx.QueryRowContext(ctx, query+" for update of v", modelID, start, end).Scan(&vehicleID)
+    if errors.Is(err, sql.ErrNoRows) {
+        return 0, repository.ErrNotAvailable
+    }
+    if err != nil {
+        return 0, err
+    }
+
+    // The query above saw the restrictions from before the wait, a new one
+    // sees those the other transaction committed
+    query = `
+        select 
+            count(rr.id) 
+        from 
+            rent_restrictions rr 
+            join vehicles v on (v.id = rr.vehicle_id)
+            join models m on (m.id = v.model_id)
         where 
-            model_id = $1 and $2 < end_date and $3 > start_date;`
+            rr.vehicle_id = $1 
+            and $2 < rr.end_date + make_interval(hours => m.turnaround_hours)
+            and $3 > rr.start_date - make_interval(hours => m.turnaround_hours)`
 
-    var numRows int
+    var overlapping int
 
-    // do query
-    queryResult := m.DB.QueryRowContext(ctx, query, modelID, start, end)
-    // scan the result into the address of numRows variable
-    err := queryResult.Scan(&numRows)
+    err = tx.QueryRowContext(ctx, query, vehicleID, start, end).Scan(&overlapping)
     if err != nil {
-        return false, err
+        return 0, err
     }
+    if overlapping > 0 {
+        return 0, repository.ErrNotAvailable
+    }
+
+    return vehicleID, nil
+}
+
+// SearchAvailabilityByDatesAndModelID returns the number of active vehicles
+// of modelID that are free between start and end. The model is available if
+// the number is greater than zero. Unexpired holds block a vehicle, the
+// restrictions of cancelled rents don't. The turnaround of the model is kept
+// free before and after every restriction, so that a vehicle can't be picked
+// up before it is cleaned and charged.
+func (m *postgresDbRepo) SearchAvailabilityByDatesAndModelID(start, end time.Time, modelID int) (int, error) {
+    defer metrics.ObserveQuery("SearchAvailabilityByDatesAndModelID", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `
+        select 
+            count(v.id) 
+        from 
+            vehicles v
+            join models m on (m.id = v.model_id)
+        where 
+            v.model_id = $1 and v.active = true and not exists 
+            (select 
+                1 
+            from 
+                rent_restrictions rr 
+                left join rent r on (r.id = rr.rent_id)
+            where 
+                rr.vehicle_id = v.id 
+                and $2 < rr.end_date + make_interval(hours => m.turnaround_hours)
+                and $3 > rr.start_date - make_interval(hours => m.turnaround_hours)
+                and (rr.expires_at is null or rr.expires_at > $4)
+                and (r.id is null or r.status <> $5));`
+
+    var freeUnits int
 
-    if numRows == 0 {
-        return true, nil
+    // do query
+    queryResult := m.DB.QueryRowContext(ctx, query, modelID, start, end, time.Now(), models.RentCancelled)
+    // scan the result into the address of freeUnits variable
+    err := queryResult.Scan(&freeUnits)
+    if err != nil {
+        return 0, err
     }
 
-    return false, nil
+    return freeUnits, nil
 }
     
-// SearchAvailabilityForAllModels returns a slice of available models if any,
-// for given start and end dates.
+// SearchAvailabilityForAllModels returns a slice of models with at least one
+// free vehicle for given start and end dates. FreeUnits of every model is set
+// to the number of its free vehicles. Like SearchAvailabilityByDatesAndModelID
+// it counts unexpired holds, ignores cancelled rents and keeps the turnaround
+// of each model free around restrictions.
 func (m *postgresDbRepo) SearchAvailabilityForAllModels(start, end time.Time) ([]models.Model, error) {
+    defer metrics.ObserveQuery("SearchAvailabilityForAllModels", time.Now())
+
     ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
     defer cancel()
 
@@ -117,19 +394,30 @@ func (m *postgresDbRepo) SearchAvailabilityForAllModels(start, end time.Time) ([
 
     query := `
         select 
-            m.id, m.model_name
+            m.id, m.model_name, m.min_days, m.max_days, m.turnaround_hours,
+            count(v.id)
         from 
             models m
+            join vehicles v on (v.model_id = m.id)
         where 
-            m.id not in 
+            v.active = true and not exists 
             (select 
-                rr.model_id 
+                1 
             from 
                 rent_restrictions rr
+                left join rent r on (r.id = rr.rent_id)
             where 
-                $1 < rr.end_date and $2 > rr.start_date);`
+                rr.vehicle_id = v.id 
+                and $1 < rr.end_date + make_interval(hours => m.turnaround_hours)
+                and $2 > rr.start_date - make_interval(hours => m.turnaround_hours)
+                and (rr.expires_at is null or rr.expires_at > $3)
+                and (r.id is null or r.status <> $4))
+        group by 
+            m.id, m.model_name, m.min_days, m.max_days, m.turnaround_hours
+        order by 
+            m.id;`
 
-    rows, err := m.DB.QueryContext(ctx, query, start, end)
+    rows, err := m.DB.QueryContext(ctx, query, start, end, time.Now(), models.RentCancelled)
     if err != nil {
         return availableCarModels, err
     }
@@ -140,6 +428,10 @@ func (m *postgresDbRepo) SearchAvailabilityForAllModels(start, end time.Time) ([
         err = rows.Scan(
             &model.ID,
             &model.ModelName,
+            &model.MinDays,
+            &model.MaxDays,
+            &model.TurnaroundHours,
+            &model.FreeUnits,
         )
         if err != nil {
             return availableCarModels, err
@@ -157,6 +449,8 @@ func (m *postgresDbRepo) SearchAvailabilityForAllModels(start, end time.Time) ([
 
 // GetModelByID returns a model by id.
 func (m *postgresDbRepo) GetModelByID(id int) (models.Model, error) {
+    defer metrics.ObserveQuery("GetModelByID", time.Now())
+
     ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
     defer cancel()
 
@@ -164,7 +458,8 @@ func (m *postgresDbRepo) GetModelByID(id int) (models.Model, error) {
 
     query := `
         select 
-            id, model_name, created_at, updated_at 
+            id, model_name, daily_rate, weekend_rate, min_days, max_days,
+            turnaround_hours, created_at, updated_at 
         from 
             models 
         where 
@@ -175,6 +470,11 @@ func (m *postgresDbRepo) GetModelByID(id int) (models.Model, error) {
     err := row.Scan(
         &model.ID,
         &model.ModelName,
+        &model.DailyRate,
+        &model.WeekendRate,
+        &model.MinDays,
+        &model.MaxDays,
+        &model.TurnaroundHours,
         &model.CreatedAt,
         &model.UpdatedAt,
     )
@@ -184,3 +484,1353 @@ func (m *postgresDbRepo) GetModelByID(id int) (models.Model, error) {
 
     return model, nil
 }
+
+// GetUserByID returns a user by id.
+func (m *postgresDbRepo) GetUserByID(id int) (models.User, error) {
+    defer metrics.ObserveQuery("GetUserByID", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var user models.User
+
+    query := `
+        select 
+            id, first_name, last_name, email, password, access_level,
+            created_at, updated_at
+        from 
+            users 
+        where 
+            id = $1`
+
+    row := m.DB.QueryRowContext(ctx, query, id)
+
+    err := row.Scan(
+        &user.ID,
+        &user.FirstName,
+        &user.LastName,
+        &user.Email,
+        &user.Password,
+        &user.AccessLevel,
+        &user.CreatedAt,
+        &user.UpdatedAt,
+    )
+    if err != nil {
+        return user, err
+    }
+
+    return user, nil
+}
+
+// InsertUser stores a user with the bcrypt hash of password and returns its
+// id.
+func (m *postgresDbRepo) InsertUser(user models.User, password string) (int, error) {
+    defer metrics.ObserveQuery("InsertUser", time.Now())
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return 0, err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `insert into users (first_name, last_name, email, password,
+            access_level, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+    var newID int
+    err = m.DB.QueryRowContext(
+        ctx,
+        query,
+        user.FirstName,
+        user.LastName,
+        user.Email,
+        string(hashedPassword),
+        user.AccessLevel,
+        time.Now(),
+        time.Now(),
+    ).Scan(&newID)
+    if err != nil {
+        return 0, translateError(err)
+    }
+
+    return newID, nil
+}
+
+// Authenticate checks email and password against the users table. Returns
+// the user id and access level, or repository.ErrInvalidCredentials if there
+// is no such user or the password doesn't match.
+func (m *postgresDbRepo) Authenticate(email, testPassword string) (int, int, error) {
+    defer metrics.ObserveQuery("Authenticate", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var id, accessLevel int
+    var hashedPassword string
+
+    query := `
+        select 
+            id, password, access_level 
+        from 
+            users 
+        where 
+            email = $1`
+
+    row := m.DB.QueryRowContext(ctx, query, email)
+
+    err := row.Scan(&id, &hashedPassword, &accessLevel)
+    if errors.Is(err, sql.ErrNoRows) {
+        return 0, 0, repository.ErrInvalidCredentials
+    } else if err != nil {
+        return 0, 0, err
+    }
+
+    // compare stored bcrypt hash with the password provided by the user
+    err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+    if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+        return 0, 0, repository.ErrInvalidCredentials
+    } else if err != nil {
+        return 0, 0, err
+    }
+
+    return id, accessLevel, nil
+}
+
+// AllRents returns a slice of all rents.
+func (m *postgresDbRepo) AllRents() ([]models.Rent, error) {
+    defer metrics.ObserveQuery("AllRents", time.Now())
+
+    return m.listRents("true")
+}
+
+// AllNewRents returns a slice of rents that are not yet processed.
+func (m *postgresDbRepo) AllNewRents() ([]models.Rent, error) {
+    defer metrics.ObserveQuery("AllNewRents", time.Now())
+
+    return m.listRents("r.processed = 0")
+}
+
+// RentsBetween returns the rents overlapping the dates from start up to end,
+// leaving out cancelled rents.
+func (m *postgresDbRepo) RentsBetween(start, end time.Time) ([]models.Rent, error) {
+    defer metrics.ObserveQuery("RentsBetween", time.Now())
+
+    return m.listRents("r.start_date < $2 and r.end_date > $1 and r.status <> $3", start, end, models.RentCancelled)
+}
+
+// listRents returns the rents matching the where condition ordered by start
+// date.
+func (m *postgresDbRepo) listRents(where string, args ...interface{}) ([]models.Rent, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var rents []models.Rent
+
+    query := `
+        select 
+            r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+            r.end_date, r.model_id, r.created_at, r.updated_at, r.processed,
+            r.total_price, r.status, coalesce(r.reference, ''), m.id,
+            m.model_name
+        from 
+            rent r
+            left join models m on (r.model_id = m.id)
+        where 
+            ` + where + `
+        order by 
+            r.start_date asc`
+
+    rows, err := m.DB.QueryContext(ctx, query, args...)
+    if err != nil {
+        return rents, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var rent models.Rent
+        err = rows.Scan(
+            &rent.ID,
+            &rent.FirstName,
+            &rent.LastName,
+            &rent.Email,
+            &rent.Phone,
+            &rent.StartDate,
+            &rent.EndDate,
+            &rent.ModelID,
+            &rent.CreatedAt,
+            &rent.UpdatedAt,
+            &rent.Processed,
+            &rent.TotalPrice,
+            &rent.Status,
+            &rent.Reference,
+            &rent.Model.ID,
+            &rent.Model.ModelName,
+        )
+        if err != nil {
+            return rents, err
+        }
+
+        rents = append(rents, rent)
+    }
+
+    if err = rows.Err(); err != nil {
+        return rents, err
+    }
+
+    return rents, nil
+}
+
+// GetRentByID returns a rent by id.
+func (m *postgresDbRepo) GetRentByID(id int) (models.Rent, error) {
+    defer metrics.ObserveQuery("GetRentByID", time.Now())
+
+    return m.getRent("r.id = $1", id)
+}
+
+// GetRentByReference returns a rent by its reference code.
+func (m *postgresDbRepo) GetRentByReference(reference string) (models.Rent, error) {
+    defer metrics.ObserveQuery("GetRentByReference", time.Now())
+
+    return m.getRent("r.reference = $1", reference)
+}
+
+// getRent returns the rent matching the where condition, together with its
+// model and the vehicle of its reservation.
+func (m *postgresDbRepo) getRent(where string, arg interface{}) (models.Rent, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var rent models.Rent
+
+    query := `
+        select 
+            r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+            r.end_date, r.model_id, r.created_at, r.updated_at, r.processed,
+            r.total_price, r.status, coalesce(r.reference, ''), m.id,
+            m.model_name, coalesce(v.id, 0), coalesce(v.vin, ''),
+            coalesce(v.plate, ''), coalesce(v.color, '')
+        from 
+            rent r
+            left join models m on (r.model_id = m.id)
+            left join rent_restrictions rr on (rr.rent_id = r.id and rr.restriction_id = $2)
+            left join vehicles v on (rr.vehicle_id = v.id)
+        where 
+            ` + where
+
+    row := m.DB.QueryRowContext(ctx, query, arg, models.RestrictionReservation)
+
+    err := row.Scan(
+        &rent.ID,
+        &rent.FirstName,
+        &rent.LastName,
+        &rent.Email,
+        &rent.Phone,
+        &rent.StartDate,
+        &rent.EndDate,
+        &rent.ModelID,
+        &rent.CreatedAt,
+        &rent.UpdatedAt,
+        &rent.Processed,
+        &rent.TotalPrice,
+        &rent.Status,
+        &rent.Reference,
+        &rent.Model.ID,
+        &rent.Model.ModelName,
+        &rent.Vehicle.ID,
+        &rent.Vehicle.VIN,
+        &rent.Vehicle.Plate,
+        &rent.Vehicle.Color,
+    )
+    if err != nil {
+        return rent, err
+    }
+    rent.VehicleID = rent.Vehicle.ID
+    rent.Vehicle.ModelID = rent.ModelID
+
+    return rent, nil
+}
+
+// UpdateRent updates the customer details of a rent.
+func (m *postgresDbRepo) UpdateRent(rent models.Rent) error {
+    defer metrics.ObserveQuery("UpdateRent", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `
+        update 
+            rent 
+        set 
+            first_name = $1, last_name = $2, email = $3, phone = $4,
+            updated_at = $5
+        where 
+            id = $6`
+
+    _, err := m.DB.ExecContext(
+        ctx,
+        query,
+        rent.FirstName,
+        rent.LastName,
+        rent.Email,
+        rent.Phone,
+        time.Now(),
+        rent.ID,
+    )
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+// DeleteRent deletes a rent by id. Its restrictions are removed by the
+// rent_restrictions_rent_id_fk cascade.
+func (m *postgresDbRepo) DeleteRent(id int) error {
+    defer metrics.ObserveQuery("DeleteRent", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `delete from rent where id = $1`
+
+    _, err := m.DB.ExecContext(ctx, query, id)
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+// ChangeRentDates moves a rent to its new start and end date and total
+// price. Its reservation is replaced in the same transaction, by the first
+// free active vehicle of the model for the new dates, and its open payments
+// for the old price are cancelled. Returns repository.ErrNotAvailable if no
+// vehicle is free.
+func (m *postgresDbRepo) ChangeRentDates(rent models.Rent) error {
+    defer metrics.ObserveQuery("ChangeRentDates", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    // Rollback is a no-op once the transaction has been committed
+    defer tx.Rollback()
+
+    // the old reservation must not keep its vehicle busy for the new dates
+    query := `delete from rent_restrictions where rent_id = $1 and restriction_id = $2`
+
+    _, err = tx.ExecContext(ctx, query, rent.ID, models.RestrictionReservation)
+    if err != nil {
+        return err
+    }
+
+    vehicleID, err := freeVehicleID(ctx, tx, rent.ModelID, rent.StartDate, rent.EndDate)
+    if err != nil {
+        return err
+    }
+
+    query = `insert into rent_restrictions (start_date, end_date, model_id,
+            rent_id, restriction_id, vehicle_id, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+    _, err = tx.ExecContext(
+        ctx,
+        query,
+        rent.StartDate,
+        rent.EndDate,
+        rent.ModelID,
+        rent.ID,
+        models.RestrictionReservation,
+        vehicleID,
+        time.Now(),
+        time.Now(),
+    )
+    if err != nil {
+        return translateError(err)
+    }
+
+    query = `
+        update 
+            rent 
+        set 
+            start_date = $1, end_date = $2, total_price = $3, updated_at = $4
+        where 
+            id = $5`
+
+    _, err = tx.ExecContext(ctx, query, rent.StartDate, rent.EndDate, rent.TotalPrice, time.Now(), rent.ID)
+    if err != nil {
+        return err
+    }
+
+    query = `update payments set status = $1, updated_at = $2 where rent_id = $3 and status in ($4, $5)`
+
+    _, err = tx.ExecContext(ctx, query, payments.StatusCancelled, time.Now(), rent.ID,
+        payments.StatusPending, payments.StatusFailed)
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// UpdateRentStatus changes the status of a rent from from to to, and records
+// who changed it in the status history, in one transaction. Cancelled rents
+// release their restrictions, so that the vehicle can be booked again. It
+// returns repository.ErrStatusChanged if the rent isn't in status from any
+// more.
+func (m *postgresDbRepo) UpdateRentStatus(id int, from, to, changedBy string) error {
+    defer metrics.ObserveQuery("UpdateRentStatus", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    // Rollback is a no-op once the transaction has been committed
+    defer tx.Rollback()
+
+    query := `update rent set status = $1, updated_at = $2 where id = $3 and status = $4`
+
+    result, err := tx.ExecContext(ctx, query, to, time.Now(), id, from)
+    if err != nil {
+        return err
+    }
+    n, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if n == 0 {
+        return repository.ErrStatusChanged
+    }
+
+    err = insertStatusChange(ctx, tx, id, from, to, changedBy)
+    if err != nil {
+        return err
+    }
+
+    if to == models.RentCancelled {
+        query = `delete from rent_restrictions where rent_id = $1`
+
+        _, err = tx.ExecContext(ctx, query, id)
+        if err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit()
+}
+
+// insertStatusChange records a status change of a rent in the status history
+func insertStatusChange(ctx context.Context, tx *sql.Tx, rentID int, from, to, changedBy string) error {
+    query := `insert into rent_status_history (rent_id, from_status, to_status,
+            changed_by, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6)`
+
+    _, err := tx.ExecContext(ctx, query, rentID, from, to, changedBy, time.Now(), time.Now())
+
+    return err
+}
+
+// GetRentStatusHistory returns the status changes of a rent, oldest first.
+func (m *postgresDbRepo) GetRentStatusHistory(rentID int) ([]models.RentStatusChange, error) {
+    defer metrics.ObserveQuery("GetRentStatusHistory", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var history []models.RentStatusChange
+
+    query := `
+        select 
+            id, rent_id, from_status, to_status, changed_by, created_at
+        from 
+            rent_status_history 
+        where 
+            rent_id = $1
+        order by 
+            created_at, id`
+
+    rows, err := m.DB.QueryContext(ctx, query, rentID)
+    if err != nil {
+        return history, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var change models.RentStatusChange
+        err = rows.Scan(
+            &change.ID,
+            &change.RentID,
+            &change.FromStatus,
+            &change.ToStatus,
+            &change.ChangedBy,
+            &change.CreatedAt,
+        )
+        if err != nil {
+            return history, err
+        }
+
+        history = append(history, change)
+    }
+
+    if err = rows.Err(); err != nil {
+        return history, err
+    }
+
+    return history, nil
+}
+
+// UpdateProcessedForRent sets the processed flag of a rent.
+func (m *postgresDbRepo) UpdateProcessedForRent(id, processed int) error {
+    defer metrics.ObserveQuery("UpdateProcessedForRent", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `update rent set processed = $1, updated_at = $2 where id = $3`
+
+    _, err := m.DB.ExecContext(ctx, query, processed, time.Now(), id)
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+// AllModels returns a slice of all models.
+func (m *postgresDbRepo) AllModels() ([]models.Model, error) {
+    defer metrics.ObserveQuery("AllModels", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var carModels []models.Model
+
+    query := `
+        select 
+            id, model_name, daily_rate, weekend_rate, min_days, max_days,
+            turnaround_hours, created_at, updated_at 
+        from 
+            models 
+        order by 
+            model_name`
+
+    rows, err := m.DB.QueryContext(ctx, query)
+    if err != nil {
+        return carModels, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var model models.Model
+        err = rows.Scan(
+            &model.ID,
+            &model.ModelName,
+            &model.DailyRate,
+            &model.WeekendRate,
+            &model.MinDays,
+            &model.MaxDays,
+            &model.TurnaroundHours,
+            &model.CreatedAt,
+            &model.UpdatedAt,
+        )
+        if err != nil {
+            return carModels, err
+        }
+
+        carModels = append(carModels, model)
+    }
+
+    if err = rows.Err(); err != nil {
+        return carModels, err
+    }
+
+    return carModels, nil
+}
+
+// GetVehiclesByModelID returns all vehicles of a model, active or not.
+func (m *postgresDbRepo) GetVehiclesByModelID(modelID int) ([]models.Vehicle, error) {
+    defer metrics.ObserveQuery("GetVehiclesByModelID", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var vehicles []models.Vehicle
+
+    query := `
+        select 
+            id, model_id, vin, plate, color, active, created_at, updated_at
+        from 
+            vehicles 
+        where 
+            model_id = $1
+        order by 
+            id`
+
+    rows, err := m.DB.QueryContext(ctx, query, modelID)
+    if err != nil {
+        return vehicles, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var vehicle models.Vehicle
+        err = rows.Scan(
+            &vehicle.ID,
+            &vehicle.ModelID,
+            &vehicle.VIN,
+            &vehicle.Plate,
+            &vehicle.Color,
+            &vehicle.Active,
+            &vehicle.CreatedAt,
+            &vehicle.UpdatedAt,
+        )
+        if err != nil {
+            return vehicles, err
+        }
+
+        vehicles = append(vehicles, vehicle)
+    }
+
+    if err = rows.Err(); err != nil {
+        return vehicles, err
+    }
+
+    return vehicles, nil
+}
+
+// GetRestrictionsForModelByDate returns restrictions of a model that overlap
+// the given start and end dates. Expired holds are left out.
+func (m *postgresDbRepo) GetRestrictionsForModelByDate(modelID int, start, end time.Time) ([]models.RentRestriction, error) {
+    defer metrics.ObserveQuery("GetRestrictionsForModelByDate", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var restrictions []models.RentRestriction
+
+    query := `
+        select 
+            id, start_date, end_date, model_id, coalesce(rent_id, 0),
+            restriction_id, vehicle_id, coalesce(external_uid, ''), expires_at
+        from 
+            rent_restrictions 
+        where 
+            model_id = $1 and $2 < end_date and $3 > start_date
+            and (expires_at is null or expires_at > $4)`
+
+    rows, err := m.DB.QueryContext(ctx, query, modelID, start, end, time.Now())
+    if err != nil {
+        return restrictions, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var restriction models.RentRestriction
+        var expiresAt sql.NullTime
+        err = rows.Scan(
+            &restriction.ID,
+            &restriction.StartDate,
+            &restriction.EndDate,
+            &restriction.ModelID,
+            &restriction.RentID,
+            &restriction.RestrictionID,
+            &restriction.VehicleID,
+            &restriction.ExternalUID,
+            &expiresAt,
+        )
+        if err != nil {
+            return restrictions, err
+        }
+        restriction.ExpiresAt = expiresAt.Time
+
+        restrictions = append(restrictions, restriction)
+    }
+
+    if err = rows.Err(); err != nil {
+        return restrictions, err
+    }
+
+    return restrictions, nil
+}
+
+// UpdateOwnerBlocks applies the owner block changes of all vehicles in one
+// transaction. For every vehicle the owner blocks with ids in RemoveIDs are
+// deleted and a one day owner block is inserted for every day in AddDays.
+// Nothing is saved if a day can't be blocked, e.g. because it is booked.
+func (m *postgresDbRepo) UpdateOwnerBlocks(changes []models.OwnerBlockChange) error {
+    defer metrics.ObserveQuery("UpdateOwnerBlocks", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    // Rollback is a no-op once the transaction has been committed
+    defer tx.Rollback()
+
+    // restriction_id check makes sure a reservation is never removed here
+    deleteQuery := `delete from rent_restrictions 
+            where id = $1 and vehicle_id = $2 and restriction_id = $3`
+
+    // model_id is copied from the vehicle
+    insertQuery := `insert into rent_restrictions (start_date, end_date, model_id,
+            restriction_id, vehicle_id, created_at, updated_at)
+            select $1, $2, model_id, $3, id, $4, $5 from vehicles where id = $6`
+
+    for _, change := range changes {
+        for _, id := range change.RemoveIDs {
+            _, err = tx.ExecContext(ctx, deleteQuery, id, change.VehicleID, models.RestrictionOwnerBlock)
+            if err != nil {
+                return err
+            }
+        }
+
+        for _, day := range change.AddDays {
+            _, err = tx.ExecContext(
+                ctx,
+                insertQuery,
+                day,
+                day.AddDate(0, 0, 1),
+                models.RestrictionOwnerBlock,
+                time.Now(),
+                time.Now(),
+                change.VehicleID,
+            )
+            if err != nil {
+                return translateError(err)
+            }
+        }
+    }
+
+    return tx.Commit()
+}
+
+// UpsertExternalBlock stores an event imported from another platform as an
+// owner block of the first free vehicle of modelID. Events are identified by
+// uid, importing the same event again only moves it if its dates changed.
+// Returns repository.ErrNotAvailable if no vehicle is free for the dates.
+func (m *postgresDbRepo) UpsertExternalBlock(modelID int, uid string, start, end time.Time) error {
+    defer metrics.ObserveQuery("UpsertExternalBlock", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    // Rollback is a no-op once the transaction has been committed
+    defer tx.Rollback()
+
+    query := `
+        select 
+            id, start_date, end_date 
+        from 
+            rent_restrictions 
+        where 
+            model_id = $1 and external_uid = $2
+        for update`
+
+    var id int
+    var oldStart, oldEnd time.Time
+
+    err = tx.QueryRowContext(ctx, query, modelID, uid).Scan(&id, &oldStart, &oldEnd)
+    switch {
+    case errors.Is(err, sql.ErrNoRows):
+    case err != nil:
+        return err
+    case oldStart.Equal(start) && oldEnd.Equal(end):
+        // already imported
+        return nil
+    default:
+        // dates changed, the block may have to move to another vehicle
+        _, err = tx.ExecContext(ctx, `delete from rent_restrictions where id = $1`, id)
+        if err != nil {
+            return err
+        }
+    }
+
+    vehicleID, err := freeVehicleID(ctx, tx, modelID, start, end)
+    if err != nil {
+        return err
+    }
+
+    query = `insert into rent_restrictions (start_date, end_date, model_id,
+            restriction_id, vehicle_id, external_uid, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+    _, err = tx.ExecContext(
+        ctx,
+        query,
+        start,
+        end,
+        modelID,
+        models.RestrictionOwnerBlock,
+        vehicleID,
+        uid,
+        time.Now(),
+        time.Now(),
+    )
+    if err != nil {
+        return translateError(err)
+    }
+
+    return tx.Commit()
+}
+
+// InsertOwnerBlock blocks a free vehicle of a model from start up to end and
+// returns the owner block with the vehicle it was put on.
+func (m *postgresDbRepo) InsertOwnerBlock(modelID int, start, end time.Time) (models.RentRestriction, error) {
+    defer metrics.ObserveQuery("InsertOwnerBlock", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    rr := models.RentRestriction{
+        StartDate: start,
+        EndDate: end,
+        ModelID: modelID,
+        RestrictionID: models.RestrictionOwnerBlock,
+        CreatedAt: time.Now(),
+        UpdatedAt: time.Now(),
+    }
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return rr, err
+    }
+    // Rollback is a no-op once the transaction has been committed
+    defer tx.Rollback()
+
+    rr.VehicleID, err = freeVehicleID(ctx, tx, modelID, start, end)
+    if err != nil {
+        return rr, err
+    }
+
+    query := `insert into rent_restrictions (start_date, end_date, model_id,
+            restriction_id, vehicle_id, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+    err = tx.QueryRowContext(
+        ctx,
+        query,
+        rr.StartDate,
+        rr.EndDate,
+        rr.ModelID,
+        rr.RestrictionID,
+        rr.VehicleID,
+        rr.CreatedAt,
+        rr.UpdatedAt,
+    ).Scan(&rr.ID)
+    if err != nil {
+        return rr, translateError(err)
+    }
+
+    return rr, tx.Commit()
+}
+
+// DeleteOwnerBlock deletes an owner block, reservations are never deleted. It
+// returns sql.ErrNoRows if there is no owner block with the id.
+func (m *postgresDbRepo) DeleteOwnerBlock(id int) error {
+    defer metrics.ObserveQuery("DeleteOwnerBlock", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `delete from rent_restrictions where id = $1 and restriction_id = $2`
+
+    result, err := m.DB.ExecContext(ctx, query, id, models.RestrictionOwnerBlock)
+    if err != nil {
+        return err
+    }
+
+    n, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if n == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// InsertHold holds a free vehicle of a model from start up to end until
+// expires, while the customer fills in the rent form. It returns
+// repository.ErrNotAvailable if no vehicle is free.
+func (m *postgresDbRepo) InsertHold(modelID int, start, end, expires time.Time) (models.RentRestriction, error) {
+    defer metrics.ObserveQuery("InsertHold", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    rr := models.RentRestriction{
+        StartDate: start,
+        EndDate: end,
+        ModelID: modelID,
+        RestrictionID: models.RestrictionHold,
+        ExpiresAt: expires,
+        CreatedAt: time.Now(),
+        UpdatedAt: time.Now(),
+    }
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return rr, err
+    }
+    // Rollback is a no-op once the transaction has been committed
+    defer tx.Rollback()
+
+    rr.VehicleID, err = freeVehicleID(ctx, tx, modelID, start, end)
+    if err != nil {
+        return rr, err
+    }
+
+    query := `insert into rent_restrictions (start_date, end_date, model_id,
+            restriction_id, vehicle_id, expires_at, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+    err = tx.QueryRowContext(
+        ctx,
+        query,
+        rr.StartDate,
+        rr.EndDate,
+        rr.ModelID,
+        rr.RestrictionID,
+        rr.VehicleID,
+        rr.ExpiresAt,
+        rr.CreatedAt,
+        rr.UpdatedAt,
+    ).Scan(&rr.ID)
+    if err != nil {
+        return rr, translateError(err)
+    }
+
+    return rr, tx.Commit()
+}
+
+// DeleteHold releases a hold. A hold that was already released or swept is
+// not an error.
+func (m *postgresDbRepo) DeleteHold(id int) error {
+    defer metrics.ObserveQuery("DeleteHold", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `delete from rent_restrictions where id = $1 and restriction_id = $2`
+
+    _, err := m.DB.ExecContext(ctx, query, id, models.RestrictionHold)
+
+    return err
+}
+
+// DeleteExpiredHolds releases all holds that expired at now and returns how
+// many there were.
+func (m *postgresDbRepo) DeleteExpiredHolds(now time.Time) (int, error) {
+    defer metrics.ObserveQuery("DeleteExpiredHolds", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `delete from rent_restrictions where restriction_id = $1 and expires_at <= $2`
+
+    result, err := m.DB.ExecContext(ctx, query, models.RestrictionHold, now)
+    if err != nil {
+        return 0, err
+    }
+
+    n, err := result.RowsAffected()
+    if err != nil {
+        return 0, err
+    }
+
+    return int(n), nil
+}
+
+// UnpaidRentsBefore returns the ids of the pending rents last changed before
+// before. Rents whose payment has been authorized or captured are left out,
+// their confirmation is on its way.
+func (m *postgresDbRepo) UnpaidRentsBefore(before time.Time) ([]int, error) {
+    defer metrics.ObserveQuery("UnpaidRentsBefore", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var ids []int
+
+    query := `
+        select 
+            r.id 
+        from 
+            rent r 
+        where 
+            r.status = $1 and r.updated_at < $2 and not exists 
+            (select 
+                1 
+            from 
+                payments p 
+            where 
+                p.rent_id = r.id and p.status in ($3, $4))
+        order by 
+            r.id`
+
+    rows, err := m.DB.QueryContext(ctx, query, models.RentPending, before,
+        payments.StatusAuthorized, payments.StatusCaptured)
+    if err != nil {
+        return ids, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var id int
+        err := rows.Scan(&id)
+        if err != nil {
+            return ids, err
+        }
+        ids = append(ids, id)
+    }
+
+    if err = rows.Err(); err != nil {
+        return ids, err
+    }
+
+    return ids, nil
+}
+
+// GetPriceList returns a model together with its rate periods and rental
+// discounts.
+func (m *postgresDbRepo) GetPriceList(modelID int) (models.PriceList, error) {
+    defer metrics.ObserveQuery("GetPriceList", time.Now())
+
+    var pl models.PriceList
+
+    model, err := m.GetModelByID(modelID)
+    if err != nil {
+        return pl, err
+    }
+    pl.Model = model
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `
+        select 
+            id, model_id, name, start_date, end_date, daily_rate, weekend_rate,
+            created_at, updated_at
+        from 
+            rate_periods 
+        where 
+            model_id = $1
+        order by 
+            start_date`
+
+    rows, err := m.DB.QueryContext(ctx, query, modelID)
+    if err != nil {
+        return pl, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var period models.RatePeriod
+        err = rows.Scan(
+            &period.ID,
+            &period.ModelID,
+            &period.Name,
+            &period.StartDate,
+            &period.EndDate,
+            &period.DailyRate,
+            &period.WeekendRate,
+            &period.CreatedAt,
+            &period.UpdatedAt,
+        )
+        if err != nil {
+            return pl, err
+        }
+
+        pl.Periods = append(pl.Periods, period)
+    }
+
+    if err = rows.Err(); err != nil {
+        return pl, err
+    }
+
+    query = `
+        select 
+            id, model_id, min_days, percent, created_at, updated_at
+        from 
+            rental_discounts 
+        where 
+            model_id = $1
+        order by 
+            min_days`
+
+    rows, err = m.DB.QueryContext(ctx, query, modelID)
+    if err != nil {
+        return pl, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var discount models.RentalDiscount
+        err = rows.Scan(
+            &discount.ID,
+            &discount.ModelID,
+            &discount.MinDays,
+            &discount.Percent,
+            &discount.CreatedAt,
+            &discount.UpdatedAt,
+        )
+        if err != nil {
+            return pl, err
+        }
+
+        pl.Discounts = append(pl.Discounts, discount)
+    }
+
+    if err = rows.Err(); err != nil {
+        return pl, err
+    }
+
+    return pl, nil
+}
+
+// InsertPayment stores a payment of a rent and returns its id.
+func (m *postgresDbRepo) InsertPayment(payment models.Payment) (int, error) {
+    defer metrics.ObserveQuery("InsertPayment", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var newID int
+
+    query := `insert into payments (rent_id, provider, intent_id, amount,
+            currency, status, checkout_url, created_at, updated_at)
+            values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+    err := m.DB.QueryRowContext(
+        ctx,
+        query,
+        payment.RentID,
+        payment.Provider,
+        payment.IntentID,
+        payment.Amount,
+        payment.Currency,
+        payment.Status,
+        payment.CheckoutURL,
+        time.Now(),
+        time.Now(),
+    ).Scan(&newID)
+    if err != nil {
+        return 0, translateError(err)
+    }
+
+    return newID, nil
+}
+
+// GetPaymentByRentID returns the latest payment of a rent.
+func (m *postgresDbRepo) GetPaymentByRentID(rentID int) (models.Payment, error) {
+    defer metrics.ObserveQuery("GetPaymentByRentID", time.Now())
+
+    return m.getPayment("rent_id = $1 order by id desc limit 1", rentID)
+}
+
+// GetPaymentByIntentID returns the payment with the intent id of a provider.
+func (m *postgresDbRepo) GetPaymentByIntentID(provider, intentID string) (models.Payment, error) {
+    defer metrics.ObserveQuery("GetPaymentByIntentID", time.Now())
+
+    return m.getPayment("provider = $1 and intent_id = $2", provider, intentID)
+}
+
+// getPayment returns the first payment matching the where condition.
+func (m *postgresDbRepo) getPayment(where string, args ...interface{}) (models.Payment, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var payment models.Payment
+
+    query := `
+        select 
+            id, rent_id, provider, intent_id, amount, currency, status,
+            checkout_url, created_at, updated_at
+        from 
+            payments
+        where 
+            ` + where
+
+    err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+        &payment.ID,
+        &payment.RentID,
+        &payment.Provider,
+        &payment.IntentID,
+        &payment.Amount,
+        &payment.Currency,
+        &payment.Status,
+        &payment.CheckoutURL,
+        &payment.CreatedAt,
+        &payment.UpdatedAt,
+    )
+
+    return payment, err
+}
+
+// UpdatePaymentStatus sets the status of a payment.
+func (m *postgresDbRepo) UpdatePaymentStatus(id int, status string) error {
+    defer metrics.ObserveQuery("UpdatePaymentStatus", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `update payments set status = $1, updated_at = $2 where id = $3`
+
+    _, err := m.DB.ExecContext(ctx, query, status, time.Now(), id)
+
+    return err
+}
+
+// AuthorizePayment marks a payment as authorized. It returns
+// repository.ErrPaymentSuperseded if it isn't the latest payment of its rent,
+// e.g. because the dates were changed and a new payment was started.
+func (m *postgresDbRepo) AuthorizePayment(id int) error {
+    defer metrics.ObserveQuery("AuthorizePayment", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    query := `
+        update 
+            payments p 
+        set 
+            status = $1, updated_at = $2 
+        where 
+            p.id = $3 and p.status <> $4 
+                and p.id = (select max(id) from payments where rent_id = p.rent_id)`
+
+    result, err := m.DB.ExecContext(ctx, query, payments.StatusAuthorized, time.Now(), id, payments.StatusCancelled)
+    if err != nil {
+        return err
+    }
+    n, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if n == 0 {
+        return repository.ErrPaymentSuperseded
+    }
+
+    return nil
+}
+
+// ConfirmPayment marks a payment as captured and confirms its rent in one
+// transaction. The confirmation is recorded in the rent status history. It
+// returns repository.ErrStatusChanged if the rent isn't pending any more, e.g.
+// because it was cancelled while the customer paid. Confirming a payment that
+// has been captured already does nothing, so that it can be retried.
+func (m *postgresDbRepo) ConfirmPayment(id int) error {
+    defer metrics.ObserveQuery("ConfirmPayment", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    // Rollback is a no-op once the transaction has been committed
+    defer tx.Rollback()
+
+    var rentID int
+    var status string
+
+    query := `select rent_id, status from payments where id = $1 for update`
+
+    err = tx.QueryRowContext(ctx, query, id).Scan(&rentID, &status)
+    if err != nil {
+        return err
+    }
+    if status == payments.StatusCaptured {
+        return nil
+    }
+
+    var from string
+
+    query = `select status from rent where id = $1 for update`
+
+    err = tx.QueryRowContext(ctx, query, rentID).Scan(&from)
+    if err != nil {
+        return err
+    }
+    // a cancelled rent holds no vehicle any more, confirming it could book
+    // the vehicle twice
+    if from != models.RentPending {
+        return repository.ErrStatusChanged
+    }
+
+    query = `update payments set status = $1, updated_at = $2 where id = $3`
+
+    _, err = tx.ExecContext(ctx, query, payments.StatusCaptured, time.Now(), id)
+    if err != nil {
+        return err
+    }
+
+    query = `update rent set status = $1, updated_at = $2 where id = $3`
+
+    _, err = tx.ExecContext(ctx, query, models.RentConfirmed, time.Now(), rentID)
+    if err != nil {
+        return err
+    }
+
+    err = insertStatusChange(ctx, tx, rentID, from, models.RentConfirmed, "payment")
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// Ping checks that the database can be reached.
+func (m *postgresDbRepo) Ping() error {
+    defer metrics.ObserveQuery("Ping", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    return m.DB.PingContext(ctx)
+}
+
+// AppliedMigrations returns the versions of the migrations that have been run,
+// as recorded in the schema_migration table.
+func (m *postgresDbRepo) AppliedMigrations() ([]string, error) {
+    defer metrics.ObserveQuery("AppliedMigrations", time.Now())
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    var versions []string
+
+    rows, err := m.DB.QueryContext(ctx, `select version from schema_migration order by version`)
+    if err != nil {
+        return versions, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var version string
+        err = rows.Scan(&version)
+        if err != nil {
+            return versions, err
+        }
+        versions = append(versions, version)
+    }
+
+    return versions, rows.Err()
+}
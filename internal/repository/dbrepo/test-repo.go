@@ -1,10 +1,15 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"time"
 
 	"github.com/sanijo/rent-app/internal/models"
+	"github.com/sanijo/rent-app/internal/payments"
+	"github.com/sanijo/rent-app/internal/repository"
+	"github.com/sanijo/rent-app/migrations"
 )
 
 
@@ -33,40 +38,71 @@ func (m *testDBRepo) InsertRentRestriction(rentRestriction models.RentRestrictio
     return nil
 }
 
-// SearchAvailabilityByDatesByModelID returns true if availability exists for
-// modelID, and false if no availability exists.
-func (m *testDBRepo) SearchAvailabilityByDatesAndModelID(start, end time.Time, modelID int) (bool, error) {
-    // If the start date is equal to 2021-01-01, return false and nil
+// CreateBooking inserts a rent and its reservation restriction in a single
+// transaction.
+func (m *testDBRepo) CreateBooking(ctx context.Context, rent models.Rent) (int, error) {
+    // Nothing is stored for requests that have gone away
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    // If the rent modelID is 3 inserting the rent fails, if it is 4 inserting
+    // the restriction fails. Either way nothing is stored.
+    if rent.ModelID == 3 || rent.ModelID == 4 {
+        return 0, errors.New("some error")
+    }
+    // If the rent modelID is 5 or the start date is 2049-01-01, the dates
+    // were booked by someone else
+    date, _ := time.Parse("2006-01-02", "2049-01-01")
+    if rent.ModelID == 5 || rent.StartDate.Equal(date) {
+        return 0, repository.ErrNotAvailable
+    }
+
+    return 1, nil
+}
+
+// CreateBookingFromHold inserts a rent converting its hold into the
+// reservation.
+func (m *testDBRepo) CreateBookingFromHold(ctx context.Context, rent models.Rent, holdID int) (int, error) {
+    return m.CreateBooking(ctx, rent)
+}
+
+// SearchAvailabilityByDatesAndModelID returns the number of active vehicles
+// of modelID that are free between start and end.
+func (m *testDBRepo) SearchAvailabilityByDatesAndModelID(start, end time.Time, modelID int) (int, error) {
+    // If the start date is equal to 2049-01-01, no vehicle is free
     layout := "2006-01-02"
-    date, _ := time.Parse(layout, "2021-01-01")
+    date, _ := time.Parse(layout, "2049-01-01")
     if start == date {
-        return false, nil
+        return 0, nil
     } else if start == date.AddDate(0, 0, 1) {
-        return false, errors.New("some error")
+        return 0, errors.New("some error")
     }
 
-    return true, nil
+    return 1, nil
 }
     
 // SearchAvailabilityForAllModels returns a slice of available models if any,
 // for given start and end dates.
 func (m *testDBRepo) SearchAvailabilityForAllModels(start, end time.Time) ([]models.Model, error) {
     var availableCarModels []models.Model
-    // If the start date is equal to 2021-01-01, return an error 
+    // If the start date is equal to 2049-01-01, return an error 
     layout := "2006-01-02"
-    date, _ := time.Parse(layout, "2021-01-01")
+    date, _ := time.Parse(layout, "2049-01-01")
     if start == date {
-        return availableCarModels, errors.New("date equal to 2021-01-01, test error")
+        return availableCarModels, errors.New("date equal to 2049-01-01, test error")
     }
-    // If the start date is equal to 2022-01-02, return availableCarModels with 
+    // If the start date is equal to 2049-02-02, return availableCarModels with 
     // modelID 1 and 2
-    date, _ = time.Parse(layout, "2022-01-02")
+    date, _ = time.Parse(layout, "2049-02-02")
     if start == date {
         availableCarModels = append(availableCarModels, models.Model{
             ID: 1,
+            FreeUnits: 2,
         })
         availableCarModels = append(availableCarModels, models.Model{
             ID: 2,
+            MaxDays: 7,
+            FreeUnits: 1,
         })
         return availableCarModels, nil
     }
@@ -78,9 +114,575 @@ func (m *testDBRepo) SearchAvailabilityForAllModels(start, end time.Time) ([]mod
 func (m *testDBRepo) GetModelByID(id int) (models.Model, error) {
     var model models.Model
 
-    if id > 2 {
-        return model, errors.New("some error")
+    // models 5 and 6 exist, so that holding them can fail
+    if id > 2 && id != 5 && id != 6 {
+        return model, sql.ErrNoRows
+    }
+
+    model.ID = id
+    // model 1 needs a day between rents, model 2 can be rented for a week at
+    // most
+    switch id {
+    case 1:
+        model.TurnaroundHours = 24
+    case 2:
+        model.MaxDays = 7
     }
 
     return model, nil
 }
+
+// GetUserByID returns a user by id.
+func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
+    var user models.User
+
+    if id > 2 {
+        return user, errors.New("some error")
+    }
+
+    user.ID = id
+
+    return user, nil
+}
+
+// InsertUser stores a user with the bcrypt hash of password.
+func (m *testDBRepo) InsertUser(user models.User, password string) (int, error) {
+    if user.Email == "taken@here.ca" {
+        return 0, repository.ErrAlreadyExists
+    }
+
+    return 1, nil
+}
+
+// Authenticate checks email and password against the users table.
+func (m *testDBRepo) Authenticate(email, testPassword string) (int, int, error) {
+    // Only me@here.ca with password "password" is a valid user
+    if email == "me@here.ca" && testPassword == "password" {
+        return 1, 3, nil
+    }
+
+    return 0, 0, repository.ErrInvalidCredentials
+}
+
+// AllRents returns a slice of all rents.
+func (m *testDBRepo) AllRents() ([]models.Rent, error) {
+    var rents []models.Rent
+
+    rents = append(rents, models.Rent{
+        ID: 1,
+        FirstName: "John",
+        LastName: "Doe",
+        Email: "john@doe.com",
+        StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+        EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+        ModelID: 1,
+        TotalPrice: 16000,
+        Status: models.RentConfirmed,
+        Reference: "K7QMX2RA9T",
+        Model: models.Model{ID: 1, ModelName: "Model 3"},
+    })
+    rents = append(rents, models.Rent{
+        ID: 5,
+        FirstName: "Jane",
+        LastName: "Doe",
+        Email: "jane@doe.com",
+        StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+        EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+        ModelID: 1,
+        TotalPrice: 16000,
+        Status: models.RentCancelled,
+        Reference: "P4WNZ8HC3L",
+        Model: models.Model{ID: 1, ModelName: "Model 3"},
+    })
+
+    return rents, nil
+}
+
+// RentsBetween returns the rents overlapping the dates from start up to end,
+// leaving out cancelled rents.
+func (m *testDBRepo) RentsBetween(start, end time.Time) ([]models.Rent, error) {
+    // If the start date is 2021-01-02, return an error
+    if start.Equal(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)) {
+        return nil, errors.New("some error")
+    }
+
+    all, err := m.AllRents()
+    if err != nil {
+        return nil, err
+    }
+
+    var rents []models.Rent
+    for _, rent := range all {
+        if rent.Status != models.RentCancelled {
+            rents = append(rents, rent)
+        }
+    }
+
+    return rents, nil
+}
+
+// AllNewRents returns a slice of rents that are not yet processed.
+func (m *testDBRepo) AllNewRents() ([]models.Rent, error) {
+    var rents []models.Rent
+
+    return rents, nil
+}
+
+// GetRentByID returns a rent by id.
+func (m *testDBRepo) GetRentByID(id int) (models.Rent, error) {
+    var rent models.Rent
+
+    if id == 3 || id > 6 {
+        return rent, sql.ErrNoRows
+    }
+
+    rent.ID = id
+    rent.Email = "john@doe.com"
+    rent.StartDate = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+    rent.EndDate = time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)
+    rent.TotalPrice = 16000
+    rent.Status = models.RentConfirmed
+    // Rent 2 waits for its payment, rent 4 fails to change its status, rent 5
+    // was cancelled and rent 6 has a captured payment
+    if id == 2 {
+        rent.Status = models.RentPending
+    }
+    if id == 5 {
+        rent.Status = models.RentCancelled
+    }
+
+    return rent, nil
+}
+
+// GetRentByReference returns a rent by its reference code.
+func (m *testDBRepo) GetRentByReference(reference string) (models.Rent, error) {
+    rent := models.Rent{
+        ID: 1,
+        FirstName: "John",
+        LastName: "Doe",
+        Email: "john@doe.com",
+        StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+        EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+        ModelID: 1,
+        TotalPrice: 16000,
+        Status: models.RentConfirmed,
+        Reference: reference,
+        Model: models.Model{ID: 1, ModelName: "Model 3"},
+    }
+
+    // PENDING waits for its payment, CANCELLED has been cancelled, SOON is
+    // picked up tomorrow, BROKEN can't be changed and PAID has a captured
+    // payment
+    switch reference {
+    case "UNKNOWN":
+        return models.Rent{}, sql.ErrNoRows
+    case "PENDING":
+        rent.ID = 2
+        rent.Status = models.RentPending
+    case "CANCELLED":
+        rent.Status = models.RentCancelled
+    case "SOON":
+        rent.StartDate = time.Now().UTC().Truncate(24 * time.Hour).AddDate(0, 0, 1)
+        rent.EndDate = rent.StartDate.AddDate(0, 0, 2)
+    case "BROKEN":
+        rent.ID = 3
+    case "PAID":
+        rent.ID = 6
+    }
+
+    return rent, nil
+}
+
+// ChangeRentDates moves a rent to its new dates.
+func (m *testDBRepo) ChangeRentDates(rent models.Rent) error {
+    // No vehicle is free from 2050-02-01, rent 3 fails
+    if rent.StartDate.Equal(time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC)) {
+        return repository.ErrNotAvailable
+    }
+    if rent.ID == 3 {
+        return errors.New("some error")
+    }
+
+    return nil
+}
+
+// UpdateRentStatus changes the status of a rent and records the change.
+func (m *testDBRepo) UpdateRentStatus(id int, from, to, changedBy string) error {
+    if id == 3 || id == 4 {
+        return errors.New("some error")
+    }
+
+    return nil
+}
+
+// GetRentStatusHistory returns the status changes of a rent, oldest first.
+func (m *testDBRepo) GetRentStatusHistory(rentID int) ([]models.RentStatusChange, error) {
+    var history []models.RentStatusChange
+
+    // Rent 1 was paid by the customer
+    if rentID == 1 {
+        history = append(history, models.RentStatusChange{
+            ID: 1,
+            RentID: 1,
+            FromStatus: models.RentPending,
+            ToStatus: models.RentConfirmed,
+            ChangedBy: "payment",
+            CreatedAt: time.Date(2049, 12, 1, 10, 0, 0, 0, time.UTC),
+        })
+    }
+
+    return history, nil
+}
+
+// UpdateRent updates the customer details of a rent.
+func (m *testDBRepo) UpdateRent(rent models.Rent) error {
+    if rent.ID == 2 {
+        return errors.New("some error")
+    }
+
+    return nil
+}
+
+// DeleteRent deletes a rent by id.
+func (m *testDBRepo) DeleteRent(id int) error {
+    if id == 2 {
+        return errors.New("some error")
+    }
+
+    return nil
+}
+
+// UpdateProcessedForRent sets the processed flag of a rent.
+func (m *testDBRepo) UpdateProcessedForRent(id, processed int) error {
+    if id == 2 {
+        return errors.New("some error")
+    }
+
+    return nil
+}
+
+// AllModels returns a slice of all models.
+func (m *testDBRepo) AllModels() ([]models.Model, error) {
+    var carModels []models.Model
+
+    carModels = append(carModels, models.Model{
+        ID: 1,
+        ModelName: "Model 3",
+        TurnaroundHours: 24,
+    })
+    carModels = append(carModels, models.Model{
+        ID: 2,
+        ModelName: "Model Y",
+    })
+
+    return carModels, nil
+}
+
+// GetVehiclesByModelID returns all vehicles of a model, active or not.
+func (m *testDBRepo) GetVehiclesByModelID(modelID int) ([]models.Vehicle, error) {
+    var vehicles []models.Vehicle
+
+    // Model 1 has vehicles 1 and 3, model 2 has vehicle 2
+    switch modelID {
+    case 1:
+        vehicles = append(vehicles, models.Vehicle{ID: 1, ModelID: 1, Plate: "ZG-1000-AA", Active: true})
+        vehicles = append(vehicles, models.Vehicle{ID: 3, ModelID: 1, Plate: "ZG-3000-AA", Active: false})
+    case 2:
+        vehicles = append(vehicles, models.Vehicle{ID: 2, ModelID: 2, Plate: "ZG-2000-AA", Active: true})
+    default:
+        return vehicles, errors.New("some error")
+    }
+
+    return vehicles, nil
+}
+
+// GetRestrictionsForModelByDate returns restrictions of a model that overlap
+// the given start and end dates.
+func (m *testDBRepo) GetRestrictionsForModelByDate(modelID int, start, end time.Time) ([]models.RentRestriction, error) {
+    var restrictions []models.RentRestriction
+
+    // Vehicle 1 of model 1 has a reservation on the 1st and an owner block on
+    // the 2nd and 3rd of every month, vehicle 3 a block imported from another
+    // calendar on the 10th and 11th
+    if modelID == 1 {
+        restrictions = append(restrictions, models.RentRestriction{
+            ID: 1,
+            StartDate: start,
+            EndDate: start.AddDate(0, 0, 1),
+            ModelID: modelID,
+            RentID: 1,
+            RestrictionID: models.RestrictionReservation,
+            VehicleID: 1,
+        })
+        restrictions = append(restrictions, models.RentRestriction{
+            ID: 2,
+            StartDate: start.AddDate(0, 0, 1),
+            EndDate: start.AddDate(0, 0, 3),
+            ModelID: modelID,
+            RestrictionID: models.RestrictionOwnerBlock,
+            VehicleID: 1,
+        })
+        restrictions = append(restrictions, models.RentRestriction{
+            ID: 3,
+            StartDate: start.AddDate(0, 0, 9),
+            EndDate: start.AddDate(0, 0, 11),
+            ModelID: modelID,
+            RestrictionID: models.RestrictionOwnerBlock,
+            VehicleID: 3,
+            ExternalUID: "imported@test",
+        })
+    }
+
+    return restrictions, nil
+}
+
+// UpdateOwnerBlocks applies the owner block changes of all vehicles in one
+// transaction.
+func (m *testDBRepo) UpdateOwnerBlocks(changes []models.OwnerBlockChange) error {
+    // Vehicle 2 can't be blocked, vehicle 3 is booked on the 20th
+    for _, change := range changes {
+        if change.VehicleID == 2 && len(change.AddDays) > 0 {
+            return errors.New("some error")
+        }
+        for _, day := range change.AddDays {
+            if change.VehicleID == 3 && day.Day() == 20 {
+                return repository.ErrNotAvailable
+            }
+        }
+    }
+
+    return nil
+}
+
+// UpsertExternalBlock stores an event imported from another platform as an
+// owner block of the first free vehicle of modelID.
+func (m *testDBRepo) UpsertExternalBlock(modelID int, uid string, start, end time.Time) error {
+    // Events with uid taken@test overlap a booking, model 2 fails
+    if uid == "taken@test" {
+        return repository.ErrNotAvailable
+    }
+    if modelID == 2 {
+        return errors.New("some error")
+    }
+
+    return nil
+}
+
+// InsertOwnerBlock blocks a free vehicle of a model from start up to end.
+func (m *testDBRepo) InsertOwnerBlock(modelID int, start, end time.Time) (models.RentRestriction, error) {
+    rr := models.RentRestriction{
+        ID: 1,
+        StartDate: start,
+        EndDate: end,
+        ModelID: modelID,
+        RestrictionID: models.RestrictionOwnerBlock,
+        VehicleID: 1,
+    }
+
+    // Model 2 has no free vehicle
+    if modelID == 2 {
+        return rr, repository.ErrNotAvailable
+    }
+
+    return rr, nil
+}
+
+// DeleteOwnerBlock deletes an owner block.
+func (m *testDBRepo) DeleteOwnerBlock(id int) error {
+    if id == 2 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// InsertHold holds a free vehicle of a model from start up to end until
+// expires.
+func (m *testDBRepo) InsertHold(modelID int, start, end, expires time.Time) (models.RentRestriction, error) {
+    rr := models.RentRestriction{
+        ID: 1,
+        StartDate: start,
+        EndDate: end,
+        ModelID: modelID,
+        RestrictionID: models.RestrictionHold,
+        VehicleID: 1,
+        ExpiresAt: expires,
+    }
+
+    // Model 5 has no free vehicle, holding model 6 fails
+    if modelID == 5 {
+        return rr, repository.ErrNotAvailable
+    }
+    if modelID == 6 {
+        return rr, errors.New("some error")
+    }
+
+    return rr, nil
+}
+
+// DeleteHold releases a hold.
+func (m *testDBRepo) DeleteHold(id int) error {
+    if id == 2 {
+        return errors.New("some error")
+    }
+
+    return nil
+}
+
+// DeleteExpiredHolds releases all holds that expired at now.
+func (m *testDBRepo) DeleteExpiredHolds(now time.Time) (int, error) {
+    return 0, nil
+}
+
+// UnpaidRentsBefore returns the ids of the pending rents last changed before
+// before.
+func (m *testDBRepo) UnpaidRentsBefore(before time.Time) ([]int, error) {
+    return nil, nil
+}
+
+// GetPriceList returns a model together with its rate periods and rental
+// discounts.
+func (m *testDBRepo) GetPriceList(modelID int) (models.PriceList, error) {
+    var pl models.PriceList
+
+    if modelID == 6 {
+        return pl, sql.ErrNoRows
+    }
+
+    pl.Model = models.Model{
+        ID: modelID,
+        DailyRate: 8000,
+        WeekendRate: 10000,
+    }
+    pl.Discounts = append(pl.Discounts, models.RentalDiscount{
+        ModelID: modelID,
+        MinDays: 7,
+        Percent: 10,
+    })
+
+    return pl, nil
+}
+
+// InsertPayment stores a payment of a rent and returns its id.
+func (m *testDBRepo) InsertPayment(payment models.Payment) (int, error) {
+    if payment.RentID == 3 {
+        return 0, errors.New("some error")
+    }
+
+    return 1, nil
+}
+
+// GetPaymentByRentID returns the latest payment of a rent.
+func (m *testDBRepo) GetPaymentByRentID(rentID int) (models.Payment, error) {
+    // Rent 6 has been paid
+    if rentID == 6 {
+        return models.Payment{
+            ID: 8,
+            RentID: rentID,
+            Provider: "fake",
+            IntentID: "pi_paid",
+            Amount: 16000,
+            Currency: "eur",
+            Status: payments.StatusCaptured,
+        }, nil
+    }
+    if rentID > 2 {
+        return models.Payment{}, sql.ErrNoRows
+    }
+
+    return models.Payment{
+        ID: 1,
+        RentID: rentID,
+        Provider: "fake",
+        IntentID: "pi_test",
+        Amount: 16000,
+        Currency: "eur",
+        Status: payments.StatusPending,
+        CheckoutURL: payments.FakeCheckoutPath + "pi_test",
+    }, nil
+}
+
+// GetPaymentByIntentID returns the payment with the intent id of a provider.
+func (m *testDBRepo) GetPaymentByIntentID(provider, intentID string) (models.Payment, error) {
+    // Payment 2 fails to update, payment 3 has been captured already, the
+    // rent of payment 4 was cancelled and payment 5 has been replaced.
+    // Payments 6 and 7 belong to the cancelled rent 5, payment 6 has been
+    // refunded and must not change any more.
+    payment := models.Payment{
+        ID: 1,
+        RentID: 1,
+        Provider: provider,
+        IntentID: intentID,
+        Amount: 16000,
+        Currency: "eur",
+        Status: payments.StatusPending,
+    }
+
+    switch intentID {
+    case "pi_unknown":
+        return payment, sql.ErrNoRows
+    case "pi_broken":
+        payment.ID = 2
+    case "pi_captured":
+        payment.ID = 3
+        payment.Status = payments.StatusCaptured
+    case "pi_cancelled":
+        payment.ID = 4
+    case "pi_superseded":
+        payment.ID = 5
+        payment.Status = payments.StatusCancelled
+    case "pi_refunded":
+        payment.ID = 6
+        payment.RentID = 5
+        payment.Status = payments.StatusRefunded
+    case "pi_rent_cancelled":
+        payment.ID = 7
+        payment.RentID = 5
+    }
+
+    return payment, nil
+}
+
+// UpdatePaymentStatus sets the status of a payment.
+func (m *testDBRepo) UpdatePaymentStatus(id int, status string) error {
+    if id == 2 || id == 6 {
+        return errors.New("some error")
+    }
+
+    return nil
+}
+
+// AuthorizePayment marks a payment as authorized.
+func (m *testDBRepo) AuthorizePayment(id int) error {
+    if id == 2 {
+        return errors.New("some error")
+    }
+    if id == 5 {
+        return repository.ErrPaymentSuperseded
+    }
+
+    return nil
+}
+
+// ConfirmPayment marks a payment as captured and confirms its rent.
+func (m *testDBRepo) ConfirmPayment(id int) error {
+    if id == 2 {
+        return errors.New("some error")
+    }
+    if id == 4 {
+        return repository.ErrStatusChanged
+    }
+
+    return nil
+}
+
+// Ping checks that the database can be reached.
+func (m *testDBRepo) Ping() error {
+    return nil
+}
+
+// AppliedMigrations returns the versions of the migrations that have been run,
+// the test database is always up to date.
+func (m *testDBRepo) AppliedMigrations() ([]string, error) {
+    return migrations.Versions()
+}
@@ -1,17 +1,75 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/sanijo/rent-app/internal/models"
 )
 
+// ErrNotAvailable is returned when a restriction can't be stored because it
+// overlaps an existing one for the same vehicle, or when no vehicle of a
+// model is free.
+var ErrNotAvailable = errors.New("model is not available for the requested dates")
+
+// ErrAlreadyExists is returned when a row can't be stored because a unique
+// value, e.g. the email of a user, is taken.
+var ErrAlreadyExists = errors.New("already exists")
+
+// ErrStatusChanged is returned when the status of a rent can't be changed
+// because someone else changed it first.
+var ErrStatusChanged = errors.New("rent status was changed in the meantime")
+
+// ErrPaymentSuperseded is returned when a payment can't be authorized because
+// a newer payment of the same rent has been started.
+var ErrPaymentSuperseded = errors.New("payment has been replaced by a newer one")
+
+// ErrInvalidCredentials is returned when email and password don't match any
+// user.
+var ErrInvalidCredentials = errors.New("invalid credentials")
 
 type DatabaseRepo interface {
     AllUsers() bool
+    InsertUser(user models.User, password string) (int, error)
     InsertRent(rent models.Rent) (int, error)
     InsertRentRestriction(rentRestriction models.RentRestriction) error
-    SearchAvailabilityByDatesAndModelID(start, end time.Time, modelID int) (bool, error)
+    CreateBooking(ctx context.Context, rent models.Rent) (int, error)
+    CreateBookingFromHold(ctx context.Context, rent models.Rent, holdID int) (int, error)
+    SearchAvailabilityByDatesAndModelID(start, end time.Time, modelID int) (int, error)
     SearchAvailabilityForAllModels(start, end time.Time) ([]models.Model, error)
     GetModelByID(id int) (models.Model, error) 
+    GetUserByID(id int) (models.User, error)
+    Authenticate(email, testPassword string) (int, int, error)
+    AllRents() ([]models.Rent, error)
+    AllNewRents() ([]models.Rent, error)
+    RentsBetween(start, end time.Time) ([]models.Rent, error)
+    GetRentByID(id int) (models.Rent, error)
+    GetRentByReference(reference string) (models.Rent, error)
+    ChangeRentDates(rent models.Rent) error
+    UpdateRentStatus(id int, from, to, changedBy string) error
+    GetRentStatusHistory(rentID int) ([]models.RentStatusChange, error)
+    UpdateRent(rent models.Rent) error
+    DeleteRent(id int) error
+    UpdateProcessedForRent(id, processed int) error
+    AllModels() ([]models.Model, error)
+    GetVehiclesByModelID(modelID int) ([]models.Vehicle, error)
+    GetRestrictionsForModelByDate(modelID int, start, end time.Time) ([]models.RentRestriction, error)
+    UpdateOwnerBlocks(changes []models.OwnerBlockChange) error
+    UpsertExternalBlock(modelID int, uid string, start, end time.Time) error
+    InsertOwnerBlock(modelID int, start, end time.Time) (models.RentRestriction, error)
+    DeleteOwnerBlock(id int) error
+    InsertHold(modelID int, start, end, expires time.Time) (models.RentRestriction, error)
+    DeleteHold(id int) error
+    DeleteExpiredHolds(now time.Time) (int, error)
+    UnpaidRentsBefore(before time.Time) ([]int, error)
+    GetPriceList(modelID int) (models.PriceList, error)
+    InsertPayment(payment models.Payment) (int, error)
+    GetPaymentByRentID(rentID int) (models.Payment, error)
+    GetPaymentByIntentID(provider, intentID string) (models.Payment, error)
+    UpdatePaymentStatus(id int, status string) error
+    AuthorizePayment(id int) error
+    ConfirmPayment(id int) error
+    Ping() error
+    AppliedMigrations() ([]string, error)
 }
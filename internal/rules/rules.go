@@ -0,0 +1,208 @@
+// Package rules checks requested rental dates against the booking rules:
+// rental length, lead time, booking horizon, pick-up weekdays and blackout
+// days. The rules are checked before searching and again before booking.
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+)
+
+// dateLayout is the format of the dates in blackout lists, e.g. 2050-01-02
+const dateLayout = "2006-01-02"
+
+// Blackout is a range of days, both inclusive, in which no rental may be
+// picked up, returned or running
+type Blackout struct {
+    Start time.Time
+    End time.Time
+}
+
+// Rules are the booking rules every requested rental has to satisfy. Zero
+// values disable a rule, e.g. a MaxDays of 0 allows rentals of any length.
+type Rules struct {
+    MinDays int
+    MaxDays int
+    // LeadTime is how long before the pick-up day a rental has to be booked
+    LeadTime time.Duration
+    // Horizon is how far in advance a rental can be booked
+    Horizon time.Duration
+    // PickupDays are the weekdays on which vehicles are picked up, empty
+    // means every day
+    PickupDays []time.Weekday
+    Blackouts []Blackout
+}
+
+// Violation is a broken rule. Field is the date the rule applies to, either
+// "start" or "end".
+type Violation struct {
+    Field string
+    Message string
+}
+
+// ForModel returns the rules for renting model, its rental length limits
+// replace the global ones when set
+func (r Rules) ForModel(model models.Model) Rules {
+    if model.MinDays > 0 {
+        r.MinDays = model.MinDays
+    }
+    if model.MaxDays > 0 {
+        r.MaxDays = model.MaxDays
+    }
+
+    return r
+}
+
+// Check returns the rules broken by a rental from start to end booked at now.
+// Rentals whose end is not after start break no other rule.
+func (r Rules) Check(start, end, now time.Time) []Violation {
+    if !end.After(start) {
+        return []Violation{{"end", "Return date must be after pick-up date"}}
+    }
+
+    var violations []Violation
+
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, start.Location())
+    earliest := now.Add(r.LeadTime)
+    earliest = time.Date(earliest.Year(), earliest.Month(), earliest.Day(), 0, 0, 0, 0, start.Location())
+    switch {
+    case start.Before(today):
+        violations = append(violations, Violation{"start", "Pick-up date is in the past"})
+    case start.Before(earliest):
+        violations = append(violations, Violation{"start",
+            fmt.Sprintf("Rentals have to be booked at least %s in advance", duration(r.LeadTime))})
+    }
+
+    if r.Horizon > 0 && start.After(now.Add(r.Horizon)) {
+        violations = append(violations, Violation{"start",
+            fmt.Sprintf("Rentals can be booked at most %s in advance", duration(r.Horizon))})
+    }
+
+    if len(r.PickupDays) > 0 && !hasWeekday(r.PickupDays, start.Weekday()) {
+        violations = append(violations, Violation{"start",
+            fmt.Sprintf("Vehicles can only be picked up on %s", weekdays(r.PickupDays))})
+    }
+
+    days := int(end.Sub(start).Hours() / 24)
+    if r.MinDays > 0 && days < r.MinDays {
+        violations = append(violations, Violation{"end",
+            fmt.Sprintf("The minimum rental is %s", plural(r.MinDays, "day"))})
+    }
+    if r.MaxDays > 0 && days > r.MaxDays {
+        violations = append(violations, Violation{"end",
+            fmt.Sprintf("The maximum rental is %s", plural(r.MaxDays, "day"))})
+    }
+
+    for _, b := range r.Blackouts {
+        if !start.After(b.End) && !end.Before(b.Start) {
+            violations = append(violations, Violation{"start",
+                fmt.Sprintf("No rentals are possible from %s to %s",
+                    b.Start.Format(dateLayout), b.End.Format(dateLayout))})
+        }
+    }
+
+    return violations
+}
+
+// hasWeekday returns true if day is one of days
+func hasWeekday(days []time.Weekday, day time.Weekday) bool {
+    for _, d := range days {
+        if d == day {
+            return true
+        }
+    }
+    return false
+}
+
+// weekdays formats days as e.g. Friday, Saturday
+func weekdays(days []time.Weekday) string {
+    names := make([]string, len(days))
+    for i, d := range days {
+        names[i] = d.String()
+    }
+    return strings.Join(names, ", ")
+}
+
+// duration formats d in whole days if possible, e.g. 2 days or 12 hours
+func duration(d time.Duration) string {
+    if d%(24*time.Hour) == 0 {
+        return plural(int(d/(24*time.Hour)), "day")
+    }
+    if d%time.Hour == 0 {
+        return plural(int(d/time.Hour), "hour")
+    }
+    return d.String()
+}
+
+// plural formats n with the noun in singular or plural, e.g. 1 day or 2 days
+func plural(n int, noun string) string {
+    if n == 1 {
+        return fmt.Sprintf("%d %s", n, noun)
+    }
+    return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// ParseWeekdays parses a comma separated list of weekdays, e.g. fri,sat.
+// Full names and the first three letters are accepted in any case.
+func ParseWeekdays(s string) ([]time.Weekday, error) {
+    var days []time.Weekday
+
+    for _, name := range strings.Split(s, ",") {
+        name = strings.ToLower(strings.TrimSpace(name))
+        if name == "" {
+            continue
+        }
+
+        found := false
+        for d := time.Sunday; d <= time.Saturday; d++ {
+            full := strings.ToLower(d.String())
+            if name == full || name == full[:3] {
+                days = append(days, d)
+                found = true
+                break
+            }
+        }
+        if !found {
+            return nil, fmt.Errorf("unknown weekday %q", name)
+        }
+    }
+
+    return days, nil
+}
+
+// ParseBlackouts parses a comma separated list of days and day ranges, e.g.
+// 2050-12-24..2050-12-26,2051-01-01
+func ParseBlackouts(s string) ([]Blackout, error) {
+    var blackouts []Blackout
+
+    for _, item := range strings.Split(s, ",") {
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+
+        first, last, isRange := strings.Cut(item, "..")
+        if !isRange {
+            last = first
+        }
+
+        start, err := time.Parse(dateLayout, strings.TrimSpace(first))
+        if err != nil {
+            return nil, fmt.Errorf("invalid blackout %q, use YYYY-MM-DD or YYYY-MM-DD..YYYY-MM-DD", item)
+        }
+        end, err := time.Parse(dateLayout, strings.TrimSpace(last))
+        if err != nil {
+            return nil, fmt.Errorf("invalid blackout %q, use YYYY-MM-DD or YYYY-MM-DD..YYYY-MM-DD", item)
+        }
+        if end.Before(start) {
+            return nil, fmt.Errorf("invalid blackout %q, it ends before it starts", item)
+        }
+
+        blackouts = append(blackouts, Blackout{Start: start, End: end})
+    }
+
+    return blackouts, nil
+}
@@ -0,0 +1,145 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sanijo/rent-app/internal/models"
+)
+
+func date(s string) time.Time {
+    d, _ := time.Parse(dateLayout, s)
+    return d
+}
+
+func TestCheck(t *testing.T) {
+    // a Wednesday afternoon
+    now := time.Date(2050, 1, 5, 15, 0, 0, 0, time.UTC)
+
+    rules := Rules{
+        MinDays: 2,
+        MaxDays: 14,
+        LeadTime: 24 * time.Hour,
+        Horizon: 90 * 24 * time.Hour,
+        PickupDays: []time.Weekday{time.Thursday, time.Friday, time.Saturday},
+        Blackouts: []Blackout{{date("2050-01-20"), date("2050-01-22")}},
+    }
+
+    var tests = []struct {
+        name string
+        start string
+        end string
+        expected []string
+    }{
+        {"valid", "2050-01-06", "2050-01-09", nil},
+        {"end before start", "2050-01-09", "2050-01-06", []string{"end: Return date must be after pick-up date"}},
+        {"same day", "2050-01-06", "2050-01-06", []string{"end: Return date must be after pick-up date"}},
+        {"in the past", "2050-01-01", "2050-01-04", []string{"start: Pick-up date is in the past"}},
+        {"today", "2050-01-05", "2050-01-08", []string{"start: Rentals have to be booked at least 1 day in advance", "start: Vehicles can only be picked up on Thursday, Friday, Saturday"}},
+        {"beyond horizon", "2050-04-07", "2050-04-10", []string{"start: Rentals can be booked at most 90 days in advance"}},
+        {"wrong weekday", "2050-01-09", "2050-01-12", []string{"start: Vehicles can only be picked up on Thursday, Friday, Saturday"}},
+        {"too short", "2050-01-06", "2050-01-07", []string{"end: The minimum rental is 2 days"}},
+        {"too long", "2050-01-06", "2051-01-06", []string{"end: The maximum rental is 14 days", "start: No rentals are possible from 2050-01-20 to 2050-01-22"}},
+        {"longest", "2050-01-06", "2050-01-20", []string{"start: No rentals are possible from 2050-01-20 to 2050-01-22"}},
+        {"returned before blackout", "2050-01-15", "2050-01-19", nil},
+        {"picked up after blackout", "2050-01-27", "2050-01-30", nil},
+        {"during blackout", "2050-01-21", "2050-01-23", []string{"start: No rentals are possible from 2050-01-20 to 2050-01-22"}},
+    }
+
+    for _, e := range tests {
+        var got []string
+        for _, v := range rules.Check(date(e.start), date(e.end), now) {
+            got = append(got, v.Field + ": " + v.Message)
+        }
+        if strings.Join(got, "; ") != strings.Join(e.expected, "; ") {
+            t.Errorf("for %s, expected %q but got %q", e.name, e.expected, got)
+        }
+    }
+}
+
+func TestCheckWithoutRules(t *testing.T) {
+    now := time.Date(2050, 1, 5, 15, 0, 0, 0, time.UTC)
+
+    // only the order of the dates and the past are checked
+    violations := Rules{}.Check(date("2050-01-05"), date("2051-06-01"), now)
+    if len(violations) != 0 {
+        t.Errorf("expected no violations, got %v", violations)
+    }
+}
+
+func TestForModel(t *testing.T) {
+    rules := Rules{MinDays: 1, MaxDays: 30}
+
+    got := rules.ForModel(models.Model{MinDays: 3})
+    if got.MinDays != 3 || got.MaxDays != 30 {
+        t.Errorf("expected 3 to 30 days, got %d to %d", got.MinDays, got.MaxDays)
+    }
+
+    got = rules.ForModel(models.Model{MaxDays: 7})
+    if got.MinDays != 1 || got.MaxDays != 7 {
+        t.Errorf("expected 1 to 7 days, got %d to %d", got.MinDays, got.MaxDays)
+    }
+}
+
+func TestParseWeekdays(t *testing.T) {
+    days, err := ParseWeekdays("fri, Saturday,SUN")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if weekdays(days) != "Friday, Saturday, Sunday" {
+        t.Errorf("unexpected weekdays %v", days)
+    }
+
+    days, err = ParseWeekdays("")
+    if err != nil || len(days) != 0 {
+        t.Errorf("expected no weekdays, got %v %v", days, err)
+    }
+
+    _, err = ParseWeekdays("fri,holiday")
+    if err == nil {
+        t.Error("expected error for unknown weekday")
+    }
+}
+
+func TestParseBlackouts(t *testing.T) {
+    var tests = []struct {
+        name string
+        value string
+        expected []Blackout
+        isError bool
+    }{
+        {"empty", "", nil, false},
+        {"single day", "2050-01-01", []Blackout{{date("2050-01-01"), date("2050-01-01")}}, false},
+        {"range and day", "2050-12-24..2050-12-26, 2051-01-01", []Blackout{
+            {date("2050-12-24"), date("2050-12-26")},
+            {date("2051-01-01"), date("2051-01-01")},
+        }, false},
+        {"invalid date", "2050-13-01", nil, true},
+        {"invalid end", "2050-01-01..tomorrow", nil, true},
+        {"reversed range", "2050-01-02..2050-01-01", nil, true},
+    }
+
+    for _, e := range tests {
+        got, err := ParseBlackouts(e.value)
+        if e.isError {
+            if err == nil {
+                t.Errorf("for %s, expected error", e.name)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("for %s, unexpected error %s", e.name, err)
+            continue
+        }
+        if len(got) != len(e.expected) {
+            t.Errorf("for %s, expected %v but got %v", e.name, e.expected, got)
+            continue
+        }
+        for i := range got {
+            if !got[i].Start.Equal(e.expected[i].Start) || !got[i].End.Equal(e.expected[i].End) {
+                t.Errorf("for %s, expected %v but got %v", e.name, e.expected, got)
+            }
+        }
+    }
+}
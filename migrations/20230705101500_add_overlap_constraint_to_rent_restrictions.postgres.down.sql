@@ -0,0 +1,2 @@
+ALTER TABLE public.rent_restrictions
+    DROP CONSTRAINT IF EXISTS rent_restrictions_no_overlap_excl;
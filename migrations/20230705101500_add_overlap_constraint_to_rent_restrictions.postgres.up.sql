@@ -0,0 +1,5 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE public.rent_restrictions
+    ADD CONSTRAINT rent_restrictions_no_overlap_excl
+    EXCLUDE USING gist (model_id WITH =, daterange(start_date, end_date, '[)') WITH &&);
@@ -0,0 +1,3 @@
+delete from rental_discounts;
+delete from rate_periods;
+update models set daily_rate = 0, weekend_rate = 0;
@@ -0,0 +1,10 @@
+UPDATE public.models SET daily_rate = 8000, weekend_rate = 9500 WHERE model_name = 'Model 3';
+UPDATE public.models SET daily_rate = 10000, weekend_rate = 12000 WHERE model_name = 'Model Y';
+
+INSERT INTO public.rate_periods (model_id,name,start_date,end_date,daily_rate,weekend_rate)
+	SELECT id, 'Summer', '2023-07-01', '2023-09-01', daily_rate + 2000, weekend_rate + 2500 FROM public.models;
+
+INSERT INTO public.rental_discounts (model_id,min_days,percent)
+	SELECT id, 7, 10 FROM public.models;
+INSERT INTO public.rental_discounts (model_id,min_days,percent)
+	SELECT id, 28, 20 FROM public.models;
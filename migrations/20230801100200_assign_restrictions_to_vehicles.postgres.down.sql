@@ -0,0 +1,14 @@
+ALTER TABLE public.rent_restrictions
+    DROP CONSTRAINT IF EXISTS rent_restrictions_no_overlap_excl;
+
+-- restrictions of additional vehicles would overlap on the model
+DELETE FROM public.rent_restrictions rr
+	WHERE rr.vehicle_id <> (SELECT min(v.id) FROM public.vehicles v WHERE v.model_id = rr.model_id);
+
+ALTER TABLE public.rent_restrictions
+    ADD CONSTRAINT rent_restrictions_no_overlap_excl
+    EXCLUDE USING gist (model_id WITH =, daterange(start_date, end_date, '[)') WITH &&);
+
+ALTER TABLE public.rent_restrictions ALTER COLUMN vehicle_id DROP NOT NULL;
+
+DELETE FROM public.vehicles;
@@ -0,0 +1,16 @@
+-- every existing model gets one vehicle, existing restrictions move to it
+INSERT INTO public.vehicles (model_id,vin,plate,color)
+	SELECT id, 'UNKNOWN' || lpad(id::text, 10, '0'), '', '' FROM public.models;
+
+UPDATE public.rent_restrictions rr SET vehicle_id = v.id
+	FROM public.vehicles v WHERE v.model_id = rr.model_id;
+
+ALTER TABLE public.rent_restrictions ALTER COLUMN vehicle_id SET NOT NULL;
+
+-- overlapping restrictions are now only forbidden for the same vehicle
+ALTER TABLE public.rent_restrictions
+    DROP CONSTRAINT IF EXISTS rent_restrictions_no_overlap_excl;
+
+ALTER TABLE public.rent_restrictions
+    ADD CONSTRAINT rent_restrictions_no_overlap_excl
+    EXCLUDE USING gist (vehicle_id WITH =, daterange(start_date, end_date, '[)') WITH &&);
@@ -0,0 +1,37 @@
+// Package migrations holds the database migrations, embedded into the binary.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// FS contains the up and down migrations in fizz and sql format
+//
+//go:embed *.up.fizz *.down.fizz *.up.sql *.down.sql
+var FS embed.FS
+
+// versionLength is the length of the timestamp that prefixes migration files
+const versionLength = 14
+
+// Versions returns the sorted versions of all up migrations
+func Versions() ([]string, error) {
+    files, err := fs.ReadDir(FS, ".")
+    if err != nil {
+        return nil, err
+    }
+
+    var versions []string
+    for _, f := range files {
+        name := f.Name()
+        if len(name) <= versionLength || !strings.Contains(name, ".up.") {
+            continue
+        }
+        versions = append(versions, name[:versionLength])
+    }
+    sort.Strings(versions)
+
+    return versions, nil
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+    versions, err := Versions()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(versions) == 0 {
+        t.Fatal("expected migrations, got none")
+    }
+    if versions[0] != "20230615130512" {
+        t.Errorf("expected first version 20230615130512, got %s", versions[0])
+    }
+    if !sort.StringsAreSorted(versions) {
+        t.Error("expected versions to be sorted")
+    }
+
+    seen := make(map[string]bool)
+    for _, v := range versions {
+        if seen[v] {
+            t.Errorf("version %s listed twice", v)
+        }
+        seen[v] = true
+    }
+}
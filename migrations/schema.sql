@@ -16,6 +16,13 @@ SET xmloption = content;
 SET client_min_messages = warning;
 SET row_security = off;
 
+--
+-- Name: btree_gist; Type: EXTENSION; Schema: -; Owner: -
+--
+
+CREATE EXTENSION IF NOT EXISTS btree_gist WITH SCHEMA public;
+
+
 SET default_tablespace = '';
 
 SET default_table_access_method = heap;
@@ -28,7 +35,12 @@ CREATE TABLE public.models (
     id integer NOT NULL,
     model_name character varying(255) DEFAULT ''::character varying NOT NULL,
     created_at timestamp with time zone DEFAULT now() NOT NULL,
-    updated_at timestamp with time zone DEFAULT now() NOT NULL
+    updated_at timestamp with time zone DEFAULT now() NOT NULL,
+    daily_rate integer DEFAULT 0 NOT NULL,
+    weekend_rate integer DEFAULT 0 NOT NULL,
+    min_days integer DEFAULT 0 NOT NULL,
+    max_days integer DEFAULT 0 NOT NULL,
+    turnaround_hours integer DEFAULT 0 NOT NULL
 );
 
 
@@ -56,6 +68,89 @@ ALTER TABLE public.models_id_seq OWNER TO postgres;
 ALTER SEQUENCE public.models_id_seq OWNED BY public.models.id;
 
 
+--
+-- Name: payments; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.payments (
+    id integer NOT NULL,
+    rent_id integer NOT NULL,
+    provider character varying(255) NOT NULL,
+    intent_id character varying(255) NOT NULL,
+    amount integer NOT NULL,
+    currency character varying(255) DEFAULT 'eur'::character varying NOT NULL,
+    status character varying(255) NOT NULL,
+    checkout_url character varying(255) DEFAULT ''::character varying NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.payments OWNER TO postgres;
+
+--
+-- Name: payments_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.payments_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.payments_id_seq OWNER TO postgres;
+
+--
+-- Name: payments_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.payments_id_seq OWNED BY public.payments.id;
+
+
+--
+-- Name: rate_periods; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.rate_periods (
+    id integer NOT NULL,
+    model_id bigint NOT NULL,
+    name character varying(255) DEFAULT ''::character varying NOT NULL,
+    start_date date NOT NULL,
+    end_date date NOT NULL,
+    daily_rate integer DEFAULT 0 NOT NULL,
+    weekend_rate integer DEFAULT 0 NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.rate_periods OWNER TO postgres;
+
+--
+-- Name: rate_periods_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.rate_periods_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.rate_periods_id_seq OWNER TO postgres;
+
+--
+-- Name: rate_periods_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.rate_periods_id_seq OWNED BY public.rate_periods.id;
+
+
 --
 -- Name: rent; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -70,7 +165,12 @@ CREATE TABLE public.rent (
     end_date date NOT NULL,
     model_id bigint NOT NULL,
     created_at timestamp with time zone DEFAULT now() NOT NULL,
-    updated_at timestamp with time zone DEFAULT now() NOT NULL
+    updated_at timestamp with time zone DEFAULT now() NOT NULL,
+    processed integer DEFAULT 0 NOT NULL,
+    total_price integer DEFAULT 0 NOT NULL,
+    status character varying(255) DEFAULT 'confirmed'::character varying NOT NULL,
+    reference character varying(255),
+    CONSTRAINT rent_status_check CHECK (((status)::text = ANY ((ARRAY['pending'::character varying, 'confirmed'::character varying, 'checked_out'::character varying, 'returned'::character varying, 'cancelled'::character varying, 'no_show'::character varying])::text[])))
 );
 
 
@@ -110,7 +210,10 @@ CREATE TABLE public.rent_restrictions (
     rent_id integer,
     created_at timestamp with time zone DEFAULT now() NOT NULL,
     updated_at timestamp with time zone DEFAULT now() NOT NULL,
-    restriction_id bigint NOT NULL
+    restriction_id bigint NOT NULL,
+    vehicle_id bigint NOT NULL,
+    external_uid character varying(255),
+    expires_at timestamp with time zone
 );
 
 
@@ -138,6 +241,83 @@ ALTER TABLE public.rent_restrictions_id_seq OWNER TO postgres;
 ALTER SEQUENCE public.rent_restrictions_id_seq OWNED BY public.rent_restrictions.id;
 
 
+--
+-- Name: rent_status_history; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.rent_status_history (
+    id integer NOT NULL,
+    rent_id integer NOT NULL,
+    from_status character varying(255) NOT NULL,
+    to_status character varying(255) NOT NULL,
+    changed_by character varying(255) NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.rent_status_history OWNER TO postgres;
+
+--
+-- Name: rent_status_history_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.rent_status_history_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.rent_status_history_id_seq OWNER TO postgres;
+
+--
+-- Name: rent_status_history_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.rent_status_history_id_seq OWNED BY public.rent_status_history.id;
+
+
+--
+-- Name: rental_discounts; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.rental_discounts (
+    id integer NOT NULL,
+    model_id bigint NOT NULL,
+    min_days integer NOT NULL,
+    percent integer NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.rental_discounts OWNER TO postgres;
+
+--
+-- Name: rental_discounts_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.rental_discounts_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.rental_discounts_id_seq OWNER TO postgres;
+
+--
+-- Name: rental_discounts_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.rental_discounts_id_seq OWNED BY public.rental_discounts.id;
+
+
 --
 -- Name: restriction_types; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -225,6 +405,46 @@ ALTER TABLE public.users_id_seq OWNER TO postgres;
 ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
 
 
+--
+-- Name: vehicles; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.vehicles (
+    id integer NOT NULL,
+    model_id bigint NOT NULL,
+    vin character varying(17) NOT NULL,
+    plate character varying(255) DEFAULT ''::character varying NOT NULL,
+    color character varying(255) DEFAULT ''::character varying NOT NULL,
+    active boolean DEFAULT true NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.vehicles OWNER TO postgres;
+
+--
+-- Name: vehicles_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.vehicles_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.vehicles_id_seq OWNER TO postgres;
+
+--
+-- Name: vehicles_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.vehicles_id_seq OWNED BY public.vehicles.id;
+
+
 --
 -- Name: models id; Type: DEFAULT; Schema: public; Owner: postgres
 --
@@ -232,6 +452,20 @@ ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
 ALTER TABLE ONLY public.models ALTER COLUMN id SET DEFAULT nextval('public.models_id_seq'::regclass);
 
 
+--
+-- Name: payments id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.payments ALTER COLUMN id SET DEFAULT nextval('public.payments_id_seq'::regclass);
+
+
+--
+-- Name: rate_periods id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rate_periods ALTER COLUMN id SET DEFAULT nextval('public.rate_periods_id_seq'::regclass);
+
+
 --
 -- Name: rent id; Type: DEFAULT; Schema: public; Owner: postgres
 --
@@ -246,6 +480,20 @@ ALTER TABLE ONLY public.rent ALTER COLUMN id SET DEFAULT nextval('public.rent_id
 ALTER TABLE ONLY public.rent_restrictions ALTER COLUMN id SET DEFAULT nextval('public.rent_restrictions_id_seq'::regclass);
 
 
+--
+-- Name: rent_status_history id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rent_status_history ALTER COLUMN id SET DEFAULT nextval('public.rent_status_history_id_seq'::regclass);
+
+
+--
+-- Name: rental_discounts id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rental_discounts ALTER COLUMN id SET DEFAULT nextval('public.rental_discounts_id_seq'::regclass);
+
+
 --
 -- Name: restriction_types id; Type: DEFAULT; Schema: public; Owner: postgres
 --
@@ -260,6 +508,13 @@ ALTER TABLE ONLY public.restriction_types ALTER COLUMN id SET DEFAULT nextval('p
 ALTER TABLE ONLY public.users ALTER COLUMN id SET DEFAULT nextval('public.users_id_seq'::regclass);
 
 
+--
+-- Name: vehicles id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.vehicles ALTER COLUMN id SET DEFAULT nextval('public.vehicles_id_seq'::regclass);
+
+
 --
 -- Name: models models_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
 --
@@ -268,6 +523,22 @@ ALTER TABLE ONLY public.models
     ADD CONSTRAINT models_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: payments payments_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.payments
+    ADD CONSTRAINT payments_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: rate_periods rate_periods_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rate_periods
+    ADD CONSTRAINT rate_periods_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: rent rent_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
 --
@@ -284,6 +555,30 @@ ALTER TABLE ONLY public.rent_restrictions
     ADD CONSTRAINT rent_restrictions_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: rent_status_history rent_status_history_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rent_status_history
+    ADD CONSTRAINT rent_status_history_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: rent_restrictions rent_restrictions_no_overlap_excl; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rent_restrictions
+    ADD CONSTRAINT rent_restrictions_no_overlap_excl EXCLUDE USING gist (vehicle_id WITH =, daterange(start_date, end_date, '[)'::text) WITH &&);
+
+
+--
+-- Name: rental_discounts rental_discounts_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rental_discounts
+    ADD CONSTRAINT rental_discounts_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: restriction_types restriction_types_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
 --
@@ -308,6 +603,35 @@ ALTER TABLE ONLY public.users
     ADD CONSTRAINT users_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: vehicles vehicles_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.vehicles
+    ADD CONSTRAINT vehicles_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: payments_provider_intent_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX payments_provider_intent_id_idx ON public.payments USING btree (provider, intent_id);
+
+
+--
+-- Name: payments_rent_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX payments_rent_id_idx ON public.payments USING btree (rent_id);
+
+
+--
+-- Name: rate_periods_model_id_start_date_end_date_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX rate_periods_model_id_start_date_end_date_idx ON public.rate_periods USING btree (model_id, start_date, end_date);
+
+
 --
 -- Name: rent_email_idx; Type: INDEX; Schema: public; Owner: postgres
 --
@@ -322,6 +646,27 @@ CREATE INDEX rent_email_idx ON public.rent USING btree (email);
 CREATE INDEX rent_last_name_idx ON public.rent USING btree (last_name);
 
 
+--
+-- Name: rent_reference_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX rent_reference_idx ON public.rent USING btree (reference);
+
+
+--
+-- Name: rent_restrictions_expires_at_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX rent_restrictions_expires_at_idx ON public.rent_restrictions USING btree (expires_at);
+
+
+--
+-- Name: rent_restrictions_model_id_external_uid_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX rent_restrictions_model_id_external_uid_idx ON public.rent_restrictions USING btree (model_id, external_uid);
+
+
 --
 -- Name: rent_restrictions_model_id_idx; Type: INDEX; Schema: public; Owner: postgres
 --
@@ -343,6 +688,27 @@ CREATE INDEX rent_restrictions_rent_id_idx ON public.rent_restrictions USING btr
 CREATE INDEX rent_restrictions_start_date_end_date_model_id_rent_id_idx ON public.rent_restrictions USING btree (start_date, end_date, model_id, rent_id);
 
 
+--
+-- Name: rent_restrictions_vehicle_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX rent_restrictions_vehicle_id_idx ON public.rent_restrictions USING btree (vehicle_id);
+
+
+--
+-- Name: rent_status_history_rent_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX rent_status_history_rent_id_idx ON public.rent_status_history USING btree (rent_id);
+
+
+--
+-- Name: rental_discounts_model_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX rental_discounts_model_id_idx ON public.rental_discounts USING btree (model_id);
+
+
 --
 -- Name: schema_migration_version_idx; Type: INDEX; Schema: public; Owner: postgres
 --
@@ -357,6 +723,36 @@ CREATE UNIQUE INDEX schema_migration_version_idx ON public.schema_migration USIN
 CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email);
 
 
+--
+-- Name: vehicles_model_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX vehicles_model_id_idx ON public.vehicles USING btree (model_id);
+
+
+--
+-- Name: vehicles_vin_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX vehicles_vin_idx ON public.vehicles USING btree (vin);
+
+
+--
+-- Name: payments payments_rent_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.payments
+    ADD CONSTRAINT payments_rent_id_fk FOREIGN KEY (rent_id) REFERENCES public.rent(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: rate_periods rate_periods_models_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rate_periods
+    ADD CONSTRAINT rate_periods_models_id_fk FOREIGN KEY (model_id) REFERENCES public.models(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
 --
 -- Name: rent rent_models_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
 --
@@ -389,6 +785,38 @@ ALTER TABLE ONLY public.rent_restrictions
     ADD CONSTRAINT rent_restrictions_restriction_types_id_fk FOREIGN KEY (restriction_id) REFERENCES public.restriction_types(id) ON UPDATE CASCADE ON DELETE CASCADE;
 
 
+--
+-- Name: rent_restrictions rent_restrictions_vehicles_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rent_restrictions
+    ADD CONSTRAINT rent_restrictions_vehicles_id_fk FOREIGN KEY (vehicle_id) REFERENCES public.vehicles(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: rent_status_history rent_status_history_rent_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rent_status_history
+    ADD CONSTRAINT rent_status_history_rent_id_fk FOREIGN KEY (rent_id) REFERENCES public.rent(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: rental_discounts rental_discounts_models_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rental_discounts
+    ADD CONSTRAINT rental_discounts_models_id_fk FOREIGN KEY (model_id) REFERENCES public.models(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: vehicles vehicles_models_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.vehicles
+    ADD CONSTRAINT vehicles_models_id_fk FOREIGN KEY (model_id) REFERENCES public.models(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
 --
 -- PostgreSQL database dump complete
 --
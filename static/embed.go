@@ -0,0 +1,10 @@
+// Package static holds the css, js and image files, embedded into the
+// binary.
+package static
+
+import "embed"
+
+// FS contains the css, js and images directories
+//
+//go:embed css js images
+var FS embed.FS
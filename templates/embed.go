@@ -0,0 +1,10 @@
+// Package templates holds the page, layout and email templates, embedded
+// into the binary.
+package templates
+
+import "embed"
+
+// FS contains *.page.html, *.layout.html and email/*.html
+//
+//go:embed *.html email/*.html
+var FS embed.FS